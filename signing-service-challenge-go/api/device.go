@@ -1,15 +1,33 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/utils"
 	"github.com/google/uuid"
 )
 
+// Page sizes of the signature journal listings
+const (
+	DefaultSignaturesPageSize = 50
+	MaxSignaturesPageSize     = 500
+)
+
+// Header carrying the key that makes retries of a signing request return the first signature, and its maximum length
+const (
+	IdempotencyKeyHeader    = "Idempotency-Key"
+	MaxIdempotencyKeyLength = 255
+)
+
 type DeviceApi struct {
 	service domain.DeviceServiceInterface
 	utils   utils.UtilsInterface
@@ -28,15 +46,27 @@ func NewDeviceApi(service domain.DeviceServiceInterface, utils utils.UtilsInterf
 // @Description Creates a new signature device with the specified parameters
 // @Tags Devices
 // @Produce json
-// @Param algorithm query string true "Algorithm (ECC or RSA)"
+// @Param algorithm query string true "Algorithm (ECC, ED25519 or RSA)"
 // @Param label query string true "Label for the device"
+// @Param keySize query int false "Key size in bits (RSA: 2048, 3072 or 4096, ECC: 256, 384 or 521)"
+// @Param curve query string false "Curve for ECC devices (P-256, P-384 or P-521)"
+// @Param digest query string false "Digest used for signing (SHA-256, SHA-384, SHA-512 or SHA3-256), defaults to the one matching the key"
+// @Param padding query string false "Padding scheme for RSA devices (PKCS1v15 or PSS)"
+// @Param saltLength query int false "Salt length in bytes for RSA-PSS devices (defaults to the hash length)"
+// @Param encoding query string false "Signature encoding for ECC devices (ASN1 for DER or P1363 for raw r||s), defaults to ASN1"
+// @Param deterministic query bool false "Derive the ECDSA nonce from the key and the data (RFC 6979) instead of drawing it at random"
 // @Success 200 {object} CreateDeviceResponse
 // @Failure 400 {string} string "Bad Request"
 // @Failure 500 {string} string "Internal Server Error"
-// @Router /new-device [post]
+// @Deprecated
+// @Router /v0/device/new-device [post]
 func (a *DeviceApi) CreateSignatureDevice(w http.ResponseWriter, r *http.Request) {
 	algorithm := r.URL.Query().Get("algorithm")
 	label := r.URL.Query().Get("label")
+	curve := r.URL.Query().Get("curve")
+	digest := r.URL.Query().Get("digest")
+	padding := r.URL.Query().Get("padding")
+	encoding := r.URL.Query().Get("encoding")
 
 	// Validate required parameters
 	if label == "" {
@@ -48,56 +78,307 @@ func (a *DeviceApi) CreateSignatureDevice(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Validate optional key size
+	var keySize int
+	if value := r.URL.Query().Get("keySize"); value != "" {
+		var err error
+		keySize, err = strconv.Atoi(value)
+		if err != nil || keySize <= 0 {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid keySize. Must be a positive number of bits"})
+			return
+		}
+	}
+
+	// Validate optional salt length
+	var saltLength int
+	if value := r.URL.Query().Get("saltLength"); value != "" {
+		var err error
+		saltLength, err = strconv.Atoi(value)
+		if err != nil || saltLength <= 0 {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid saltLength. Must be a positive number of bytes"})
+			return
+		}
+	}
+
+	// Validate optional deterministic flag
+	var deterministic bool
+	if value := r.URL.Query().Get("deterministic"); value != "" {
+		var err error
+		deterministic, err = strconv.ParseBool(value)
+		if err != nil {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deterministic. Must be true or false"})
+			return
+		}
+	}
+
+	a.createDevice(w, r, CreateDeviceRequest{
+		Algorithm:     algorithm,
+		Label:         label,
+		KeySize:       keySize,
+		Curve:         curve,
+		Digest:        digest,
+		Padding:       padding,
+		SaltLength:    saltLength,
+		Encoding:      encoding,
+		Deterministic: deterministic,
+	})
+}
+
+// Create the device of a validated request
+func (a *DeviceApi) createDevice(w http.ResponseWriter, r *http.Request, req CreateDeviceRequest) {
 	// Validate algorithm value
-	if algorithm != "ECC" && algorithm != "RSA" {
-		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid algorithm. Must be 'ECC' or 'RSA'"})
+	supportedAlgorithms := a.utils.SupportedAlgorithms()
+	if !slices.Contains(supportedAlgorithms, req.Algorithm) {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid algorithm. Must be " + quoteAlternatives(supportedAlgorithms)})
 		return
 	}
 
+	// Validate optional client chosen ID
+	var id uuid.UUID
+	if req.ID != "" {
+		var err error
+		id, err = uuid.Parse(req.ID)
+		if err != nil || id == uuid.Nil {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid id. Must be a valid UUID"})
+			return
+		}
+	}
+
 	ctx := r.Context()
 
 	// Calling the service
-	device, err := a.service.CreateSignatureDevice(ctx, algorithm, label)
+	device, err := a.service.CreateSignatureDevice(ctx, domain.DeviceSpec{
+		ID:        id,
+		Algorithm: req.Algorithm,
+		Label:     req.Label,
+		KeyParameters: crypto.KeyParameters{
+			Size:  req.KeySize,
+			Curve: req.Curve,
+		},
+		SignOptions: crypto.SignOptions{
+			Digest:        req.Digest,
+			Padding:       req.Padding,
+			SaltLength:    req.SaltLength,
+			Encoding:      req.Encoding,
+			Deterministic: req.Deterministic,
+		},
+		SecuredDataFormat: req.SecuredDataFormat,
+	})
 	if err != nil {
-		WriteErrorResponse(w, http.StatusInternalServerError, []string{"Failed to create signature device", err.Error()})
+		WriteServiceError(w, err, "Failed to create signature device")
 		return
 	}
 
-	var publicKey, privateKey string
-	switch device.Algorithm {
-	case "ECC":
-		publicKey, err = a.utils.ECCPublicKeyToString(device.PublicKey)
-		if err != nil {
-			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
-		}
+	publicKey, err := a.utils.PublicKeyToString(device.Algorithm, device.PublicKey)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		return
+	}
 
-		privateKey, err = a.utils.ECCPrivateKeyToString(device.PrivateKey)
-		if err != nil {
-			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
-		}
+	// Creating response
+	createSignatureDeviceResponse := CreateDeviceResponse{
+		ID:                device.ID,
+		Algorithm:         device.Algorithm,
+		Label:             device.Label,
+		KeySize:           device.KeySize,
+		Curve:             device.Curve,
+		Digest:            device.Digest,
+		Padding:           device.Padding,
+		SaltLength:        device.SaltLength,
+		Encoding:          device.Encoding,
+		Deterministic:     device.Deterministic,
+		KeyID:             device.KeyID,
+		PublicKey:         publicKey,
+		SecuredDataFormat: domain.DeviceSecuredDataFormat(device),
+	}
 
-	case "RSA":
-		publicKey, err = a.utils.RSAPublicKeyToString(device.PublicKey)
-		if err != nil {
-			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
-		}
+	WriteAPIResponse(w, http.StatusCreated, createSignatureDeviceResponse)
+}
 
-		privateKey, err = a.utils.RSAPrivateKeyToString(device.PrivateKey)
-		if err != nil {
-			WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
-		}
+// ImportSignatureDevice godoc
+// @Title ImportSignatureDevice
+// @Summary Import a signature device
+// @Description Creates a signature device from an existing private key, resuming its signature chain from the given counter and last signature. The secured data format defaults to v1.
+// @Tags Devices
+// @Accept json
+// @Produce json
+// @Param device body ImportDeviceRequest true "Device to import"
+// @Success 201 {object} GetDeviceResponse
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/import-device [post]
+func (a *DeviceApi) ImportSignatureDevice(w http.ResponseWriter, r *http.Request) {
+	var req ImportDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid request body"})
+		return
+	}
+
+	// Validate required fields
+	if req.Label == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'label' is required"})
+		return
+	}
+	if req.PrivateKey == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'privateKey' is required"})
+		return
+	}
+	supportedAlgorithms := a.utils.SupportedAlgorithms()
+	if !slices.Contains(supportedAlgorithms, req.Algorithm) {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid algorithm. Must be " + quoteAlternatives(supportedAlgorithms)})
+		return
+	}
+
+	ctx := r.Context()
+
+	// Calling the service
+	device, err := a.service.ImportSignatureDevice(ctx, domain.ImportSpec{
+		Algorithm:  req.Algorithm,
+		Label:      req.Label,
+		PrivateKey: []byte(req.PrivateKey),
+		SignOptions: crypto.SignOptions{
+			Digest:        req.Digest,
+			Padding:       req.Padding,
+			SaltLength:    req.SaltLength,
+			Encoding:      req.Encoding,
+			Deterministic: req.Deterministic,
+		},
+		SignatureCounter:  req.SignatureCounter,
+		LastSignature:     req.LastSignature,
+		SecuredDataFormat: req.SecuredDataFormat,
+	})
+	if err != nil {
+		WriteServiceError(w, err, "Failed to import signature device")
+		return
 	}
 
 	// Creating response
-	createSignatureDeviceResponse := CreateDeviceResponse{
+	getDeviceResponse, err := a.deviceToGetDeviceResponse(device)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{"Failed to convert device to response", err.Error()})
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusCreated, getDeviceResponse)
+}
+
+// ExportPrivateKey godoc
+// @Title ExportPrivateKey
+// @Summary Export the private key of a device
+// @Description Returns the private key of a device as a password protected PKCS#8 PEM block. Exporting keys must be enabled in the server configuration and every attempt is audited.
+// @Tags Devices
+// @Accept json
+// @Produce json
+// @Param deviceId query string true "Device ID"
+// @Param password body ExportKeyRequest true "Password protecting the exported key"
+// @Success 200 {object} ExportKeyResponse
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 403 {object} ErrorResponse "Key export disabled or not supported by the key store"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/export-key [post]
+func (a *DeviceApi) ExportPrivateKey(w http.ResponseWriter, r *http.Request) {
+	// Get and validate deviceId
+	deviceId := r.URL.Query().Get("deviceId")
+
+	if deviceId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: deviceId"})
+		return
+	}
+	uuid, err := uuid.Parse(deviceId)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deviceId. Must be a valid UUID"})
+		return
+	}
+
+	a.exportPrivateKey(w, r, uuid)
+}
+
+// Export the private key of the device with the password of the request body
+func (a *DeviceApi) exportPrivateKey(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	// Get and validate the password
+	var req ExportKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid request body"})
+		return
+	}
+
+	ctx := r.Context()
+
+	// Calling the service, which audits the attempt whether or not the device exists
+	privateKey, err := a.service.ExportPrivateKey(ctx, id, req.Password)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to export private key")
+		return
+	}
+	device, err := a.service.GetDevice(ctx, id)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to get device")
+		return
+	}
+
+	// Creating response
+	exportKeyResponse := ExportKeyResponse{
 		ID:         device.ID,
 		Algorithm:  device.Algorithm,
-		Label:      device.Label,
-		PublicKey:  publicKey,
 		PrivateKey: privateKey,
 	}
 
-	WriteAPIResponse(w, http.StatusCreated, createSignatureDeviceResponse)
+	WriteAPIResponse(w, http.StatusOK, exportKeyResponse)
+}
+
+// RotateDeviceKey godoc
+// @Title RotateDeviceKey
+// @Summary Rotate the key of a device
+// @Description Replaces the key pair of a device with a new one. The rotation is signed by the old key as the next record of the signature chain, which the new key then continues. Previous public keys stay available by key ID.
+// @Tags Devices
+// @Produce json
+// @Param deviceId query string true "Device ID"
+// @Success 200 {object} GetDeviceResponse
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 409 {object} ErrorResponse "Device modified concurrently"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/rotate-key [post]
+func (a *DeviceApi) RotateDeviceKey(w http.ResponseWriter, r *http.Request) {
+	// Get and validate deviceId
+	deviceId := r.URL.Query().Get("deviceId")
+
+	if deviceId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: deviceId"})
+		return
+	}
+	uuid, err := uuid.Parse(deviceId)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deviceId. Must be a valid UUID"})
+		return
+	}
+
+	a.rotateDeviceKey(w, r, uuid, http.StatusOK)
+}
+
+// Rotate the key of the device, responding with the status on success
+func (a *DeviceApi) rotateDeviceKey(w http.ResponseWriter, r *http.Request, id uuid.UUID, status int) {
+	ctx := r.Context()
+
+	// Calling the service
+	device, err := a.service.RotateDeviceKey(ctx, id)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to rotate device key")
+		return
+	}
+
+	// Creating response
+	getDeviceResponse, err := a.deviceToGetDeviceResponse(device)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{"Failed to convert device to response", err.Error()})
+		return
+	}
+
+	WriteAPIResponse(w, status, getDeviceResponse)
 }
 
 // SignTransaction godoc
@@ -106,13 +387,17 @@ func (a *DeviceApi) CreateSignatureDevice(w http.ResponseWriter, r *http.Request
 // @Description Signs a transaction using the specified device ID and data payload.
 // @Tags Devices
 // @Produce json
-// @Param deviceId path string true "Device ID"
-// @Param data body string true "Data to be signed"
+// @Param deviceId query string true "Device ID"
+// @Param request body SignTransactionRequest true "Data to be signed"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first signature instead of signing again"
 // @Success 200 {object} SignaturedDataResponse "Signature successfully generated"
 // @Failure 400 {object} ErrorResponse "Invalid input data"
 // @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 409 {object} ErrorResponse "Device signing concurrently"
+// @Failure 422 {object} ErrorResponse "Idempotency key used with different data"
 // @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /sign/{deviceId} [post]
+// @Deprecated
+// @Router /v0/device/sign [get]
 func (a *DeviceApi) SignTransaction(w http.ResponseWriter, r *http.Request) {
 	// Get and validate deviceId
 	deviceId := r.URL.Query().Get("deviceId")
@@ -127,6 +412,11 @@ func (a *DeviceApi) SignTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.signTransaction(w, r, uuid, http.StatusOK)
+}
+
+// Sign the data of the request body with the device, writing the signature with the status
+func (a *DeviceApi) signTransaction(w http.ResponseWriter, r *http.Request, id uuid.UUID, status int) {
 	// Get and validate data
 	var req SignTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -140,27 +430,312 @@ func (a *DeviceApi) SignTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate optional idempotency key
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	if len(idempotencyKey) > MaxIdempotencyKeyLength {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{fmt.Sprintf("Invalid %s header. Must be at most %d characters long", IdempotencyKeyHeader, MaxIdempotencyKeyLength)})
+		return
+	}
+
 	ctx := r.Context()
 
 	// Calling the service
-	signaturedData, err := a.service.SignTransaction(ctx, uuid, req.Data)
+	var signaturedData model.SignaturedData
+	var err error
+	if idempotencyKey != "" {
+		signaturedData, err = a.service.SignTransactionIdempotent(ctx, id, req.Data, idempotencyKey)
+	} else {
+		signaturedData, err = a.service.SignTransaction(ctx, id, req.Data)
+	}
 	if err != nil {
-		if err.Error() == "device not found" {
-			WriteErrorResponse(w, http.StatusNotFound, []string{"Device not found"})
-			return
-		} else {
-			WriteErrorResponse(w, http.StatusInternalServerError, []string{"Failed to sign transaction", err.Error()})
-			return
-		}
+		WriteServiceError(w, err, "Failed to sign transaction")
+		return
 	}
 
 	// Creating response
 	signaturedDataResponse := SignaturedDataResponse{
 		Signature:  signaturedData.Signature,
 		SignedData: signaturedData.SignedData,
+		Digest:     signaturedData.Digest,
+		Encoding:   signaturedData.Encoding,
 	}
 
-	WriteAPIResponse(w, http.StatusOK, signaturedDataResponse)
+	WriteAPIResponse(w, status, signaturedDataResponse)
+}
+
+// VerifySignature godoc
+// @Title VerifySignature
+// @Summary Verify a signature
+// @Description Checks that a signature was issued by the device for the signed data, in the v1 format "<counter>_<data>_<last_signature>" or the v2 format "v2_<counter>_<time>_<algorithm>_<data length>_<data>_<last_signature>", using the key of the device that was active for the counter.
+// @Tags Devices
+// @Accept json
+// @Produce json
+// @Param deviceId query string true "Device ID"
+// @Param request body VerifySignatureRequest true "Signed data and base64 encoded signature"
+// @Success 200 {object} VerifySignatureResponse "Verification result, including the reason an invalid signature was rejected"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/verify [post]
+func (a *DeviceApi) VerifySignature(w http.ResponseWriter, r *http.Request) {
+	// Get and validate deviceId
+	deviceId := r.URL.Query().Get("deviceId")
+
+	if deviceId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: deviceId"})
+		return
+	}
+	uuid, err := uuid.Parse(deviceId)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deviceId. Must be a valid UUID"})
+		return
+	}
+
+	a.verifySignature(w, r, uuid)
+}
+
+// Verify the signature of the request body with the device
+func (a *DeviceApi) verifySignature(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	// Get and validate the signed data and signature
+	var req VerifySignatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid request body"})
+		return
+	}
+
+	// Validate data recieved
+	if req.SignedData == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'signed_data' is required"})
+		return
+	}
+	if req.Signature == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'signature' is required"})
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'signature' must be base64 encoded"})
+		return
+	}
+
+	ctx := r.Context()
+
+	// Calling the service
+	verification, err := a.service.VerifySignature(ctx, id, req.SignedData, signature)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to verify signature")
+		return
+	}
+
+	// Creating response
+	verifySignatureResponse := VerifySignatureResponse{
+		Valid:         verification.Valid,
+		Reason:        verification.Reason,
+		KeyID:         verification.KeyID,
+		Counter:       verification.Counter,
+		Data:          verification.Data,
+		LastSignature: verification.LastSignature,
+		Format:        verification.Format,
+		Time:          verification.Time,
+		Algorithm:     verification.Algorithm,
+	}
+
+	WriteAPIResponse(w, http.StatusOK, verifySignatureResponse)
+}
+
+// AuditSignatureChain godoc
+// @Title AuditSignatureChain
+// @Summary Audit the signature chain of a device
+// @Description Walks every stored signature of the device and checks that each one verifies, that the counters are contiguous from the start of the chain, that each signature references its predecessor and that the first one is chained to the base64 encoded device ID. Gaps and breaks are reported as issues.
+// @Tags Devices
+// @Produce json
+// @Param deviceId query string true "Device ID"
+// @Success 200 {object} ChainAuditResponse "Audit report"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/audit [get]
+func (a *DeviceApi) AuditSignatureChain(w http.ResponseWriter, r *http.Request) {
+	// Get and validate deviceId
+	deviceId := r.URL.Query().Get("deviceId")
+
+	if deviceId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: deviceId"})
+		return
+	}
+	uuid, err := uuid.Parse(deviceId)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deviceId. Must be a valid UUID"})
+		return
+	}
+
+	a.auditSignatureChain(w, r, uuid)
+}
+
+// Audit the signature chain of the device
+func (a *DeviceApi) auditSignatureChain(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	ctx := r.Context()
+
+	// Calling the service
+	audit, err := a.service.AuditSignatureChain(ctx, id)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to audit signature chain")
+		return
+	}
+
+	// Creating response
+	chainAuditResponse := ChainAuditResponse{
+		DeviceID:         audit.DeviceID,
+		Intact:           audit.Intact,
+		FirstCounter:     audit.FirstCounter,
+		SignatureCounter: audit.SignatureCounter,
+		Records:          audit.Records,
+		Issues:           make([]ChainIssueResponse, 0, len(audit.Issues)),
+	}
+	for _, issue := range audit.Issues {
+		chainAuditResponse.Issues = append(chainAuditResponse.Issues, ChainIssueResponse{
+			Kind:    issue.Kind,
+			Counter: issue.Counter,
+			Detail:  issue.Detail,
+		})
+	}
+
+	WriteAPIResponse(w, http.StatusOK, chainAuditResponse)
+}
+
+// ListSignatures godoc
+// @Title ListSignatures
+// @Summary List the signatures of a device
+// @Description Retrieves a page of the journaled signatures of a device, in the order they were issued.
+// @Tags Devices
+// @Produce json
+// @Param deviceId query string true "Device ID"
+// @Param offset query int false "Number of signatures to skip, defaults to 0"
+// @Param limit query int false "Maximum number of signatures to return, defaults to 50 and at most 500"
+// @Success 200 {object} ListSignaturesResponse "Signatures successfully retrieved"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/signatures [get]
+func (a *DeviceApi) ListSignatures(w http.ResponseWriter, r *http.Request) {
+	// Get and validate deviceId
+	deviceId := r.URL.Query().Get("deviceId")
+
+	if deviceId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: deviceId"})
+		return
+	}
+	uuid, err := uuid.Parse(deviceId)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deviceId. Must be a valid UUID"})
+		return
+	}
+
+	a.listSignatures(w, r, uuid)
+}
+
+// List a page of the signatures of the device, with the page of the query parameters of the request
+func (a *DeviceApi) listSignatures(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	var err error
+
+	// Get and validate the page
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid offset. Must be a non-negative number"})
+			return
+		}
+	}
+	limit := DefaultSignaturesPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > MaxSignaturesPageSize {
+			WriteErrorResponse(w, http.StatusBadRequest, []string{fmt.Sprintf("Invalid limit. Must be a number between 1 and %d", MaxSignaturesPageSize)})
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	// Calling the service
+	records, total, err := a.service.ListSignatures(ctx, id, offset, limit)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to list signatures")
+		return
+	}
+
+	// Creating response
+	listSignaturesResponse := ListSignaturesResponse{
+		Signatures: make([]SignatureResponse, 0, len(records)),
+		Offset:     offset,
+		Limit:      limit,
+		Total:      total,
+	}
+	for _, record := range records {
+		listSignaturesResponse.Signatures = append(listSignaturesResponse.Signatures, signatureRecordToResponse(record))
+	}
+
+	WriteAPIResponse(w, http.StatusOK, listSignaturesResponse)
+}
+
+// GetSignature godoc
+// @Title GetSignature
+// @Summary Get a signature of a device
+// @Description Retrieves the journaled signature of a device with the given signature counter.
+// @Tags Devices
+// @Produce json
+// @Param deviceId query string true "Device ID"
+// @Param counter query int true "Signature counter"
+// @Success 200 {object} SignatureResponse "Signature successfully retrieved"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device or signature not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/signature [get]
+func (a *DeviceApi) GetSignature(w http.ResponseWriter, r *http.Request) {
+	// Get and validate deviceId and counter
+	deviceId := r.URL.Query().Get("deviceId")
+	counterParam := r.URL.Query().Get("counter")
+
+	if deviceId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: deviceId"})
+		return
+	}
+	if counterParam == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: counter"})
+		return
+	}
+	uuid, err := uuid.Parse(deviceId)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deviceId. Must be a valid UUID"})
+		return
+	}
+
+	a.getSignature(w, r, uuid, counterParam)
+}
+
+// Get the signature of the device with the counter, validating the counter
+func (a *DeviceApi) getSignature(w http.ResponseWriter, r *http.Request, id uuid.UUID, counterParam string) {
+	counter, err := strconv.Atoi(counterParam)
+	if err != nil || counter < 0 {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid counter. Must be a non-negative number"})
+		return
+	}
+
+	ctx := r.Context()
+
+	// Calling the service
+	record, err := a.service.GetSignature(ctx, id, counter)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to get signature")
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, signatureRecordToResponse(record))
 }
 
 // GetDevice godoc
@@ -169,12 +744,13 @@ func (a *DeviceApi) SignTransaction(w http.ResponseWriter, r *http.Request) {
 // @Description Retrieves a device by its ID and returns its details.
 // @Tags Devices
 // @Produce json
-// @Param deviceId path string true "Device ID"
+// @Param deviceId query string true "Device ID"
 // @Success 200 {object} GetDeviceResponse "Device successfully retrieved"
 // @Failure 400 {object} ErrorResponse "Invalid input data"
 // @Failure 404 {object} ErrorResponse "Device not found"
 // @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /{deviceId} [get]
+// @Deprecated
+// @Router /v0/device/ [get]
 func (a *DeviceApi) GetDevice(w http.ResponseWriter, r *http.Request) {
 	// Get and validate deviceId
 	deviceId := r.URL.Query().Get("deviceId")
@@ -189,15 +765,17 @@ func (a *DeviceApi) GetDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.getDevice(w, r, uuid)
+}
+
+// Write the details of the device
+func (a *DeviceApi) getDevice(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
 	ctx := r.Context()
 
 	// Calling the service
-	device, err := a.service.GetDevice(ctx, uuid)
-	if err != nil && err.Error() == "device not found" {
-		WriteErrorResponse(w, http.StatusNotFound, []string{"Device not found"})
-		return
-	} else if err != nil {
-		WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+	device, err := a.service.GetDevice(ctx, id)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to get device")
 		return
 	}
 
@@ -205,11 +783,75 @@ func (a *DeviceApi) GetDevice(w http.ResponseWriter, r *http.Request) {
 	getDeviceResponse, err := a.deviceToGetDeviceResponse(device)
 	if err != nil {
 		WriteErrorResponse(w, http.StatusInternalServerError, []string{"Failed to convert device to response", err.Error()})
+		return
 	}
 
 	WriteAPIResponse(w, http.StatusOK, getDeviceResponse)
 }
 
+// GetDeviceKey godoc
+// @Title GetDeviceKey
+// @Summary Get a key of a device
+// @Description Retrieves the current or a previous public key of a device by its key ID, with the signature counters it covers.
+// @Tags Devices
+// @Produce json
+// @Param deviceId query string true "Device ID"
+// @Param keyId query string true "Key ID"
+// @Success 200 {object} DeviceKeyResponse "Key successfully retrieved"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device or key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Deprecated
+// @Router /v0/device/key [get]
+func (a *DeviceApi) GetDeviceKey(w http.ResponseWriter, r *http.Request) {
+	// Get and validate deviceId and keyId
+	deviceId := r.URL.Query().Get("deviceId")
+	keyId := r.URL.Query().Get("keyId")
+
+	if deviceId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: deviceId"})
+		return
+	}
+	if keyId == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Missing required parameter: keyId"})
+		return
+	}
+	uuid, err := uuid.Parse(deviceId)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid deviceId. Must be a valid UUID"})
+		return
+	}
+
+	a.getDeviceKey(w, r, uuid, keyId)
+}
+
+// Get a key of the device by its key ID
+func (a *DeviceApi) getDeviceKey(w http.ResponseWriter, r *http.Request, id uuid.UUID, keyId string) {
+	ctx := r.Context()
+
+	// Calling the service
+	device, err := a.service.GetDevice(ctx, id)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to get device")
+		return
+	}
+
+	key, err := a.service.GetDeviceKey(ctx, id, keyId)
+	if err != nil {
+		WriteServiceError(w, err, "Failed to get device key")
+		return
+	}
+
+	// Creating response
+	deviceKeyResponse, err := a.deviceKeyToResponse(device.Algorithm, key)
+	if err != nil {
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{"Failed to convert key to response", err.Error()})
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, deviceKeyResponse)
+}
+
 // GetDevice godoc
 // @Title GetAllDevices
 // @Summary Get all the devices
@@ -218,14 +860,15 @@ func (a *DeviceApi) GetDevice(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Success 200 {object} GetAllDevicesResponse "Devices successfully retrieved"
 // @Failure 500 {object} ErrorResponse "Internal server error"
-// @Router /all [get]
+// @Deprecated
+// @Router /v0/device/all [get]
 func (a *DeviceApi) GetAllDevices(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	// Calling the service
 	devices, err := a.service.GetAllDevices(ctx)
 	if err != nil {
-		WriteErrorResponse(w, http.StatusInternalServerError, []string{err.Error()})
+		WriteServiceError(w, err, "Failed to get devices")
 		return
 	}
 
@@ -233,6 +876,7 @@ func (a *DeviceApi) GetAllDevices(w http.ResponseWriter, r *http.Request) {
 	getDeviceResponse, err := a.devicesToGetAllDevicesResponse(devices)
 	if err != nil {
 		WriteErrorResponse(w, http.StatusInternalServerError, []string{"Failed to convert device to response", err.Error()})
+		return
 	}
 
 	WriteAPIResponse(w, http.StatusOK, getDeviceResponse)
@@ -240,43 +884,70 @@ func (a *DeviceApi) GetAllDevices(w http.ResponseWriter, r *http.Request) {
 
 // Convert Device to GetDeviceResponse
 func (a *DeviceApi) deviceToGetDeviceResponse(device model.Device) (GetDeviceResponse, error) {
-	var publicKey, privateKey string
-	var err error
+	publicKey, err := a.utils.PublicKeyToString(device.Algorithm, device.PublicKey)
+	if err != nil {
+		return GetDeviceResponse{}, err
+	}
 
-	switch device.Algorithm {
-	case "ECC":
-		publicKey, err = a.utils.ECCPublicKeyToString(device.PublicKey)
+	var previousKeys []DeviceKeyResponse
+	for _, key := range device.PreviousKeys {
+		keyResponse, err := a.deviceKeyToResponse(device.Algorithm, key)
 		if err != nil {
 			return GetDeviceResponse{}, err
 		}
+		previousKeys = append(previousKeys, keyResponse)
+	}
 
-		privateKey, err = a.utils.ECCPrivateKeyToString(device.PrivateKey)
-		if err != nil {
-			return GetDeviceResponse{}, err
-		}
-	case "RSA":
-		publicKey, err = a.utils.RSAPublicKeyToString(device.PublicKey)
-		if err != nil {
-			return GetDeviceResponse{}, err
-		}
+	return GetDeviceResponse{
+		ID:                device.ID,
+		Algorithm:         device.Algorithm,
+		Label:             device.Label,
+		KeySize:           device.KeySize,
+		Curve:             device.Curve,
+		Digest:            device.Digest,
+		Padding:           device.Padding,
+		SaltLength:        device.SaltLength,
+		Encoding:          device.Encoding,
+		Deterministic:     device.Deterministic,
+		KeyID:             device.KeyID,
+		PublicKey:         publicKey,
+		PreviousKeys:      previousKeys,
+		SignatureCounter:  device.SignatureCounter,
+		LastSignature:     device.LastSignature,
+		SecuredDataFormat: domain.DeviceSecuredDataFormat(device),
+	}, nil
+}
 
-		privateKey, err = a.utils.RSAPrivateKeyToString(device.PrivateKey)
-		if err != nil {
-			return GetDeviceResponse{}, err
-		}
+// Convert a DeviceKey to DeviceKeyResponse
+func (a *DeviceApi) deviceKeyToResponse(algorithm string, key model.DeviceKey) (DeviceKeyResponse, error) {
+	publicKey, err := a.utils.PublicKeyToString(algorithm, key.PublicKey)
+	if err != nil {
+		return DeviceKeyResponse{}, err
 	}
 
-	return GetDeviceResponse{
-		ID:               device.ID,
-		Algorithm:        device.Algorithm,
-		Label:            device.Label,
-		PublicKey:        publicKey,
-		PrivateKey:       privateKey,
-		SignatureCounter: device.SignatureCounter,
-		LastSignature:    device.LastSignature,
+	return DeviceKeyResponse{
+		ID:           key.ID,
+		PublicKey:    publicKey,
+		FirstCounter: key.FirstCounter,
+		LastCounter:  key.LastCounter,
+		Active:       key.Active,
 	}, nil
 }
 
+// Convert a SignatureRecord to SignatureResponse
+func signatureRecordToResponse(record model.SignatureRecord) SignatureResponse {
+	return SignatureResponse{
+		DeviceID:   record.DeviceID,
+		Counter:    record.Counter,
+		Data:       record.Data,
+		SignedData: record.SignedData,
+		Signature:  record.Signature,
+		Algorithm:  record.Algorithm,
+		KeyID:      record.KeyID,
+		Time:       record.Time,
+	}
+}
+
 // Convert a slice of Devices to a GetAllDevicesResponse
 func (a *DeviceApi) devicesToGetAllDevicesResponse(devices []model.Device) (GetAllDevicesResponse, error) {
 	var deviceResponses []GetDeviceResponse
@@ -293,3 +964,17 @@ func (a *DeviceApi) devicesToGetAllDevicesResponse(devices []model.Device) (GetA
 		Total:   len(deviceResponses),
 	}, nil
 }
+
+// Format a list of values as a human readable alternative, e.g. "'ECC' or 'RSA'"
+func quoteAlternatives(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("'%s'", value)
+	}
+
+	if len(quoted) < 2 {
+		return strings.Join(quoted, "")
+	}
+
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// CreateDevice godoc
+// @Title CreateDevice
+// @Summary Create a new signature device
+// @Description Creates a new signature device with a new key pair, under the ID chosen by the client or a random one. The key parameters and signing options default to the ones of the algorithm, and the secured data format to v1.
+// @Tags Devices v1
+// @Accept json
+// @Produce json
+// @Param device body CreateDeviceRequest true "Device to create"
+// @Success 201 {object} CreateDeviceResponse
+// @Failure 400 {object} ErrorResponse "Invalid input data or unsupported secured data format"
+// @Failure 409 {object} ErrorResponse "A device with the ID already exists"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices [post]
+func (a *DeviceApi) CreateDevice(w http.ResponseWriter, r *http.Request) {
+	var req CreateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid request body"})
+		return
+	}
+
+	// Validate required fields
+	if req.Algorithm == "" {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'algorithm' is required"})
+		return
+	}
+
+	// Validate optional fields
+	if req.KeySize < 0 {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'keySize' must be a positive number of bits"})
+		return
+	}
+	if req.SaltLength < 0 {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Field 'saltLength' must be a positive number of bytes"})
+		return
+	}
+
+	a.createDevice(w, r, req)
+}
+
+// ListDevices godoc
+// @Title ListDevices
+// @Summary List the devices
+// @Description Retrieves all the devices and their details.
+// @Tags Devices v1
+// @Produce json
+// @Success 200 {object} GetAllDevicesResponse "Devices successfully retrieved"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices [get]
+func (a *DeviceApi) ListDevices(w http.ResponseWriter, r *http.Request) {
+	a.GetAllDevices(w, r)
+}
+
+// GetDeviceByID godoc
+// @Title GetDeviceByID
+// @Summary Get a device
+// @Description Retrieves a device by its ID and returns its details.
+// @Tags Devices v1
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} GetDeviceResponse "Device successfully retrieved"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id} [get]
+func (a *DeviceApi) GetDeviceByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.getDevice(w, r, id)
+}
+
+// CreateSignature godoc
+// @Title CreateSignature
+// @Summary Sign a transaction
+// @Description Signs the data with the device, chaining the signature to the previous one of the device.
+// @Tags Devices v1
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param request body SignTransactionRequest true "Data to be signed"
+// @Param Idempotency-Key header string false "Key making retries of the request return the first signature instead of signing again"
+// @Success 201 {object} SignaturedDataResponse "Signature successfully generated"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 409 {object} ErrorResponse "Device signing concurrently"
+// @Failure 422 {object} ErrorResponse "Idempotency key used with different data"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/signatures [post]
+func (a *DeviceApi) CreateSignature(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.signTransaction(w, r, id, http.StatusCreated)
+}
+
+// ListDeviceSignatures godoc
+// @Title ListDeviceSignatures
+// @Summary List the signatures of a device
+// @Description Retrieves a page of the journaled signatures of a device, in the order they were issued.
+// @Tags Devices v1
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param offset query int false "Number of signatures to skip, defaults to 0"
+// @Param limit query int false "Maximum number of signatures to return, defaults to 50 and at most 500"
+// @Success 200 {object} ListSignaturesResponse "Signatures successfully retrieved"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/signatures [get]
+func (a *DeviceApi) ListDeviceSignatures(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.listSignatures(w, r, id)
+}
+
+// GetDeviceSignature godoc
+// @Title GetDeviceSignature
+// @Summary Get a signature of a device
+// @Description Retrieves the journaled signature of a device with the given signature counter.
+// @Tags Devices v1
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param counter path int true "Signature counter"
+// @Success 200 {object} SignatureResponse "Signature successfully retrieved"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device or signature not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/signatures/{counter} [get]
+func (a *DeviceApi) GetDeviceSignature(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.getSignature(w, r, id, r.PathValue("counter"))
+}
+
+// ImportDevice godoc
+// @Title ImportDevice
+// @Summary Import a signature device
+// @Description Creates a signature device from an existing private key, resuming its signature chain from the given counter and last signature. The secured data format defaults to v1.
+// @Tags Devices v1
+// @Accept json
+// @Produce json
+// @Param device body ImportDeviceRequest true "Device to import"
+// @Success 201 {object} GetDeviceResponse
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices:import [post]
+func (a *DeviceApi) ImportDevice(w http.ResponseWriter, r *http.Request) {
+	a.ImportSignatureDevice(w, r)
+}
+
+// CreateKeyExport godoc
+// @Title CreateKeyExport
+// @Summary Export the private key of a device
+// @Description Returns the private key of a device as a password protected PKCS#8 PEM block. Exporting keys must be enabled in the server configuration and every attempt is audited.
+// @Tags Devices v1
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param password body ExportKeyRequest true "Password protecting the exported key"
+// @Success 200 {object} ExportKeyResponse
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 403 {object} ErrorResponse "Key export disabled or not supported by the key store"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/key-exports [post]
+func (a *DeviceApi) CreateKeyExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.exportPrivateKey(w, r, id)
+}
+
+// CreateRotation godoc
+// @Title CreateRotation
+// @Summary Rotate the key of a device
+// @Description Replaces the key pair of a device with a new one. The rotation is signed by the old key as the next record of the signature chain, which the new key then continues. Previous public keys stay available by key ID.
+// @Tags Devices v1
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 201 {object} GetDeviceResponse
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 409 {object} ErrorResponse "Device modified concurrently"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/rotations [post]
+func (a *DeviceApi) CreateRotation(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.rotateDeviceKey(w, r, id, http.StatusCreated)
+}
+
+// GetDeviceKeyByID godoc
+// @Title GetDeviceKeyByID
+// @Summary Get a key of a device
+// @Description Retrieves the current or a previous public key of a device by its key ID, with the signature counters it covers.
+// @Tags Devices v1
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param keyId path string true "Key ID, e.g. <device ID>/1"
+// @Success 200 {object} DeviceKeyResponse "Key successfully retrieved"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device or key not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/keys/{keyId} [get]
+func (a *DeviceApi) GetDeviceKeyByID(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.getDeviceKey(w, r, id, r.PathValue("keyId"))
+}
+
+// CreateVerification godoc
+// @Title CreateVerification
+// @Summary Verify a signature
+// @Description Checks that a signature was issued by the device for the signed data, in the v1 format "<counter>_<data>_<last_signature>" or the v2 format "v2_<counter>_<time>_<algorithm>_<data length>_<data>_<last_signature>", using the key of the device that was active for the counter.
+// @Tags Devices v1
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param request body VerifySignatureRequest true "Signed data and base64 encoded signature"
+// @Success 200 {object} VerifySignatureResponse "Verification result, including the reason an invalid signature was rejected"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/verifications [post]
+func (a *DeviceApi) CreateVerification(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.verifySignature(w, r, id)
+}
+
+// GetDeviceAudit godoc
+// @Title GetDeviceAudit
+// @Summary Audit the signature chain of a device
+// @Description Walks every stored signature of the device and checks that each one verifies, that the counters are contiguous from the start of the chain, that each signature references its predecessor and that the first one is chained to the base64 encoded device ID. Gaps and breaks are reported as issues.
+// @Tags Devices v1
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} ChainAuditResponse "Audit report"
+// @Failure 400 {object} ErrorResponse "Invalid input data"
+// @Failure 404 {object} ErrorResponse "Device not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /v1/devices/{id}/audit [get]
+func (a *DeviceApi) GetDeviceAudit(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathDeviceID(w, r)
+	if !ok {
+		return
+	}
+
+	a.auditSignatureChain(w, r, id)
+}
+
+// Get and validate the device ID of the request path, writing the error response when it is invalid
+func pathDeviceID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		WriteErrorResponse(w, http.StatusBadRequest, []string{"Invalid device ID. Must be a valid UUID"})
+		return uuid.UUID{}, false
+	}
+
+	return id, true
+}
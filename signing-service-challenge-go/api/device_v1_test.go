@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/utils"
+	"github.com/google/uuid"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeviceService v1", func() {
+	var (
+		mockService *domain.MockDeviceService
+		mockUtils   *utils.MockUtils
+		deviceApi   *DeviceApi
+	)
+
+	BeforeEach(func() {
+		mockService = &domain.MockDeviceService{}
+		mockUtils = &utils.MockUtils{}
+		deviceApi = NewDeviceApi(mockService, mockUtils)
+	})
+
+	Describe("CreateDevice", func() {
+		It("should create the device of the request body", func() {
+			mockService.CreateSignatureDeviceFunc = func(ctx context.Context, spec domain.DeviceSpec) (model.Device, error) {
+				Expect(spec.Algorithm).To(Equal("RSA"), "Expected the algorithm of the request body")
+				Expect(spec.KeyParameters.Size).To(Equal(3072), "Expected the key size of the request body")
+				Expect(spec.SignOptions.Padding).To(Equal("PSS"), "Expected the padding of the request body")
+				return model.Device{ID: uuid.New(), Algorithm: spec.Algorithm, Label: spec.Label}, nil
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{"algorithm":"RSA","label":"TestDevice","keySize":3072,"padding":"PSS"}`))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+		})
+
+		It("should require an algorithm", func() {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{"label":"TestDevice"}`))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+			Expect(w.Body.String()).To(ContainSubstring("Field 'algorithm' is required"), "Expected the missing algorithm to be reported")
+		})
+
+		It("should create the device under the client chosen ID", func() {
+			id := uuid.New()
+			mockService.CreateSignatureDeviceFunc = func(ctx context.Context, spec domain.DeviceSpec) (model.Device, error) {
+				Expect(spec.ID).To(Equal(id), "Expected the ID of the request body")
+				Expect(spec.Label).To(BeEmpty(), "Expected the label to be optional")
+				return model.Device{ID: spec.ID, Algorithm: spec.Algorithm}, nil
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(fmt.Sprintf(`{"id":"%s","algorithm":"ECC"}`, id)))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+		})
+
+		It("should reject an ID that is not a UUID", func() {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{"id":"device-1","algorithm":"ECC"}`))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+		})
+
+		It("should return a conflict for a taken ID", func() {
+			mockService.CreateSignatureDeviceFunc = func(ctx context.Context, spec domain.DeviceSpec) (model.Device, error) {
+				return model.Device{}, fmt.Errorf("%w: %s", persistence.ErrDeviceExists, spec.ID)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(fmt.Sprintf(`{"id":"%s","algorithm":"ECC"}`, uuid.New())))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusConflict), "Expected status code 409 Conflict")
+			Expect(w.Body.String()).To(ContainSubstring(ErrorCodeDeviceExists), "Expected the device exists error code")
+		})
+
+		It("should create the device with the requested secured data format", func() {
+			mockService.CreateSignatureDeviceFunc = func(ctx context.Context, spec domain.DeviceSpec) (model.Device, error) {
+				Expect(spec.SecuredDataFormat).To(Equal(domain.SecuredDataFormatV2), "Expected the format of the request body")
+				return model.Device{ID: uuid.New(), Algorithm: spec.Algorithm, SecuredDataFormat: spec.SecuredDataFormat}, nil
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{"algorithm":"ECC","securedDataFormat":"v2"}`))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			Expect(w.Body.String()).To(ContainSubstring(`"securedDataFormat": "v2"`), "Expected the format of the device")
+		})
+
+		It("should reject an unsupported secured data format", func() {
+			mockService.CreateSignatureDeviceFunc = func(ctx context.Context, spec domain.DeviceSpec) (model.Device, error) {
+				return model.Device{}, fmt.Errorf("%w: %s", domain.ErrUnsupportedSecuredDataFormat, spec.SecuredDataFormat)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{"algorithm":"ECC","securedDataFormat":"v9"}`))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+			Expect(w.Body.String()).To(ContainSubstring(ErrorCodeUnsupportedSecuredDataFormat), "Expected the unsupported format error code")
+		})
+
+		It("should reject a negative key size", func() {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices", strings.NewReader(`{"algorithm":"RSA","label":"TestDevice","keySize":-1}`))
+			deviceApi.CreateDevice(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+		})
+	})
+
+	Describe("CreateSignature", func() {
+		It("should sign with the device of the path", func() {
+			id := uuid.New()
+			mockService.SignTransactionFunc = func(ctx context.Context, deviceID uuid.UUID, data string) (model.SignaturedData, error) {
+				Expect(deviceID).To(Equal(id), "Expected the device of the path")
+				return model.SignaturedData{SignedData: "0_" + data + "_last"}, nil
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices/"+id.String()+"/signatures", strings.NewReader(`{"data":"data to sign"}`))
+			r.SetPathValue("id", id.String())
+			deviceApi.CreateSignature(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			Expect(w.Body.String()).To(ContainSubstring("0_data to sign_last"), "Expected the signed data in the response")
+		})
+
+		It("should reject a device ID that is not a UUID", func() {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/devices/device/signatures", strings.NewReader(`{"data":"data to sign"}`))
+			r.SetPathValue("id", "device")
+			deviceApi.CreateSignature(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+		})
+	})
+
+	Describe("ListDeviceSignatures", func() {
+		It("should list the page of signatures of the device of the path", func() {
+			id := uuid.New()
+			mockService.ListSignaturesFunc = func(ctx context.Context, deviceID uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error) {
+				Expect(deviceID).To(Equal(id), "Expected the device of the path")
+				Expect(offset).To(Equal(1), "Expected the offset of the query")
+				Expect(limit).To(Equal(2), "Expected the limit of the query")
+				return []model.SignatureRecord{{DeviceID: id, Counter: 1}, {DeviceID: id, Counter: 2}}, 3, nil
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+id.String()+"/signatures?offset=1&limit=2", nil)
+			r.SetPathValue("id", id.String())
+			deviceApi.ListDeviceSignatures(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			var wrapper struct {
+				Data ListSignaturesResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&wrapper)).To(Succeed(), "Expected to decode response body without error")
+			Expect(wrapper.Data.Signatures).To(HaveLen(2), "Expected the signatures of the page")
+			Expect(wrapper.Data.Total).To(Equal(3), "Expected the total number of signatures")
+		})
+
+		It("should reject a device ID that is not a UUID", func() {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/devices/device/signatures", nil)
+			r.SetPathValue("id", "device")
+			deviceApi.ListDeviceSignatures(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+		})
+	})
+
+	Describe("GetDeviceSignature", func() {
+		It("should return the signature of the device with the counter of the path", func() {
+			id := uuid.New()
+			mockService.GetSignatureFunc = func(ctx context.Context, deviceID uuid.UUID, counter int) (model.SignatureRecord, error) {
+				Expect(deviceID).To(Equal(id), "Expected the device of the path")
+				Expect(counter).To(Equal(7), "Expected the counter of the path")
+				return model.SignatureRecord{DeviceID: id, Counter: 7, KeyID: "key-1"}, nil
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+id.String()+"/signatures/7", nil)
+			r.SetPathValue("id", id.String())
+			r.SetPathValue("counter", "7")
+			deviceApi.GetDeviceSignature(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(w.Body.String()).To(ContainSubstring("key-1"), "Expected the key of the signature")
+		})
+
+		It("should reject a counter that is not a number", func() {
+			id := uuid.New()
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+id.String()+"/signatures/last", nil)
+			r.SetPathValue("id", id.String())
+			r.SetPathValue("counter", "last")
+			deviceApi.GetDeviceSignature(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+		})
+
+		It("should return not found for an unknown signature", func() {
+			mockService.GetSignatureFunc = func(ctx context.Context, deviceID uuid.UUID, counter int) (model.SignatureRecord, error) {
+				return model.SignatureRecord{}, persistence.ErrSignatureNotFound
+			}
+
+			id := uuid.New()
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/devices/"+id.String()+"/signatures/7", nil)
+			r.SetPathValue("id", id.String())
+			r.SetPathValue("counter", "7")
+			deviceApi.GetDeviceSignature(w, r)
+
+			Expect(w.Code).To(Equal(http.StatusNotFound), "Expected status code 404 Not Found")
+		})
+	})
+
+	Describe("Deprecated v0 routes", func() {
+		It("should link every deprecated route to a v1 successor serving the request", func() {
+			server, err := NewServer(":0", Config{KeyExportEnabled: true})
+			Expect(err).To(BeNil(), "Expected the server to be created without error")
+			handler := server.Handler()
+			serve := func(method, target, body string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+				return w
+			}
+
+			created := serve(http.MethodPost, "/api/v1/devices", `{"algorithm":"ED25519","label":"v0 device"}`)
+			Expect(created.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			var device struct {
+				Data CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(created.Body).Decode(&device)).To(Succeed(), "Expected to decode the created device")
+			id := device.Data.ID.String()
+			Expect(serve(http.MethodPost, "/api/v1/devices/"+id+"/signatures", `{"data":"v0 data"}`).Code).To(Equal(http.StatusCreated), "Expected the device to sign")
+
+			_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).To(BeNil(), "Failed to generate the key to import")
+			privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			Expect(err).To(BeNil(), "Failed to marshal the key to import")
+			importBody, _ := json.Marshal(ImportDeviceRequest{
+				Algorithm:  "ED25519",
+				Label:      "imported device",
+				PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})),
+			})
+
+			routes := []struct {
+				method    string
+				target    string
+				body      string
+				successor string
+			}{
+				{http.MethodPost, "/api/v0/device/new-device?algorithm=ED25519&label=v0%20device", `{"algorithm":"ED25519","label":"v0 device"}`, "/api/v1/devices"},
+				{http.MethodPost, "/api/v0/device/import-device", string(importBody), "/api/v1/devices:import"},
+				{http.MethodPost, "/api/v0/device/export-key?deviceId=" + id, `{"password":"correct horse battery"}`, "/api/v1/devices/" + id + "/key-exports"},
+				{http.MethodGet, "/api/v0/device/key?deviceId=" + id + "&keyId=" + device.Data.KeyID, "", "/api/v1/devices/" + id + "/keys/" + device.Data.KeyID},
+				{http.MethodGet, "/api/v0/device/sign?deviceId=" + id, `{"data":"v0 data"}`, "/api/v1/devices/" + id + "/signatures"},
+				{http.MethodPost, "/api/v0/device/verify?deviceId=" + id, `{"signed_data":"0_v0 data_","signature":"c2lnbmF0dXJl"}`, "/api/v1/devices/" + id + "/verifications"},
+				{http.MethodGet, "/api/v0/device/audit?deviceId=" + id, "", "/api/v1/devices/" + id + "/audit"},
+				{http.MethodGet, "/api/v0/device/signatures?deviceId=" + id, "", "/api/v1/devices/" + id + "/signatures"},
+				{http.MethodGet, "/api/v0/device/signature?deviceId=" + id + "&counter=0", "", "/api/v1/devices/" + id + "/signatures/0"},
+				{http.MethodGet, "/api/v0/device/?deviceId=" + id, "", "/api/v1/devices/" + id},
+				{http.MethodGet, "/api/v0/device/all", "", "/api/v1/devices"},
+				{http.MethodPost, "/api/v0/device/rotate-key?deviceId=" + id, "", "/api/v1/devices/" + id + "/rotations"},
+			}
+			for _, route := range routes {
+				deprecated := serve(route.method, route.target, route.body)
+				Expect(deprecated.Code).To(BeNumerically("<", http.StatusMultipleChoices), "Expected %s %s to succeed", route.method, route.target)
+				Expect(deprecated.Header().Get("Deprecation")).To(Equal("true"), "Expected %s to be deprecated", route.target)
+				Expect(deprecated.Header().Get("Link")).To(Equal("<"+route.successor+`>; rel="successor-version"`), "Expected %s to link to its successor", route.target)
+
+				successor := serve(route.method, route.successor, route.body)
+				Expect(successor.Code).To(BeNumerically("<", http.StatusMultipleChoices), "Expected the successor %s %s to serve the request", route.method, route.successor)
+				Expect(successor.Header().Get("Deprecation")).To(BeEmpty(), "Expected the successor %s not to be deprecated", route.successor)
+			}
+		})
+
+		It("should link to the v1 devices without a valid device ID", func() {
+			server, err := NewServer(":0", Config{})
+			Expect(err).To(BeNil(), "Expected the server to be created without error")
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v0/device/audit?deviceId=device", nil))
+
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+			Expect(w.Header().Get("Link")).To(Equal(`</api/v1/devices>; rel="successor-version"`), "Expected a link to the v1 devices")
+		})
+	})
+})
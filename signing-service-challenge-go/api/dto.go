@@ -1,28 +1,63 @@
 package api
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type CreateDeviceResponse struct {
-	ID         uuid.UUID `json:"id"`
-	Algorithm  string    `json:"algorithm"`
-	Label      string    `json:"label"`
-	PublicKey  string    `json:"publicKey"`
-	PrivateKey string    `json:"privateKey"`
+	ID                uuid.UUID `json:"id"`
+	Algorithm         string    `json:"algorithm"`
+	Label             string    `json:"label"`
+	KeySize           int       `json:"keySize"`
+	Curve             string    `json:"curve,omitempty"`
+	Digest            string    `json:"digest"`
+	Padding           string    `json:"padding,omitempty"`
+	SaltLength        int       `json:"saltLength,omitempty"`
+	Encoding          string    `json:"encoding,omitempty"`
+	Deterministic     bool      `json:"deterministic,omitempty"`
+	KeyID             string    `json:"keyId"`
+	PublicKey         string    `json:"publicKey"`
+	SecuredDataFormat string    `json:"securedDataFormat"`
 }
 
+// SignaturedDataResponse reports the digest and, for ECC devices, the encoding of the signature:
+// ASN1 for a DER encoded signature or P1363 for the raw r||s values padded to the curve size
 type SignaturedDataResponse struct {
 	Signature  []byte `json:"signature"`
 	SignedData string `json:"signed_data"`
+	Digest     string `json:"digest"`
+	Encoding   string `json:"encoding,omitempty"`
 }
 
 type GetDeviceResponse struct {
-	ID               uuid.UUID `json:"id"`
-	Algorithm        string    `json:"algorithm"`
-	Label            string    `json:"label"`
-	PublicKey        string    `json:"publicKey"`
-	PrivateKey       string    `json:"privateKey"`
-	SignatureCounter int       `json:"signatureCounter"`
-	LastSignature    string    `json:"lastSignature,omitempty"`
+	ID                uuid.UUID           `json:"id"`
+	Algorithm         string              `json:"algorithm"`
+	Label             string              `json:"label"`
+	KeySize           int                 `json:"keySize"`
+	Curve             string              `json:"curve,omitempty"`
+	Digest            string              `json:"digest"`
+	Padding           string              `json:"padding,omitempty"`
+	SaltLength        int                 `json:"saltLength,omitempty"`
+	Encoding          string              `json:"encoding,omitempty"`
+	Deterministic     bool                `json:"deterministic,omitempty"`
+	KeyID             string              `json:"keyId"`
+	PublicKey         string              `json:"publicKey"`
+	PreviousKeys      []DeviceKeyResponse `json:"previousKeys,omitempty"`
+	SignatureCounter  int                 `json:"signatureCounter"`
+	LastSignature     string              `json:"lastSignature,omitempty"`
+	SecuredDataFormat string              `json:"securedDataFormat"`
+}
+
+// DeviceKeyResponse describes a current or previous key of a device and the signature counters it covers.
+// For the active key LastCounter is the counter of the latest signature, or one less than FirstCounter if it has none.
+type DeviceKeyResponse struct {
+	ID           string `json:"id"`
+	PublicKey    string `json:"publicKey"`
+	FirstCounter int    `json:"firstCounter"`
+	LastCounter  int    `json:"lastCounter"`
+	Active       bool   `json:"active"`
 }
 
 // GetAllDevicesResponse created for possible future use of pagination
@@ -31,6 +66,114 @@ type GetAllDevicesResponse struct {
 	Total   int                 `json:"total"`
 }
 
+// ImportDeviceRequest creates a device from an existing PEM encoded private key (SEC 1, PKCS#1 or PKCS#8).
+// SignatureCounter and LastSignature continue the signature chain of the device in the previous system.
+// SecuredDataFormat is the version of the format of the data the device signs, v1 unless another one is chosen.
+type ImportDeviceRequest struct {
+	Algorithm         string `json:"algorithm"`
+	Label             string `json:"label"`
+	PrivateKey        string `json:"privateKey"`
+	SignatureCounter  int    `json:"signatureCounter"`
+	LastSignature     string `json:"lastSignature,omitempty"`
+	Digest            string `json:"digest,omitempty"`
+	Padding           string `json:"padding,omitempty"`
+	SaltLength        int    `json:"saltLength,omitempty"`
+	Encoding          string `json:"encoding,omitempty"`
+	Deterministic     bool   `json:"deterministic,omitempty"`
+	SecuredDataFormat string `json:"securedDataFormat,omitempty"`
+}
+
+// ExportKeyRequest holds the password protecting the exported private key
+type ExportKeyRequest struct {
+	Password string `json:"password"`
+}
+
+// ExportKeyResponse holds a private key encrypted as PKCS#8 with PBES2 (PBKDF2-HMAC-SHA256 and AES-256-CBC)
+type ExportKeyResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Algorithm  string    `json:"algorithm"`
+	PrivateKey string    `json:"privateKey"`
+}
+
+// SignatureResponse is a journaled signature of a device: the raw data as requested, the secured data that was
+// signed and the signature, with the algorithm and the key of the device that produced it
+type SignatureResponse struct {
+	DeviceID   uuid.UUID `json:"deviceId"`
+	Counter    int       `json:"counter"`
+	Data       string    `json:"data"`
+	SignedData string    `json:"signed_data"`
+	Signature  []byte    `json:"signature"`
+	Algorithm  string    `json:"algorithm"`
+	KeyID      string    `json:"keyId"`
+	Time       time.Time `json:"time"`
+}
+
+// ListSignaturesResponse is a page of the journaled signatures of a device, in the order they were issued.
+// Total is the number of signatures in the journal.
+type ListSignaturesResponse struct {
+	Signatures []SignatureResponse `json:"signatures"`
+	Offset     int                 `json:"offset"`
+	Limit      int                 `json:"limit"`
+	Total      int                 `json:"total"`
+}
+
+// CreateDeviceRequest creates a device with a new key pair, under the client chosen ID when there is one.
+// The key parameters and signing options default to the ones of the algorithm, and the secured data format to v1.
+// The v2 format length-prefixes the data, so data containing underscores cannot be confused with the other fields.
+type CreateDeviceRequest struct {
+	ID                string `json:"id,omitempty"`
+	Algorithm         string `json:"algorithm"`
+	Label             string `json:"label,omitempty"`
+	KeySize           int    `json:"keySize,omitempty"`
+	Curve             string `json:"curve,omitempty"`
+	Digest            string `json:"digest,omitempty"`
+	Padding           string `json:"padding,omitempty"`
+	SaltLength        int    `json:"saltLength,omitempty"`
+	Encoding          string `json:"encoding,omitempty"`
+	Deterministic     bool   `json:"deterministic,omitempty"`
+	SecuredDataFormat string `json:"securedDataFormat,omitempty"`
+}
+
 type SignTransactionRequest struct {
 	Data string `json:"data"`
 }
+
+// VerifySignatureRequest holds signed data as returned when signing and its base64 encoded signature
+type VerifySignatureRequest struct {
+	SignedData string `json:"signed_data"`
+	Signature  string `json:"signature"`
+}
+
+// VerifySignatureResponse reports whether a signature is valid, the parts of its signed data and the key it was
+// checked with. Reason explains why an invalid signature was rejected. Format is the version of the format of the
+// signed data, and Time and Algorithm are only reported by the formats carrying them.
+type VerifySignatureResponse struct {
+	Valid         bool      `json:"valid"`
+	Reason        string    `json:"reason,omitempty"`
+	KeyID         string    `json:"keyId,omitempty"`
+	Counter       int       `json:"counter"`
+	Data          string    `json:"data"`
+	LastSignature string    `json:"lastSignature"`
+	Format        string    `json:"format,omitempty"`
+	Time          time.Time `json:"time,omitzero"`
+	Algorithm     string    `json:"algorithm,omitempty"`
+}
+
+// ChainAuditResponse reports whether the signature chain of a device is intact, from the first counter it starts with
+// (0, or the counter an imported device continued from) up to its signature counter, and the issues found otherwise
+type ChainAuditResponse struct {
+	DeviceID         uuid.UUID            `json:"deviceId"`
+	Intact           bool                 `json:"intact"`
+	FirstCounter     int                  `json:"firstCounter"`
+	SignatureCounter int                  `json:"signatureCounter"`
+	Records          int                  `json:"records"`
+	Issues           []ChainIssueResponse `json:"issues"`
+}
+
+// ChainIssueResponse is a gap or break of a signature chain: gap, out-of-order, malformed, invalid-genesis,
+// broken-link or invalid-signature
+type ChainIssueResponse struct {
+	Kind    string `json:"kind"`
+	Counter int    `json:"counter"`
+	Detail  string `json:"detail"`
+}
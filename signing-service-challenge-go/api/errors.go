@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+)
+
+// Machine-readable codes of the ErrorResponse for the errors of the service.
+// Other error responses have the snake cased text of their HTTP status as code, e.g. "bad_request".
+const (
+	ErrorCodeDeviceNotFound               = "device_not_found"
+	ErrorCodeDeviceExists                 = "device_exists"
+	ErrorCodeSignatureNotFound            = "signature_not_found"
+	ErrorCodeKeyNotFound                  = "key_not_found"
+	ErrorCodeUnsupportedAlgorithm         = "unsupported_algorithm"
+	ErrorCodeUnsupportedSecuredDataFormat = "unsupported_secured_data_format"
+	ErrorCodeInvalidKeyParameters         = "invalid_key_parameters"
+	ErrorCodeInvalidSignOptions           = "invalid_sign_options"
+	ErrorCodeInvalidPrivateKey            = "invalid_private_key"
+	ErrorCodeInvalidChainState            = "invalid_chain_state"
+	ErrorCodeWeakExportPassword           = "weak_export_password"
+	ErrorCodeKeyExportDisabled            = "key_export_disabled"
+	ErrorCodeKeyNotExportable             = "key_not_exportable"
+	ErrorCodeConflict                     = "conflict"
+	ErrorCodeIdempotencyKeyReused         = "idempotency_key_reused"
+	ErrorCodeKeyFailure                   = "key_failure"
+	ErrorCodeInternal                     = "internal_server_error"
+)
+
+// serviceError maps the errors matching err to an HTTP status and an error code.
+// When set, message replaces the error message in the response.
+type serviceError struct {
+	err     error
+	status  int
+	code    string
+	message string
+}
+
+// The errors of the service, in the order they are matched, so client errors wrapped
+// in a key failure are reported as such
+var serviceErrors = []serviceError{
+	{err: persistence.ErrDeviceNotFound, status: http.StatusNotFound, code: ErrorCodeDeviceNotFound, message: "Device not found"},
+	{err: persistence.ErrSignatureNotFound, status: http.StatusNotFound, code: ErrorCodeSignatureNotFound, message: "Signature not found"},
+	{err: domain.ErrKeyNotFound, status: http.StatusNotFound, code: ErrorCodeKeyNotFound, message: "Key not found"},
+	{err: crypto.ErrUnsupportedAlgorithm, status: http.StatusBadRequest, code: ErrorCodeUnsupportedAlgorithm},
+	{err: domain.ErrUnsupportedSecuredDataFormat, status: http.StatusBadRequest, code: ErrorCodeUnsupportedSecuredDataFormat},
+	{err: crypto.ErrInvalidKeyParameters, status: http.StatusBadRequest, code: ErrorCodeInvalidKeyParameters},
+	{err: crypto.ErrInvalidSignOptions, status: http.StatusBadRequest, code: ErrorCodeInvalidSignOptions},
+	{err: crypto.ErrInvalidPrivateKey, status: http.StatusBadRequest, code: ErrorCodeInvalidPrivateKey},
+	{err: domain.ErrInvalidChainState, status: http.StatusBadRequest, code: ErrorCodeInvalidChainState},
+	{err: domain.ErrWeakExportPassword, status: http.StatusBadRequest, code: ErrorCodeWeakExportPassword},
+	{err: domain.ErrKeyExportDisabled, status: http.StatusForbidden, code: ErrorCodeKeyExportDisabled},
+	{err: crypto.ErrKeyNotExportable, status: http.StatusForbidden, code: ErrorCodeKeyNotExportable},
+	{err: persistence.ErrDeviceExists, status: http.StatusConflict, code: ErrorCodeDeviceExists},
+	{err: persistence.ErrConflict, status: http.StatusConflict, code: ErrorCodeConflict, message: "The device was modified concurrently, retry the request"},
+	{err: domain.ErrIdempotencyKeyReused, status: http.StatusUnprocessableEntity, code: ErrorCodeIdempotencyKeyReused},
+	{err: domain.ErrKeyFailure, status: http.StatusInternalServerError, code: ErrorCodeKeyFailure},
+}
+
+// WriteServiceError writes the error returned by the service as an HTTP error response,
+// with the status and code it maps to. Unknown errors are internal errors described by the message.
+func WriteServiceError(w http.ResponseWriter, err error, message string) {
+	for _, serviceError := range serviceErrors {
+		if !errors.Is(err, serviceError.err) {
+			continue
+		}
+
+		errs := []string{err.Error()}
+		if serviceError.message != "" {
+			errs = []string{serviceError.message}
+		} else if serviceError.status == http.StatusInternalServerError {
+			errs = []string{message, err.Error()}
+		}
+		writeErrorResponse(w, serviceError.status, serviceError.code, errs)
+		return
+	}
+
+	writeErrorResponse(w, http.StatusInternalServerError, ErrorCodeInternal, []string{message, err.Error()})
+}
+
+// Get the default error code of an HTTP status, e.g. "not_found"
+func statusErrorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
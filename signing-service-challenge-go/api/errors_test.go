@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	// Write the error and decode the response
+	writeServiceError := func(err error) (int, ErrorResponse) {
+		w := httptest.NewRecorder()
+		WriteServiceError(w, err, "Failed to handle request")
+
+		var errorResponse ErrorResponse
+		Expect(json.Unmarshal(w.Body.Bytes(), &errorResponse)).To(Succeed(), "Failed to unmarshal the error response")
+		return w.Code, errorResponse
+	}
+
+	Describe("WriteServiceError", func() {
+		DescribeTable("should map the errors of the service to a status and a code",
+			func(err error, status int, code string) {
+				writtenStatus, errorResponse := writeServiceError(err)
+				Expect(writtenStatus).To(Equal(status), "Unexpected status code for %v", err)
+				Expect(errorResponse.Code).To(Equal(code), "Unexpected error code for %v", err)
+			},
+			Entry("missing device", persistence.ErrDeviceNotFound, http.StatusNotFound, ErrorCodeDeviceNotFound),
+			Entry("missing signature", persistence.ErrSignatureNotFound, http.StatusNotFound, ErrorCodeSignatureNotFound),
+			Entry("missing key", fmt.Errorf("%w: key-2", domain.ErrKeyNotFound), http.StatusNotFound, ErrorCodeKeyNotFound),
+			Entry("unsupported algorithm", fmt.Errorf("%w: DSA", crypto.ErrUnsupportedAlgorithm), http.StatusBadRequest, ErrorCodeUnsupportedAlgorithm),
+			Entry("unsupported secured data format", fmt.Errorf("%w: v9", domain.ErrUnsupportedSecuredDataFormat), http.StatusBadRequest, ErrorCodeUnsupportedSecuredDataFormat),
+			Entry("invalid chain state", domain.ErrInvalidChainState, http.StatusBadRequest, ErrorCodeInvalidChainState),
+			Entry("disabled key export", domain.ErrKeyExportDisabled, http.StatusForbidden, ErrorCodeKeyExportDisabled),
+			Entry("conflict", fmt.Errorf("failed to update device: %w", &persistence.ConflictError{}), http.StatusConflict, ErrorCodeConflict),
+			Entry("key failure", &domain.KeyError{Op: "sign data", Err: errors.New("token unavailable")}, http.StatusInternalServerError, ErrorCodeKeyFailure),
+			Entry("unknown error", errors.New("disk full"), http.StatusInternalServerError, ErrorCodeInternal),
+		)
+
+		It("should report client errors wrapped in a key failure as such", func() {
+			err := &domain.KeyError{Op: "generate key pair", Err: fmt.Errorf("%w: RSA keys must be at least 2048 bits", crypto.ErrInvalidKeyParameters)}
+			status, errorResponse := writeServiceError(err)
+			Expect(status).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+			Expect(errorResponse.Code).To(Equal(ErrorCodeInvalidKeyParameters), "Expected the invalid key parameters code")
+		})
+
+		It("should describe internal errors with the message", func() {
+			_, errorResponse := writeServiceError(errors.New("disk full"))
+			Expect(errorResponse.Errors).To(Equal([]string{"Failed to handle request", "disk full"}), "Expected the message and the cause")
+		})
+	})
+
+	Describe("WriteErrorResponse", func() {
+		It("should derive the code from the status", func() {
+			w := httptest.NewRecorder()
+			WriteErrorResponse(w, http.StatusBadRequest, []string{"deviceId is required"})
+
+			var errorResponse ErrorResponse
+			Expect(json.Unmarshal(w.Body.Bytes(), &errorResponse)).To(Succeed(), "Failed to unmarshal the error response")
+			Expect(errorResponse.Code).To(Equal("bad_request"), "Expected the code of the status")
+		})
+	})
+})
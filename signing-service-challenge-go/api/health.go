@@ -17,7 +17,7 @@ type HealthResponse struct {
 // @Produce json
 // @Success 200 {object} HealthResponse "Service is healthy"
 // @Failure 405 {object} ErrorResponse "Method not allowed"
-// @Router /health [get]
+// @Router /v0/health [get]
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
 		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
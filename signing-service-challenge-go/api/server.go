@@ -1,13 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/utils"
+	"github.com/google/uuid"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
@@ -18,40 +27,162 @@ type Response struct {
 
 // ErrorResponse is the generic error API response container.
 type ErrorResponse struct {
+	// Code is a stable machine-readable identifier of the error, e.g. "device_not_found"
+	Code   string   `json:"code"`
 	Errors []string `json:"errors"`
 }
 
+// ErrMissingMasterKeys is returned by NewServer when the devices are stored durably by the software key store
+// without master keys, which would wrap their private keys with an ephemeral master key lost on restart.
+var ErrMissingMasterKeys = errors.New("master keys are required to store the devices in a database")
+
+// DevicesV1Path is the collection of the devices in the v1 API, replacing the deprecated v0 device routes.
+const DevicesV1Path = "/api/v1/devices"
+
+// FileDatabaseDriver is the DatabaseDriver storing the devices in a write-ahead log, in the directory of the DSN.
+const FileDatabaseDriver = "file"
+
+// Config holds the configurable parameters of the Server.
+type Config struct {
+	// Algorithms are the signature algorithms the devices can be created with.
+	// When none are configured crypto.DefaultRegistry is used.
+	Algorithms *crypto.Registry
+	KeyPolicy  crypto.KeyPolicy
+	// KeyExportEnabled allows exporting the private keys of the devices as encrypted PKCS#8
+	KeyExportEnabled bool
+	// MasterKeys wrap the private keys of the devices at rest, the first one is used to wrap new keys.
+	// They are required with a DatabaseDriver unless a KeyStore is configured, otherwise an ephemeral
+	// master key is generated for the devices kept in memory.
+	MasterKeys []crypto.MasterKey
+	// KeyStore holds the private keys of the devices, e.g. a PKCS11KeyStore backed by an HSM.
+	// When none is configured the keys are kept by a software key store wrapping them with the master keys.
+	KeyStore crypto.KeyStore
+	// DatabaseDriver and DatabaseDSN select the database storing the devices, their signatures and the audit log,
+	// e.g. "sqlite" and "file:devices.db", or "file" and the directory of a write-ahead log.
+	// When no driver is configured they are kept in memory.
+	DatabaseDriver string
+	DatabaseDSN    string
+	// IdempotencyRetention is how long the Idempotency-Key of a signing request is remembered per device.
+	// When none is configured domain.DefaultIdempotencyRetention is used.
+	IdempotencyRetention time.Duration
+}
+
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
 	listenAddress string
 	api           *DeviceApi
 	service       *domain.DeviceService
-	repo          *persistence.DeviceRepository
+	repo          persistence.DeviceRepoInterface
+	audit         persistence.AuditRepoInterface
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string) *Server {
-	// Initialize persistence layer
-	repo := persistence.NewDeviceRepository()
+func NewServer(listenAddress string, config Config) (*Server, error) {
+	algorithms := config.Algorithms
+	if algorithms == nil {
+		algorithms = crypto.DefaultRegistry
+	}
 
-	// Initialize utils
-	utils := utils.RealUtils{}
+	// Refuse to store the devices durably with keys that cannot be unwrapped after a restart
+	if config.DatabaseDriver != "" && config.KeyStore == nil && len(config.MasterKeys) == 0 {
+		return nil, fmt.Errorf("%w: configure master keys for the %q database driver", ErrMissingMasterKeys, config.DatabaseDriver)
+	}
+
+	// Initialize persistence layer, keeping the audit log next to the devices
+	var (
+		repo  persistence.DeviceRepoInterface
+		audit persistence.AuditRepoInterface
+	)
+	switch config.DatabaseDriver {
+	case "":
+		repo = persistence.NewDeviceRepository()
+		audit = persistence.NewAuditRepository()
+	case FileDatabaseDriver:
+		fileRepo, err := persistence.NewFileDeviceRepository(config.DatabaseDSN, algorithms, 0)
+		if err != nil {
+			return nil, err
+		}
+		repo = fileRepo
+		audit = persistence.NewFileAuditRepository(fileRepo)
+	default:
+		db, dialect, err := persistence.OpenDatabase(config.DatabaseDriver, config.DatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		sqlRepo, err := persistence.NewSQLDeviceRepository(db, dialect, algorithms)
+		if err != nil {
+			return nil, err
+		}
+		repo = sqlRepo
+		audit = persistence.NewSQLAuditRepository(sqlRepo)
+	}
+
+	// Initialize the key store, wrapping the keys with the configured master keys unless one is provided
+	keyStore := config.KeyStore
+	if keyStore == nil {
+		keyWrapper := crypto.NewEphemeralKeyWrapper()
+		if len(config.MasterKeys) > 0 {
+			var err error
+			keyWrapper, err = crypto.NewKeyWrapper(config.MasterKeys[0], config.MasterKeys[1:]...)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			log.Printf("No master key configured, the private keys of the in-memory devices are wrapped with the ephemeral master key %s", keyWrapper.ActiveKeyID())
+		}
+		keyStore = crypto.NewSoftwareKeyStore(algorithms, keyWrapper)
+	}
+
+	// Initialize utils with the algorithms of the service
+	utils := utils.NewRealUtils(algorithms)
 
 	// Initialize user service
-	service := domain.NewDeviceService(repo, &utils, nil)
+	options := []domain.Option{
+		domain.WithKeyPolicy(config.KeyPolicy),
+		domain.WithKeyExport(config.KeyExportEnabled),
+		domain.WithAuditLog(audit),
+		domain.WithKeyStore(keyStore),
+	}
+	if config.IdempotencyRetention > 0 {
+		options = append(options, domain.WithIdempotencyRetention(config.IdempotencyRetention))
+	}
+	service := domain.NewDeviceService(repo, utils, algorithms, options...)
+
+	// Releasing the counters left reserved by signatures that were interrupted, e.g. by a crash of a previous run
+	recovered, err := service.RecoverReservations(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, reservation := range recovered {
+		log.Printf("Released counter %d of device %s, reserved by an interrupted signature", reservation.Expected.SignatureCounter, reservation.DeviceID)
+	}
 
 	// Initialize device API
-	api := NewDeviceApi(service, &utils)
+	api := NewDeviceApi(service, utils)
 	return &Server{
 		listenAddress: listenAddress,
 		api:           api,
 		service:       service,
 		repo:          repo,
-	}
+		audit:         audit,
+	}, nil
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
+// RewrapPrivateKeys wraps the private keys of all the stored devices with the active master key, the first one
+// of Config.MasterKeys, so the previous master keys can be removed from the configuration afterwards.
+// It returns the number of rewrapped keys.
+func (s *Server) RewrapPrivateKeys(ctx context.Context) (int, error) {
+	return s.service.RewrapPrivateKeys(ctx)
+}
+
+// Run starts the Server with the handler of its HTTP routes.
 func (s *Server) Run() error {
+	log.Printf("Server running at %s", s.listenAddress)
+	return http.ListenAndServe(s.listenAddress, s.Handler())
+}
+
+// Handler registers all HandlerFuncs for the existing HTTP routes.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Initialize health service
@@ -60,18 +191,86 @@ func (s *Server) Run() error {
 	// Initialize Swagger documentation
 	mux.Handle("/swagger/", httpSwagger.WrapHandler)
 
-	// Create a subrouter for device-related routes
+	// Create a subrouter for the deprecated device-related routes
 	deviceMux := http.NewServeMux()
-	deviceMux.Handle("POST /new-device", http.HandlerFunc(s.api.CreateSignatureDevice))
-	deviceMux.Handle("GET /sign", http.HandlerFunc(s.api.SignTransaction))
-	deviceMux.Handle("GET /", http.HandlerFunc(s.api.GetDevice))
-	deviceMux.Handle("GET /all", http.HandlerFunc(s.api.GetAllDevices))
+	deviceMux.Handle("POST /new-device", deprecated(s.api.CreateSignatureDevice, DevicesV1Path))
+	deviceMux.Handle("POST /import-device", deprecated(s.api.ImportSignatureDevice, DevicesV1Path+":import"))
+	deviceMux.Handle("POST /export-key", deprecatedFunc(s.api.ExportPrivateKey, deviceV1Path("/key-exports")))
+	deviceMux.Handle("POST /rotate-key", deprecatedFunc(s.api.RotateDeviceKey, deviceV1Path("/rotations")))
+	deviceMux.Handle("GET /key", deprecatedFunc(s.api.GetDeviceKey, deviceV1Path("/keys/{keyId}")))
+	deviceMux.Handle("GET /sign", deprecatedFunc(s.api.SignTransaction, deviceV1Path("/signatures")))
+	deviceMux.Handle("POST /verify", deprecatedFunc(s.api.VerifySignature, deviceV1Path("/verifications")))
+	deviceMux.Handle("GET /audit", deprecatedFunc(s.api.AuditSignatureChain, deviceV1Path("/audit")))
+	deviceMux.Handle("GET /signatures", deprecatedFunc(s.api.ListSignatures, deviceV1Path("/signatures")))
+	deviceMux.Handle("GET /signature", deprecatedFunc(s.api.GetSignature, deviceV1Path("/signatures/{counter}")))
+	deviceMux.Handle("GET /", deprecatedFunc(s.api.GetDevice, deviceV1Path("")))
+	deviceMux.Handle("GET /all", deprecated(s.api.GetAllDevices, DevicesV1Path))
 
 	// Add the device prefix
 	mux.Handle("/api/v0/device/", http.StripPrefix("/api/v0/device", deviceMux))
 
-	log.Printf("Server running at %s", s.listenAddress)
-	return http.ListenAndServe(s.listenAddress, mux)
+	// Register the resource-oriented device routes
+	mux.Handle("POST "+DevicesV1Path, http.HandlerFunc(s.api.CreateDevice))
+	mux.Handle("GET "+DevicesV1Path, http.HandlerFunc(s.api.ListDevices))
+	mux.Handle("GET "+DevicesV1Path+"/{id}", http.HandlerFunc(s.api.GetDeviceByID))
+	mux.Handle("POST "+DevicesV1Path+"/{id}/signatures", http.HandlerFunc(s.api.CreateSignature))
+	mux.Handle("GET "+DevicesV1Path+"/{id}/signatures", http.HandlerFunc(s.api.ListDeviceSignatures))
+	mux.Handle("GET "+DevicesV1Path+"/{id}/signatures/{counter}", http.HandlerFunc(s.api.GetDeviceSignature))
+	mux.Handle("POST "+DevicesV1Path+"/{id}/verifications", http.HandlerFunc(s.api.CreateVerification))
+	mux.Handle("GET "+DevicesV1Path+"/{id}/audit", http.HandlerFunc(s.api.GetDeviceAudit))
+	mux.Handle("POST "+DevicesV1Path+"/{id}/rotations", http.HandlerFunc(s.api.CreateRotation))
+	mux.Handle("GET "+DevicesV1Path+"/{id}/keys/{keyId...}", http.HandlerFunc(s.api.GetDeviceKeyByID))
+	mux.Handle("POST "+DevicesV1Path+"/{id}/key-exports", http.HandlerFunc(s.api.CreateKeyExport))
+	mux.Handle("POST "+DevicesV1Path+":import", http.HandlerFunc(s.api.ImportDevice))
+
+	return mux
+}
+
+// Mark the responses of a deprecated route with the Deprecation header, and with a Link header
+// to its successor route
+func deprecated(handler http.HandlerFunc, successor string) http.Handler {
+	return deprecatedFunc(handler, func(*http.Request) string { return successor })
+}
+
+// Mark the responses of a deprecated route like deprecated, with the successor route depending on the request
+func deprecatedFunc(handler http.HandlerFunc, successor func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor(r)))
+		handler(w, r)
+	})
+}
+
+// Get the v1 route of the device of the deviceId query parameter followed by the route, whose {counter}
+// and {keyId} segments are filled in from the query parameters of the same name, keeping the slash of the
+// key IDs. It falls back to the v1 route of the device when such a parameter is invalid, and to the v1
+// devices without a valid device ID
+func deviceV1Path(route string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		query := r.URL.Query()
+		id, err := uuid.Parse(query.Get("deviceId"))
+		if err != nil {
+			return DevicesV1Path
+		}
+
+		path := DevicesV1Path + "/" + id.String()
+		if strings.Contains(route, "{counter}") {
+			counter, err := strconv.ParseUint(query.Get("counter"), 10, 64)
+			if err != nil {
+				return path
+			}
+			route = strings.ReplaceAll(route, "{counter}", strconv.FormatUint(counter, 10))
+		}
+		if strings.Contains(route, "{keyId}") {
+			keyID := query.Get("keyId")
+			if keyID == "" {
+				return path
+			}
+			route = strings.ReplaceAll(route, "{keyId}", (&url.URL{Path: keyID}).EscapedPath())
+		}
+
+		return path + route
+	}
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -86,9 +285,15 @@ func WriteInternalError(w http.ResponseWriter) {
 // WriteErrorResponse takes an HTTP status code and a slice of errors
 // and writes those as an HTTP error response in a structured format.
 func WriteErrorResponse(w http.ResponseWriter, code int, errors []string) {
-	w.WriteHeader(code)
+	writeErrorResponse(w, code, statusErrorCode(code), errors)
+}
+
+// Write the errors as an HTTP error response with the status and the error code
+func writeErrorResponse(w http.ResponseWriter, status int, code string, errors []string) {
+	w.WriteHeader(status)
 
 	errorResponse := ErrorResponse{
+		Code:   code,
 		Errors: errors,
 	}
 
@@ -0,0 +1,163 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	AlgorithmECC     = "ECC"
+	AlgorithmRSA     = "RSA"
+	AlgorithmED25519 = "ED25519"
+)
+
+// KeyGenerator generates the key pair used by an algorithm.
+// ResolveParameters validates the requested parameters and fills in the defaults of the algorithm.
+type KeyGenerator interface {
+	ResolveParameters(requested KeyParameters) (KeyParameters, error)
+	GenerateKeyPair(params KeyParameters) (publicKey, privateKey any, err error)
+}
+
+// VerifierInterface checks a signature against the public key that should have produced it.
+type VerifierInterface interface {
+	Verify(data string, signature []byte, publicKey any, opts SignOptions) error
+}
+
+// ErrUnsupportedAlgorithm is returned when no algorithm is registered with the requested name.
+var ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+
+// ErrInvalidPrivateKey is returned when a private key cannot be decoded or does not belong to the algorithm.
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
+// ErrInvalidPublicKey is returned when a public key cannot be decoded or does not belong to the algorithm.
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
+// KeyCodec converts the keys of an algorithm from and to their PEM representation.
+// KeyParameters describes an existing public key, e.g. one decoded from an imported private key.
+type KeyCodec interface {
+	EncodePublicKey(publicKey any) (string, error)
+	DecodePublicKey(publicKeyBytes []byte) (any, error)
+	EncodePrivateKey(privateKey any) (string, error)
+	DecodePrivateKey(privateKeyBytes []byte) (publicKey, privateKey any, err error)
+	KeyParameters(publicKey any) (KeyParameters, error)
+}
+
+// Parse the PKIX public key of a PEM block, whatever its PEM type
+func parsePublicKeyPEM(publicKeyBytes []byte) (any, error) {
+	block, _ := pem.Decode(publicKeyBytes)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidPublicKey)
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+
+	return publicKey, nil
+}
+
+// Algorithm groups everything needed to work with a signature algorithm.
+type Algorithm struct {
+	Name      string
+	Generator KeyGenerator
+	Signer    SignerInterface
+	Verifier  VerifierInterface
+	Codec     KeyCodec
+}
+
+// NewECCAlgorithm returns the ECDSA algorithm.
+func NewECCAlgorithm() Algorithm {
+	signer := NewECCSigner()
+	return Algorithm{
+		Name:      AlgorithmECC,
+		Generator: &ECCGenerator{},
+		Signer:    signer,
+		Verifier:  signer,
+		Codec:     NewECCCodec(),
+	}
+}
+
+// NewRSAAlgorithm returns the RSA algorithm.
+func NewRSAAlgorithm() Algorithm {
+	signer := NewRSASigner()
+	return Algorithm{
+		Name:      AlgorithmRSA,
+		Generator: &RSAGenerator{},
+		Signer:    signer,
+		Verifier:  signer,
+		Codec:     NewRSACodec(),
+	}
+}
+
+// NewED25519Algorithm returns the Ed25519 algorithm.
+func NewED25519Algorithm() Algorithm {
+	signer := NewED25519Signer()
+	return Algorithm{
+		Name:      AlgorithmED25519,
+		Generator: &ED25519Generator{},
+		Signer:    signer,
+		Verifier:  signer,
+		Codec:     NewED25519Codec(),
+	}
+}
+
+// Registry holds the supported algorithms indexed by name.
+type Registry struct {
+	algorithms map[string]Algorithm
+	mu         sync.RWMutex
+}
+
+// DefaultRegistry contains every algorithm supported by the service.
+var DefaultRegistry = NewRegistry(NewECCAlgorithm(), NewRSAAlgorithm(), NewED25519Algorithm())
+
+// NewRegistry creates a registry with the given algorithms.
+func NewRegistry(algorithms ...Algorithm) *Registry {
+	r := &Registry{
+		algorithms: make(map[string]Algorithm),
+	}
+	for _, algorithm := range algorithms {
+		r.Register(algorithm)
+	}
+
+	return r
+}
+
+// Register adds an algorithm to the registry, replacing any algorithm with the same name
+func (r *Registry) Register(algorithm Algorithm) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.algorithms[algorithm.Name] = algorithm
+}
+
+// Get retrieves an algorithm by its name
+func (r *Registry) Get(name string) (Algorithm, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	algorithm, exists := r.algorithms[name]
+	if !exists {
+		return Algorithm{}, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, name)
+	}
+
+	return algorithm, nil
+}
+
+// Names returns the names of the registered algorithms sorted alphabetically
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.algorithms))
+	for name := range r.algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var (
+		registry *Registry
+	)
+
+	BeforeEach(func() {
+		registry = NewRegistry(NewECCAlgorithm(), NewRSAAlgorithm())
+	})
+
+	Describe("Get", func() {
+		Context("when the algorithm is registered", func() {
+			It("should return the algorithm", func() {
+				algorithm, err := registry.Get("ECC")
+				Expect(err).To(BeNil(), "Failed to get a registered algorithm")
+				Expect(algorithm.Name).To(Equal("ECC"), "The algorithm name should match the requested one")
+				Expect(algorithm.Generator).ToNot(BeNil(), "The algorithm should provide a key generator")
+				Expect(algorithm.Signer).ToNot(BeNil(), "The algorithm should provide a signer")
+				Expect(algorithm.Verifier).ToNot(BeNil(), "The algorithm should provide a verifier")
+				Expect(algorithm.Codec).ToNot(BeNil(), "The algorithm should provide a key codec")
+			})
+		})
+
+		Context("when the algorithm is not registered", func() {
+			It("should return an error", func() {
+				_, err := registry.Get("DSA")
+				Expect(err).To(HaveOccurred(), "Expected an error for an unknown algorithm")
+				Expect(err).To(MatchError(ErrUnsupportedAlgorithm), "The error should match ErrUnsupportedAlgorithm")
+				Expect(err.Error()).To(ContainSubstring("unsupported algorithm: DSA"), "The error should name the unsupported algorithm")
+			})
+		})
+	})
+
+	Describe("DecodePrivateKey", func() {
+		It("should reject private keys of another algorithm", func() {
+			keyPair, err := (&RSAGenerator{}).Generate(2048)
+			Expect(err).To(BeNil(), "Failed to generate RSA key pair")
+			privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(keyPair.Private)
+			Expect(err).To(BeNil(), "Failed to marshal PKCS#8 private key")
+			privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})
+
+			_, _, err = NewECCCodec().DecodePrivateKey(privateKeyPEM)
+			Expect(err).To(MatchError(ErrInvalidPrivateKey), "An RSA key should not decode as an ECC key")
+			_, _, err = NewED25519Codec().DecodePrivateKey(privateKeyPEM)
+			Expect(err).To(MatchError(ErrInvalidPrivateKey), "An RSA key should not decode as an Ed25519 key")
+		})
+	})
+
+	Describe("DecodePublicKey", func() {
+		It("should reject public keys of another algorithm", func() {
+			publicKey, _, err := (&ED25519Generator{}).GenerateKeyPair(KeyParameters{})
+			Expect(err).To(BeNil(), "Failed to generate Ed25519 key pair")
+			publicKeyPEM, err := NewED25519Codec().EncodePublicKey(publicKey)
+			Expect(err).To(BeNil(), "Failed to encode public key")
+
+			_, err = NewECCCodec().DecodePublicKey([]byte(publicKeyPEM))
+			Expect(err).To(MatchError(ErrInvalidPublicKey), "An Ed25519 key should not decode as an ECC key")
+			_, err = NewRSACodec().DecodePublicKey([]byte("not a PEM block"))
+			Expect(err).To(MatchError(ErrInvalidPublicKey), "Data without PEM block should not decode")
+		})
+	})
+
+	Describe("Register", func() {
+		It("should make a new algorithm available by name", func() {
+			registry.Register(Algorithm{Name: "MOCK", Signer: &MockSigner{}})
+
+			algorithm, err := registry.Get("MOCK")
+			Expect(err).To(BeNil(), "Failed to get the newly registered algorithm")
+			Expect(algorithm.Signer).To(BeAssignableToTypeOf(&MockSigner{}), "The signer should be the registered one")
+			Expect(registry.Names()).To(Equal([]string{"ECC", "MOCK", "RSA"}), "Names should be sorted and include the new algorithm")
+		})
+	})
+
+	Describe("Registered algorithms", func() {
+		for _, name := range DefaultRegistry.Names() {
+			Context("when using "+name, func() {
+				var algorithm Algorithm
+
+				BeforeEach(func() {
+					var err error
+					algorithm, err = DefaultRegistry.Get(name)
+					Expect(err).To(BeNil(), "Setup failed in BeforeEach")
+				})
+
+				It("should sign data that its verifier accepts", func() {
+					params, err := algorithm.Generator.ResolveParameters(KeyParameters{})
+					Expect(err).To(BeNil(), "Failed to resolve key parameters")
+					opts, err := algorithm.Signer.ResolveOptions(SignOptions{}, params)
+					Expect(err).To(BeNil(), "Failed to resolve signing options")
+					publicKey, privateKey, err := algorithm.Generator.GenerateKeyPair(params)
+					Expect(err).To(BeNil(), "Failed to generate key pair")
+
+					signature, err := algorithm.Signer.Sign("0_data_c2lnbmF0dXJl", privateKey, publicKey, opts)
+					Expect(err).To(BeNil(), "Failed to sign data")
+					Expect(algorithm.Verifier.Verify("0_data_c2lnbmF0dXJl", signature, publicKey, opts)).To(Succeed(), "The signature should be valid")
+					Expect(algorithm.Verifier.Verify("1_data_c2lnbmF0dXJl", signature, publicKey, opts)).ToNot(Succeed(), "The signature should not be valid for other data")
+				})
+
+				It("should decode the private key it encodes", func() {
+					publicKey, privateKey, err := algorithm.Generator.GenerateKeyPair(KeyParameters{})
+					Expect(err).To(BeNil(), "Failed to generate key pair")
+
+					privateKeyPEM, err := algorithm.Codec.EncodePrivateKey(privateKey)
+					Expect(err).To(BeNil(), "Failed to encode private key")
+
+					decodedPublicKey, decodedPrivateKey, err := algorithm.Codec.DecodePrivateKey([]byte(privateKeyPEM))
+					Expect(err).To(BeNil(), "Failed to decode private key")
+					Expect(decodedPrivateKey).To(Equal(privateKey), "The decoded private key should match the original")
+					Expect(decodedPublicKey).To(Equal(publicKey), "The decoded public key should match the original")
+				})
+
+				It("should decode the public key it encodes", func() {
+					publicKey, _, err := algorithm.Generator.GenerateKeyPair(KeyParameters{})
+					Expect(err).To(BeNil(), "Failed to generate key pair")
+
+					publicKeyPEM, err := algorithm.Codec.EncodePublicKey(publicKey)
+					Expect(err).To(BeNil(), "Failed to encode public key")
+
+					decodedPublicKey, err := algorithm.Codec.DecodePublicKey([]byte(publicKeyPEM))
+					Expect(err).To(BeNil(), "Failed to decode public key")
+					Expect(decodedPublicKey).To(Equal(publicKey), "The decoded public key should match the original")
+				})
+
+				It("should decode a PKCS#8 private key and describe its parameters", func() {
+					params, err := algorithm.Generator.ResolveParameters(KeyParameters{})
+					Expect(err).To(BeNil(), "Failed to resolve key parameters")
+					publicKey, privateKey, err := algorithm.Generator.GenerateKeyPair(params)
+					Expect(err).To(BeNil(), "Failed to generate key pair")
+
+					privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+					Expect(err).To(BeNil(), "Failed to marshal PKCS#8 private key")
+					privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})
+
+					decodedPublicKey, _, err := algorithm.Codec.DecodePrivateKey(privateKeyPEM)
+					Expect(err).To(BeNil(), "Failed to decode PKCS#8 private key")
+					Expect(decodedPublicKey).To(Equal(publicKey), "The decoded public key should match the original")
+
+					decodedParams, err := algorithm.Codec.KeyParameters(decodedPublicKey)
+					Expect(err).To(BeNil(), "Failed to describe the public key")
+					Expect(decodedParams).To(Equal(params), "The key parameters should match the generated ones")
+				})
+			})
+		}
+	})
+})
@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"crypto"
+	"fmt"
+
+	// Register the SHA-2 and SHA-3 implementations used by the digests below
+	_ "crypto/sha256"
+	_ "crypto/sha3"
+	_ "crypto/sha512"
+)
+
+const (
+	DigestSHA256   = "SHA-256"
+	DigestSHA384   = "SHA-384"
+	DigestSHA512   = "SHA-512"
+	DigestSHA3_256 = "SHA3-256"
+)
+
+// Digest algorithms that can be selected for signing
+var digests = map[string]crypto.Hash{
+	DigestSHA256:   crypto.SHA256,
+	DigestSHA384:   crypto.SHA384,
+	DigestSHA512:   crypto.SHA512,
+	DigestSHA3_256: crypto.SHA3_256,
+}
+
+// Look up the hash function of a digest. Devices without a recorded digest use SHA-256.
+func digestHash(name string) (crypto.Hash, error) {
+	if name == "" {
+		return crypto.SHA256, nil
+	}
+
+	hash, exists := digests[name]
+	if !exists {
+		return 0, fmt.Errorf("%w: unsupported digest %s, must be one of %s, %s, %s or %s", ErrInvalidSignOptions, name, DigestSHA256, DigestSHA384, DigestSHA512, DigestSHA3_256)
+	}
+
+	return hash, nil
+}
+
+// Calculate the digest of the data with the hash function selected in the signing options
+func hashData(data string, opts SignOptions) (crypto.Hash, []byte, error) {
+	hash, err := digestHash(opts.Digest)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	h := hash.New()
+	h.Write([]byte(data))
+
+	return hash, h.Sum(nil), nil
+}
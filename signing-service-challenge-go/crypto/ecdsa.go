@@ -2,8 +2,13 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
 )
 
 // ECCKeyPair is a DTO that holds ECC private and public keys.
@@ -46,12 +51,31 @@ func (m ECCMarshaler) Encode(keyPair ECCKeyPair) ([]byte, []byte, error) {
 	return encodedPublic, encodedPrivate, nil
 }
 
-// Decode assembles an ECCKeyPair from an encoded private key.
+// Decode assembles an ECCKeyPair from an encoded SEC 1 or PKCS#8 private key.
 func (m ECCMarshaler) Decode(privateKeyBytes []byte) (*ECCKeyPair, error) {
 	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
-	if err != nil {
-		return nil, err
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing the private key")
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	if block.Type == "PRIVATE KEY" {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		privateKey, ok = key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("the private key is not an ECC key")
+		}
+	} else {
+		var err error
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &ECCKeyPair{
@@ -59,3 +83,135 @@ func (m ECCMarshaler) Decode(privateKeyBytes []byte) (*ECCKeyPair, error) {
 		Public:  &privateKey.PublicKey,
 	}, nil
 }
+
+// ECCCodec converts ECC keys from and to PEM strings.
+type ECCCodec struct {
+	marshaler ECCMarshaler
+}
+
+// NewECCCodec creates a new ECCCodec.
+func NewECCCodec() ECCCodec {
+	return ECCCodec{
+		marshaler: NewECCMarshaler(),
+	}
+}
+
+// EncodePublicKey converts an ECC public key to a PEM string.
+func (c ECCCodec) EncodePublicKey(publicKey any) (string, error) {
+	publicKeyECC, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("failed to assert type of ECC public key")
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKeyECC)
+	if err != nil {
+		return "", err
+	}
+
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return string(publicKeyPEM), nil
+}
+
+// DecodePublicKey parses a PEM encoded ECC public key.
+func (c ECCCodec) DecodePublicKey(publicKeyBytes []byte) (any, error) {
+	publicKey, err := parsePublicKeyPEM(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyECC, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an ECC public key", ErrInvalidPublicKey)
+	}
+
+	return publicKeyECC, nil
+}
+
+// EncodePrivateKey converts an ECC private key to a PEM string.
+func (c ECCCodec) EncodePrivateKey(privateKey any) (string, error) {
+	privateKeyECC, ok := privateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("failed to assert type of ECC private key")
+	}
+
+	privateKeyBytes, err := x509.MarshalECPrivateKey(privateKeyECC)
+	if err != nil {
+		return "", err
+	}
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	return string(privateKeyPEM), nil
+}
+
+// DecodePrivateKey parses a PEM encoded ECC private key and returns the key pair.
+func (c ECCCodec) DecodePrivateKey(privateKeyBytes []byte) (any, any, error) {
+	keyPair, err := c.marshaler.Decode(privateKeyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+
+	return keyPair.Public, keyPair.Private, nil
+}
+
+// KeyParameters returns the curve and the size of an ECC public key.
+func (c ECCCodec) KeyParameters(publicKey any) (KeyParameters, error) {
+	publicKeyECC, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return KeyParameters{}, fmt.Errorf("failed to assert type of ECC public key")
+	}
+
+	return KeyParameters{
+		Size:  publicKeyECC.Curve.Params().BitSize,
+		Curve: publicKeyECC.Curve.Params().Name,
+	}, nil
+}
+
+// ecdsaSignature is the ASN.1 structure of a DER encoded ECDSA signature.
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// ECDSASignatureToP1363 converts an ASN.1 DER encoded ECDSA signature into the fixed size
+// raw r||s form of IEEE P1363, where both values are padded to the size of the curve order.
+func ECDSASignatureToP1363(signature []byte, curve elliptic.Curve) ([]byte, error) {
+	var sig ecdsaSignature
+	rest, err := asn1.Unmarshal(signature, &sig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ASN.1 signature: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("unexpected trailing data after ASN.1 signature")
+	}
+
+	size := (curve.Params().N.BitLen() + 7) / 8
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.BitLen() > size*8 || sig.S.BitLen() > size*8 {
+		return nil, errors.New("signature values out of range for the curve")
+	}
+
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+
+	return raw, nil
+}
+
+// ECDSASignatureToASN1 converts a raw r||s IEEE P1363 ECDSA signature into its ASN.1 DER encoding.
+func ECDSASignatureToASN1(signature []byte, curve elliptic.Curve) ([]byte, error) {
+	size := (curve.Params().N.BitLen() + 7) / 8
+	if len(signature) != 2*size {
+		return nil, fmt.Errorf("invalid P1363 signature length %d, expected %d bytes", len(signature), 2*size)
+	}
+
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+}
@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ECDSA signature encoding", func() {
+	var (
+		keyPair *ECCKeyPair
+		hashed  [32]byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		keyPair, err = (&ECCGenerator{}).Generate(elliptic.P256())
+		Expect(err).To(BeNil(), "Setup failed in BeforeEach")
+		hashed = sha256.Sum256([]byte("0_data_c2lnbmF0dXJl"))
+	})
+
+	It("should convert between ASN.1 and P1363 without losing information", func() {
+		der, err := ecdsa.SignASN1(rand.Reader, keyPair.Private, hashed[:])
+		Expect(err).To(BeNil(), "Failed to sign data")
+
+		raw, err := ECDSASignatureToP1363(der, elliptic.P256())
+		Expect(err).To(BeNil(), "Failed to convert to P1363")
+		Expect(raw).To(HaveLen(64), "A P-256 raw signature should be 64 bytes")
+
+		r := new(big.Int).SetBytes(raw[:32])
+		s := new(big.Int).SetBytes(raw[32:])
+		Expect(ecdsa.Verify(keyPair.Public, hashed[:], r, s)).To(BeTrue(), "The raw r and s should form a valid signature")
+
+		back, err := ECDSASignatureToASN1(raw, elliptic.P256())
+		Expect(err).To(BeNil(), "Failed to convert back to ASN.1")
+		Expect(back).To(Equal(der), "The round trip should give back the original DER signature")
+	})
+
+	It("should pad small values to the curve size", func() {
+		raw := append(append(make([]byte, 31), 7), append(make([]byte, 31), 9)...)
+		der, err := ECDSASignatureToASN1(raw, elliptic.P256())
+		Expect(err).To(BeNil(), "Failed to convert to ASN.1")
+		back, err := ECDSASignatureToP1363(der, elliptic.P256())
+		Expect(err).To(BeNil(), "Failed to convert to P1363")
+		Expect(back).To(Equal(raw), "Small values should be left padded with zeros")
+	})
+
+	It("should reject malformed signatures", func() {
+		_, err := ECDSASignatureToASN1(make([]byte, 63), elliptic.P256())
+		Expect(err).To(HaveOccurred(), "A raw signature of the wrong size should be rejected")
+
+		_, err = ECDSASignatureToP1363([]byte("not asn.1"), elliptic.P256())
+		Expect(err).To(HaveOccurred(), "A malformed DER signature should be rejected")
+
+		zeroR, err := ECDSASignatureToASN1(append(make([]byte, 63), 1), elliptic.P256())
+		Expect(err).To(BeNil(), "Failed to convert to ASN.1")
+		_, err = ECDSASignatureToP1363(zeroR, elliptic.P256())
+		Expect(err).To(HaveOccurred(), "A zero r value should be rejected")
+	})
+
+	It("should sign and verify raw signatures with the ECCSigner", func() {
+		signer := NewECCSigner()
+		opts := SignOptions{Digest: DigestSHA256, Encoding: EncodingP1363}
+
+		signature, err := signer.Sign("0_data_c2lnbmF0dXJl", keyPair.Private, keyPair.Public, opts)
+		Expect(err).To(BeNil(), "Failed to sign data")
+		Expect(signature).To(HaveLen(64), "The signature should be a fixed size raw signature")
+		Expect(signer.Verify("0_data_c2lnbmF0dXJl", signature, keyPair.Public, opts)).To(Succeed(), "The raw signature should be valid")
+		Expect(signer.Verify("0_data_c2lnbmF0dXJl", signature, keyPair.Public, SignOptions{Digest: DigestSHA256})).ToNot(Succeed(), "The raw signature should not be accepted as ASN.1")
+	})
+})
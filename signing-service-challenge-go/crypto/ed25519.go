@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ED25519KeyPair is a DTO that holds Ed25519 private and public keys.
+type ED25519KeyPair struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// ED25519Marshaler can encode and decode an Ed25519 key pair.
+type ED25519Marshaler struct{}
+
+// NewED25519Marshaler creates a new ED25519Marshaler.
+func NewED25519Marshaler() ED25519Marshaler {
+	return ED25519Marshaler{}
+}
+
+// Encode takes an ED25519KeyPair and encodes it to be written on disk.
+// It returns the public and the private key as a byte slice.
+func (m ED25519Marshaler) Encode(keyPair ED25519KeyPair) ([]byte, []byte, error) {
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(keyPair.Private)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(keyPair.Public)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encodedPrivate := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	encodedPublic := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return encodedPublic, encodedPrivate, nil
+}
+
+// Decode assembles an ED25519KeyPair from an encoded PKCS#8 private key.
+func (m ED25519Marshaler) Decode(privateKeyBytes []byte) (*ED25519KeyPair, error) {
+	block, _ := pem.Decode(privateKeyBytes)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing the private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("the private key is not an Ed25519 key")
+	}
+
+	return &ED25519KeyPair{
+		Private: privateKey,
+		Public:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// ED25519Codec converts Ed25519 keys from and to PEM strings.
+type ED25519Codec struct {
+	marshaler ED25519Marshaler
+}
+
+// NewED25519Codec creates a new ED25519Codec.
+func NewED25519Codec() ED25519Codec {
+	return ED25519Codec{
+		marshaler: NewED25519Marshaler(),
+	}
+}
+
+// EncodePublicKey converts an Ed25519 public key to a PKIX PEM string.
+func (c ED25519Codec) EncodePublicKey(publicKey any) (string, error) {
+	publicKeyED25519, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("failed to assert type of ED25519 public key")
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKeyED25519)
+	if err != nil {
+		return "", err
+	}
+
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return string(publicKeyPEM), nil
+}
+
+// DecodePublicKey parses a PEM encoded Ed25519 public key.
+func (c ED25519Codec) DecodePublicKey(publicKeyBytes []byte) (any, error) {
+	publicKey, err := parsePublicKeyPEM(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyED25519, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 public key", ErrInvalidPublicKey)
+	}
+
+	return publicKeyED25519, nil
+}
+
+// EncodePrivateKey converts an Ed25519 private key to a PKCS#8 PEM string.
+func (c ED25519Codec) EncodePrivateKey(privateKey any) (string, error) {
+	privateKeyED25519, ok := privateKey.(ed25519.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("failed to assert type of ED25519 private key")
+	}
+
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKeyED25519)
+	if err != nil {
+		return "", err
+	}
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	return string(privateKeyPEM), nil
+}
+
+// DecodePrivateKey parses a PKCS#8 PEM encoded Ed25519 private key and returns the key pair.
+func (c ED25519Codec) DecodePrivateKey(privateKeyBytes []byte) (any, any, error) {
+	keyPair, err := c.marshaler.Decode(privateKeyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+
+	return keyPair.Public, keyPair.Private, nil
+}
+
+// KeyParameters returns the fixed size of an Ed25519 public key.
+func (c ED25519Codec) KeyParameters(publicKey any) (KeyParameters, error) {
+	if _, ok := publicKey.(ed25519.PublicKey); !ok {
+		return KeyParameters{}, fmt.Errorf("failed to assert type of ED25519 public key")
+	}
+
+	return KeyParameters{Size: ed25519KeySize}, nil
+}
@@ -2,18 +2,20 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"fmt"
+	"slices"
 )
 
 // RSAGenerator generates a RSA key pair.
 type RSAGenerator struct{}
 
-// Generate generates a new RSAKeyPair.
-func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := rsa.GenerateKey(rand.Reader, 512)
+// Generate generates a new RSAKeyPair with a modulus of the given size in bits.
+func (g *RSAGenerator) Generate(bits int) (*RSAKeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return nil, err
 	}
@@ -24,13 +26,44 @@ func (g *RSAGenerator) Generate() (*RSAKeyPair, error) {
 	}, nil
 }
 
+// ResolveParameters validates the requested modulus size, defaulting to 2048 bits.
+func (g *RSAGenerator) ResolveParameters(requested KeyParameters) (KeyParameters, error) {
+	if requested.Curve != "" {
+		return KeyParameters{}, fmt.Errorf("%w: RSA keys do not use a curve", ErrInvalidKeyParameters)
+	}
+
+	size := requested.Size
+	if size == 0 {
+		size = defaultRSAKeySize
+	}
+	if !slices.Contains(rsaKeySizes, size) {
+		return KeyParameters{}, fmt.Errorf("%w: unsupported RSA key size %d, must be one of %v", ErrInvalidKeyParameters, size, rsaKeySizes)
+	}
+
+	return KeyParameters{Size: size}, nil
+}
+
+// GenerateKeyPair generates a new RSA key pair and returns its public and private key.
+func (g *RSAGenerator) GenerateKeyPair(params KeyParameters) (any, any, error) {
+	params, err := g.ResolveParameters(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPair, err := g.Generate(params.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyPair.Public, keyPair.Private, nil
+}
+
 // ECCGenerator generates an ECC key pair.
 type ECCGenerator struct{}
 
-// Generate generates a new ECCKeyPair.
-func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
-	// Security has been ignored for the sake of simplicity.
-	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+// Generate generates a new ECCKeyPair on the given curve.
+func (g *ECCGenerator) Generate(curve elliptic.Curve) (*ECCKeyPair, error) {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
 		return nil, err
 	}
@@ -40,3 +73,83 @@ func (g *ECCGenerator) Generate() (*ECCKeyPair, error) {
 		Private: key,
 	}, nil
 }
+
+// ResolveParameters validates the requested curve, which can be given by name or by size, defaulting to P-384.
+func (g *ECCGenerator) ResolveParameters(requested KeyParameters) (KeyParameters, error) {
+	name := requested.Curve
+	if name == "" && requested.Size != 0 {
+		name = fmt.Sprintf("P-%d", requested.Size)
+	}
+	if name == "" {
+		name = defaultECCCurve
+	}
+
+	curve, exists := eccCurves[name]
+	if !exists {
+		return KeyParameters{}, fmt.Errorf("%w: unsupported ECC curve %s, must be one of P-256, P-384 or P-521", ErrInvalidKeyParameters, name)
+	}
+
+	size := curve.Params().BitSize
+	if requested.Size != 0 && requested.Size != size {
+		return KeyParameters{}, fmt.Errorf("%w: key size %d does not match curve %s", ErrInvalidKeyParameters, requested.Size, name)
+	}
+
+	return KeyParameters{Size: size, Curve: name}, nil
+}
+
+// GenerateKeyPair generates a new ECC key pair and returns its public and private key.
+func (g *ECCGenerator) GenerateKeyPair(params KeyParameters) (any, any, error) {
+	params, err := g.ResolveParameters(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPair, err := g.Generate(eccCurves[params.Curve])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyPair.Public, keyPair.Private, nil
+}
+
+// ED25519Generator generates an Ed25519 key pair.
+type ED25519Generator struct{}
+
+// Generate generates a new ED25519KeyPair.
+func (g *ED25519Generator) Generate() (*ED25519KeyPair, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ED25519KeyPair{
+		Public:  publicKey,
+		Private: privateKey,
+	}, nil
+}
+
+// ResolveParameters checks that no other parameters than the fixed Ed25519 ones are requested.
+func (g *ED25519Generator) ResolveParameters(requested KeyParameters) (KeyParameters, error) {
+	if requested.Curve != "" {
+		return KeyParameters{}, fmt.Errorf("%w: ED25519 keys do not accept a curve", ErrInvalidKeyParameters)
+	}
+	if requested.Size != 0 && requested.Size != ed25519KeySize {
+		return KeyParameters{}, fmt.Errorf("%w: ED25519 keys are always %d bits", ErrInvalidKeyParameters, ed25519KeySize)
+	}
+
+	return KeyParameters{Size: ed25519KeySize}, nil
+}
+
+// GenerateKeyPair generates a new Ed25519 key pair and returns its public and private key.
+func (g *ED25519Generator) GenerateKeyPair(params KeyParameters) (any, any, error) {
+	if _, err := g.ResolveParameters(params); err != nil {
+		return nil, nil, err
+	}
+
+	keyPair, err := g.Generate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyPair.Public, keyPair.Private, nil
+}
@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrKeyNotExportable is returned when the key store does not let private keys leave it.
+var ErrKeyNotExportable = errors.New("private key is not exportable")
+
+// KeyHandle references a private key held by a KeyStore. Its content is only meaningful to the store that created it.
+type KeyHandle []byte
+
+// KeyStore holds the private keys of the devices and performs the operations that need them,
+// so callers only ever see key handles and public keys.
+// The key ID names a key within the store, e.g. after the device it belongs to.
+type KeyStore interface {
+	GenerateKey(keyID, algorithm string, params KeyParameters) (handle KeyHandle, publicKey any, err error)
+	ImportKey(keyID, algorithm string, privateKey any) (KeyHandle, error)
+	PublicKey(keyID, algorithm string, handle KeyHandle) (any, error)
+	Sign(keyID, algorithm string, handle KeyHandle, data string, opts SignOptions) ([]byte, error)
+}
+
+// KeyExporter is implemented by key stores that can release their private keys, e.g. to export them encrypted.
+type KeyExporter interface {
+	ExportKey(keyID, algorithm string, handle KeyHandle) (any, error)
+}
+
+// KeyRewrapper is implemented by key stores that keep the keys wrapped in their handles.
+// Rewrap returns a new handle for the key wrapped with the active master key.
+type KeyRewrapper interface {
+	Rewrap(keyID string, handle KeyHandle) (KeyHandle, error)
+}
+
+// SignOptionsChecker is implemented by key stores that cannot sign with every option of the signers,
+// so devices are only created with options their key store can sign with. CheckSignOptions returns an
+// error matching ErrInvalidSignOptions for resolved options the key store does not support.
+type SignOptionsChecker interface {
+	CheckSignOptions(algorithm string, opts SignOptions) error
+}
+
+// SoftwareKeyStore keeps the private keys in process. Its handles are the private keys themselves,
+// encrypted by the key wrapper and bound to their key ID, so they can be stored anywhere.
+type SoftwareKeyStore struct {
+	algorithms *Registry
+	keyWrapper KeyWrapperInterface
+}
+
+// NewSoftwareKeyStore creates a SoftwareKeyStore for the algorithms of the registry.
+func NewSoftwareKeyStore(algorithms *Registry, keyWrapper KeyWrapperInterface) *SoftwareKeyStore {
+	return &SoftwareKeyStore{
+		algorithms: algorithms,
+		keyWrapper: keyWrapper,
+	}
+}
+
+// GenerateKey generates a key pair and returns the wrapped private key as handle.
+func (s *SoftwareKeyStore) GenerateKey(keyID, algorithm string, params KeyParameters) (KeyHandle, any, error) {
+	alg, err := s.algorithms.Get(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, privateKey, err := alg.Generator.GenerateKeyPair(params)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+
+	handle, err := s.wrap(keyID, alg, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return handle, publicKey, nil
+}
+
+// ImportKey wraps an existing private key and returns it as handle.
+func (s *SoftwareKeyStore) ImportKey(keyID, algorithm string, privateKey any) (KeyHandle, error) {
+	alg, err := s.algorithms.Get(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.wrap(keyID, alg, privateKey)
+}
+
+// PublicKey unwraps the private key of the handle and returns its public key.
+func (s *SoftwareKeyStore) PublicKey(keyID, algorithm string, handle KeyHandle) (any, error) {
+	publicKey, _, err := s.unwrap(keyID, algorithm, handle)
+	return publicKey, err
+}
+
+// Sign unwraps the private key of the handle and signs the data with the signer of the algorithm.
+func (s *SoftwareKeyStore) Sign(keyID, algorithm string, handle KeyHandle, data string, opts SignOptions) ([]byte, error) {
+	publicKey, privateKey, err := s.unwrap(keyID, algorithm, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := s.algorithms.Get(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return alg.Signer.Sign(data, privateKey, publicKey, opts)
+}
+
+// ExportKey unwraps the private key of the handle.
+func (s *SoftwareKeyStore) ExportKey(keyID, algorithm string, handle KeyHandle) (any, error) {
+	_, privateKey, err := s.unwrap(keyID, algorithm, handle)
+	return privateKey, err
+}
+
+// Rewrap wraps the private key of the handle with the active master key of the key wrapper.
+func (s *SoftwareKeyStore) Rewrap(keyID string, handle KeyHandle) (KeyHandle, error) {
+	return s.keyWrapper.Rewrap(handle, []byte(keyID))
+}
+
+// Encode the private key with the codec of its algorithm and wrap it, bound to its key ID
+func (s *SoftwareKeyStore) wrap(keyID string, alg Algorithm, privateKey any) (KeyHandle, error) {
+	privateKeyPEM, err := alg.Codec.EncodePrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	wrapped, err := s.keyWrapper.Wrap([]byte(privateKeyPEM), []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap private key: %w", err)
+	}
+
+	return wrapped, nil
+}
+
+// Unwrap the private key of a handle, which must only be kept in memory while it is being used
+func (s *SoftwareKeyStore) unwrap(keyID, algorithm string, handle KeyHandle) (any, any, error) {
+	alg, err := s.algorithms.Get(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateKeyPEM, err := s.keyWrapper.Unwrap(handle, []byte(keyID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, privateKey, err := alg.Codec.DecodePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode private key: %w", err)
+	}
+
+	return publicKey, privateKey, nil
+}
@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+)
+
+// MockKeyStore is a mock implementation of KeyStore, KeyExporter and KeyRewrapper
+type MockKeyStore struct {
+	GenerateKeyFunc func(keyID, algorithm string, params KeyParameters) (KeyHandle, any, error)
+	ImportKeyFunc   func(keyID, algorithm string, privateKey any) (KeyHandle, error)
+	PublicKeyFunc   func(keyID, algorithm string, handle KeyHandle) (any, error)
+	SignFunc        func(keyID, algorithm string, handle KeyHandle, data string, opts SignOptions) ([]byte, error)
+	ExportKeyFunc   func(keyID, algorithm string, handle KeyHandle) (any, error)
+	RewrapFunc      func(keyID string, handle KeyHandle) (KeyHandle, error)
+}
+
+func (m *MockKeyStore) GenerateKey(keyID, algorithm string, params KeyParameters) (KeyHandle, any, error) {
+	if m.GenerateKeyFunc != nil {
+		return m.GenerateKeyFunc(keyID, algorithm, params)
+	}
+	publicKey, _ := m.PublicKey(keyID, algorithm, nil)
+	return KeyHandle(algorithm + " Key Handle"), publicKey, nil
+}
+
+func (m *MockKeyStore) ImportKey(keyID, algorithm string, privateKey any) (KeyHandle, error) {
+	if m.ImportKeyFunc != nil {
+		return m.ImportKeyFunc(keyID, algorithm, privateKey)
+	}
+	return KeyHandle(algorithm + " Key Handle"), nil
+}
+
+func (m *MockKeyStore) PublicKey(keyID, algorithm string, handle KeyHandle) (any, error) {
+	if m.PublicKeyFunc != nil {
+		return m.PublicKeyFunc(keyID, algorithm, handle)
+	}
+	switch algorithm {
+	case AlgorithmECC:
+		return &ecdsa.PublicKey{}, nil
+	case AlgorithmRSA:
+		return &rsa.PublicKey{}, nil
+	case AlgorithmED25519:
+		return ed25519.PublicKey{}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *MockKeyStore) Sign(keyID, algorithm string, handle KeyHandle, data string, opts SignOptions) ([]byte, error) {
+	if m.SignFunc != nil {
+		return m.SignFunc(keyID, algorithm, handle, data, opts)
+	}
+	return []byte("Signature"), nil
+}
+
+func (m *MockKeyStore) ExportKey(keyID, algorithm string, handle KeyHandle) (any, error) {
+	if m.ExportKeyFunc != nil {
+		return m.ExportKeyFunc(keyID, algorithm, handle)
+	}
+	return nil, nil
+}
+
+func (m *MockKeyStore) Rewrap(keyID string, handle KeyHandle) (KeyHandle, error) {
+	if m.RewrapFunc != nil {
+		return m.RewrapFunc(keyID, handle)
+	}
+	return handle, nil
+}
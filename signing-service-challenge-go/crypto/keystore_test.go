@@ -0,0 +1,144 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Signing options exercising every mechanism of the key stores
+var keyStoreCases = []struct {
+	algorithm string
+	params    KeyParameters
+	opts      SignOptions
+}{
+	{AlgorithmECC, KeyParameters{Curve: "P-256"}, SignOptions{Digest: DigestSHA256, Encoding: EncodingASN1}},
+	{AlgorithmECC, KeyParameters{Curve: "P-384"}, SignOptions{Digest: DigestSHA384, Encoding: EncodingP1363}},
+	{AlgorithmRSA, KeyParameters{Size: 2048}, SignOptions{Digest: DigestSHA256, Padding: PaddingPKCS1v15}},
+	{AlgorithmRSA, KeyParameters{Size: 2048}, SignOptions{Digest: DigestSHA384, Padding: PaddingPKCS1v15}},
+	{AlgorithmRSA, KeyParameters{Size: 2048}, SignOptions{Digest: DigestSHA512, Padding: PaddingPKCS1v15}},
+	{AlgorithmRSA, KeyParameters{Size: 2048}, SignOptions{Digest: DigestSHA3_256, Padding: PaddingPKCS1v15}},
+	{AlgorithmRSA, KeyParameters{Size: 2048}, SignOptions{Digest: DigestSHA256, Padding: PaddingPSS, SaltLength: 20}},
+	{AlgorithmED25519, KeyParameters{}, SignOptions{Digest: DigestSHA512}},
+}
+
+var _ = Describe("SoftwareKeyStore", func() {
+	var store *SoftwareKeyStore
+
+	BeforeEach(func() {
+		store = NewSoftwareKeyStore(DefaultRegistry, NewEphemeralKeyWrapper())
+	})
+
+	It("should sign with the keys it generates", func() {
+		for _, c := range keyStoreCases {
+			handle, publicKey, err := store.GenerateKey("device-1", c.algorithm, c.params)
+			Expect(err).To(BeNil(), "Failed to generate %s key", c.algorithm)
+			Expect(bytes.Contains(handle, []byte("PRIVATE KEY"))).To(BeFalse(), "The handle should not contain the plaintext key")
+
+			signature, err := store.Sign("device-1", c.algorithm, handle, "data", c.opts)
+			Expect(err).To(BeNil(), "Failed to sign with %s and %+v", c.algorithm, c.opts)
+			alg, _ := DefaultRegistry.Get(c.algorithm)
+			Expect(alg.Verifier.Verify("data", signature, publicKey, c.opts)).To(Succeed(), "The signature should be valid")
+		}
+	})
+
+	It("should bind the handles to their key ID", func() {
+		handle, _, err := store.GenerateKey("device-1", AlgorithmECC, KeyParameters{})
+		Expect(err).To(BeNil(), "Failed to generate key")
+
+		_, err = store.Sign("device-2", AlgorithmECC, handle, "data", SignOptions{})
+		Expect(err).To(MatchError(ErrKeyUnwrap), "The handle should only work for its key ID")
+	})
+
+	It("should import and export existing keys", func() {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).To(BeNil(), "Failed to generate key")
+
+		handle, err := store.ImportKey("device-1", AlgorithmECC, privateKey)
+		Expect(err).To(BeNil(), "Failed to import key")
+
+		publicKey, err := store.PublicKey("device-1", AlgorithmECC, handle)
+		Expect(err).To(BeNil(), "Failed to read the public key")
+		Expect(publicKey).To(Equal(&privateKey.PublicKey), "The public key should belong to the imported key")
+
+		exported, err := store.ExportKey("device-1", AlgorithmECC, handle)
+		Expect(err).To(BeNil(), "Failed to export key")
+		Expect(exported.(*ecdsa.PrivateKey).Equal(privateKey)).To(BeTrue(), "The exported key should be the imported one")
+	})
+})
+
+var _ = Describe("PKCS11KeyStore", func() {
+	var (
+		token *SoftToken
+		store *PKCS11KeyStore
+	)
+
+	BeforeEach(func() {
+		token = NewSoftToken()
+		store = NewPKCS11KeyStore(token, DefaultRegistry)
+	})
+
+	It("should sign on the token with the mechanism of the signing options", func() {
+		for i, c := range keyStoreCases {
+			keyID := string(rune('a' + i))
+			handle, publicKey, err := store.GenerateKey(keyID, c.algorithm, c.params)
+			Expect(err).To(BeNil(), "Failed to generate %s key", c.algorithm)
+			Expect(handle).To(Equal(KeyHandle(keyID)), "The handle should be the CKA_ID of the key")
+
+			// The store verifies the signatures of the token, so they match what the software signers produce
+			signature, err := store.Sign(keyID, c.algorithm, handle, "data", c.opts)
+			Expect(err).To(BeNil(), "Failed to sign with %s and %+v", c.algorithm, c.opts)
+			alg, _ := DefaultRegistry.Get(c.algorithm)
+			Expect(alg.Verifier.Verify("data", signature, publicKey, c.opts)).To(Succeed(), "The signature should be valid")
+		}
+	})
+
+	It("should sign with imported keys", func() {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).To(BeNil(), "Failed to generate key")
+
+		handle, err := store.ImportKey("device-1", AlgorithmECC, privateKey)
+		Expect(err).To(BeNil(), "Failed to import key")
+
+		signature, err := store.Sign("device-1", AlgorithmECC, handle, "data", SignOptions{Digest: DigestSHA256})
+		Expect(err).To(BeNil(), "Failed to sign")
+		Expect(NewECCSigner().Verify("data", signature, &privateKey.PublicKey, SignOptions{Digest: DigestSHA256})).To(Succeed(), "The signature should be valid for the imported key")
+	})
+
+	It("should reject a second key with the same ID", func() {
+		_, _, err := store.GenerateKey("device-1", AlgorithmECC, KeyParameters{})
+		Expect(err).To(BeNil(), "Failed to generate key")
+
+		_, _, err = store.GenerateKey("device-1", AlgorithmECC, KeyParameters{})
+		Expect(err).To(HaveOccurred(), "Key IDs should be unique on the token")
+	})
+
+	It("should fail for keys that are not on the token", func() {
+		_, err := store.Sign("device-1", AlgorithmECC, KeyHandle("device-1"), "data", SignOptions{})
+		Expect(err).To(MatchError(ErrObjectNotFound), "Signing without key should fail")
+	})
+
+	It("should reject deterministic signatures", func() {
+		handle, _, err := store.GenerateKey("device-1", AlgorithmECC, KeyParameters{})
+		Expect(err).To(BeNil(), "Failed to generate key")
+
+		_, err = store.Sign("device-1", AlgorithmECC, handle, "data", SignOptions{Deterministic: true})
+		Expect(err).To(MatchError(ErrInvalidSignOptions), "The token has no deterministic ECDSA mechanism")
+
+		var keyStore KeyStore = store
+		checker, ok := keyStore.(SignOptionsChecker)
+		Expect(ok).To(BeTrue(), "The store should let devices be checked before they are created")
+		Expect(checker.CheckSignOptions(AlgorithmECC, SignOptions{Deterministic: true})).To(MatchError(ErrInvalidSignOptions), "Deterministic options should be rejected")
+		Expect(checker.CheckSignOptions(AlgorithmECC, SignOptions{Digest: "SHA-256"})).To(Succeed(), "Randomized options should be accepted")
+	})
+
+	It("should not let the private keys leave the token", func() {
+		var keyStore KeyStore = store
+		_, exportable := keyStore.(KeyExporter)
+		Expect(exportable).To(BeFalse(), "Keys on the token should not be exportable")
+	})
+})
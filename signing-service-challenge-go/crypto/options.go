@@ -0,0 +1,27 @@
+package crypto
+
+import "errors"
+
+// ErrInvalidSignOptions is returned when the requested signing options are not supported by the algorithm.
+var ErrInvalidSignOptions = errors.New("invalid signing options")
+
+const (
+	PaddingPKCS1v15 = "PKCS1v15"
+	PaddingPSS      = "PSS"
+
+	EncodingASN1  = "ASN1"
+	EncodingP1363 = "P1363"
+)
+
+// SignOptions selects how a signer produces and verifies signatures.
+// Digest is the hash function applied to the data before signing.
+// Padding and SaltLength only apply to RSA, the salt length is given in bytes.
+// Encoding only applies to ECC and selects between ASN.1 DER and raw r||s (IEEE P1363) signatures.
+// Deterministic only applies to ECC and derives the nonce from the key and the digest as described in RFC 6979.
+type SignOptions struct {
+	Digest        string
+	Padding       string
+	SaltLength    int
+	Encoding      string
+	Deterministic bool
+}
@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidKeyParameters is returned when the requested key parameters are not supported or not allowed.
+var ErrInvalidKeyParameters = errors.New("invalid key parameters")
+
+// KeyParameters describes the key of a device.
+// Size is the key size in bits (the modulus for RSA, the curve size for ECC) and
+// Curve the name of the elliptic curve for algorithms that use one.
+type KeyParameters struct {
+	Size  int
+	Curve string
+}
+
+// KeyPolicy holds the minimum key size in bits accepted for each algorithm.
+type KeyPolicy struct {
+	MinKeySizes map[string]int
+}
+
+// DefaultKeyPolicy rejects RSA keys below 2048 bits and curves below 256 bits.
+var DefaultKeyPolicy = KeyPolicy{
+	MinKeySizes: map[string]int{
+		AlgorithmRSA: 2048,
+		AlgorithmECC: 256,
+	},
+}
+
+// Check returns an error if the resolved key parameters are weaker than the policy allows
+func (p KeyPolicy) Check(algorithm string, params KeyParameters) error {
+	minSize, exists := p.MinKeySizes[algorithm]
+	if exists && params.Size < minSize {
+		return fmt.Errorf("%w: %s keys must be at least %d bits", ErrInvalidKeyParameters, algorithm, minSize)
+	}
+
+	return nil
+}
+
+// RSA modulus sizes supported by the RSAGenerator
+var rsaKeySizes = []int{2048, 3072, 4096}
+
+const defaultRSAKeySize = 2048
+
+// Curves supported by the ECCGenerator
+var eccCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+const defaultECCCurve = "P-384"
+
+// Size in bits of the Ed25519 keys
+const ed25519KeySize = 256
@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyParameters", func() {
+	Describe("RSAGenerator", func() {
+		var generator *RSAGenerator
+
+		BeforeEach(func() {
+			generator = &RSAGenerator{}
+		})
+
+		It("should default to a 2048 bits modulus", func() {
+			params, err := generator.ResolveParameters(KeyParameters{})
+			Expect(err).To(BeNil(), "Failed to resolve default parameters")
+			Expect(params).To(Equal(KeyParameters{Size: 2048}), "The default RSA key size should be 2048 bits")
+		})
+
+		It("should generate a key with the requested modulus size", func() {
+			publicKey, _, err := generator.GenerateKeyPair(KeyParameters{Size: 3072})
+			Expect(err).To(BeNil(), "Failed to generate RSA key pair")
+			Expect(publicKey.(*rsa.PublicKey).N.BitLen()).To(Equal(3072), "The modulus should have the requested size")
+		})
+
+		It("should reject unsupported sizes and curves", func() {
+			_, err := generator.ResolveParameters(KeyParameters{Size: 512})
+			Expect(err).To(MatchError(ErrInvalidKeyParameters), "A 512 bits modulus should be rejected")
+
+			_, err = generator.ResolveParameters(KeyParameters{Curve: "P-256"})
+			Expect(err).To(MatchError(ErrInvalidKeyParameters), "RSA keys should not accept a curve")
+		})
+	})
+
+	Describe("ECCGenerator", func() {
+		var generator *ECCGenerator
+
+		BeforeEach(func() {
+			generator = &ECCGenerator{}
+		})
+
+		It("should default to P-384", func() {
+			params, err := generator.ResolveParameters(KeyParameters{})
+			Expect(err).To(BeNil(), "Failed to resolve default parameters")
+			Expect(params).To(Equal(KeyParameters{Size: 384, Curve: "P-384"}), "The default curve should be P-384")
+		})
+
+		It("should resolve the curve from its size", func() {
+			params, err := generator.ResolveParameters(KeyParameters{Size: 521})
+			Expect(err).To(BeNil(), "Failed to resolve parameters from the key size")
+			Expect(params).To(Equal(KeyParameters{Size: 521, Curve: "P-521"}), "A 521 bits key should use P-521")
+		})
+
+		It("should generate a key on the requested curve", func() {
+			publicKey, _, err := generator.GenerateKeyPair(KeyParameters{Curve: "P-256"})
+			Expect(err).To(BeNil(), "Failed to generate ECC key pair")
+			Expect(publicKey.(*ecdsa.PublicKey).Curve.Params().Name).To(Equal("P-256"), "The key should be on the requested curve")
+		})
+
+		It("should reject unknown curves and mismatching sizes", func() {
+			_, err := generator.ResolveParameters(KeyParameters{Curve: "P-224"})
+			Expect(err).To(MatchError(ErrInvalidKeyParameters), "P-224 should be rejected")
+
+			_, err = generator.ResolveParameters(KeyParameters{Size: 256, Curve: "P-384"})
+			Expect(err).To(MatchError(ErrInvalidKeyParameters), "A size not matching the curve should be rejected")
+		})
+	})
+
+	Describe("ED25519Generator", func() {
+		It("should only accept the fixed Ed25519 parameters", func() {
+			generator := &ED25519Generator{}
+
+			params, err := generator.ResolveParameters(KeyParameters{})
+			Expect(err).To(BeNil(), "Failed to resolve default parameters")
+			Expect(params).To(Equal(KeyParameters{Size: 256}), "Ed25519 keys should be 256 bits")
+
+			_, err = generator.ResolveParameters(KeyParameters{Size: 448})
+			Expect(err).To(MatchError(ErrInvalidKeyParameters), "Other sizes should be rejected")
+		})
+	})
+
+	Describe("KeyPolicy", func() {
+		It("should reject keys below the minimum size of their algorithm", func() {
+			policy := KeyPolicy{MinKeySizes: map[string]int{AlgorithmRSA: 3072, AlgorithmECC: 384}}
+
+			Expect(policy.Check(AlgorithmRSA, KeyParameters{Size: 2048})).To(MatchError(ErrInvalidKeyParameters), "2048 bits RSA should be rejected")
+			Expect(policy.Check(AlgorithmRSA, KeyParameters{Size: 4096})).To(Succeed(), "4096 bits RSA should be allowed")
+			Expect(policy.Check(AlgorithmECC, KeyParameters{Size: 256, Curve: "P-256"})).To(MatchError(ErrInvalidKeyParameters), "P-256 should be rejected")
+			Expect(policy.Check(AlgorithmED25519, KeyParameters{Size: 256})).To(Succeed(), "Algorithms without a minimum should be allowed")
+		})
+	})
+})
@@ -0,0 +1,254 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+)
+
+// MechanismType identifies a PKCS#11 mechanism, using the CKM_* values of the standard.
+type MechanismType uint
+
+const (
+	MechanismRSAPKCSKeyPairGen   MechanismType = 0x0000 // CKM_RSA_PKCS_KEY_PAIR_GEN
+	MechanismRSAPKCS             MechanismType = 0x0001 // CKM_RSA_PKCS
+	MechanismRSAPKCSPSS          MechanismType = 0x000D // CKM_RSA_PKCS_PSS
+	MechanismECKeyPairGen        MechanismType = 0x1040 // CKM_EC_KEY_PAIR_GEN
+	MechanismECDSA               MechanismType = 0x1041 // CKM_ECDSA
+	MechanismECEdwardsKeyPairGen MechanismType = 0x1055 // CKM_EC_EDWARDS_KEY_PAIR_GEN
+	MechanismEdDSA               MechanismType = 0x1057 // CKM_EDDSA
+)
+
+// ObjectClass is the class of a token object, using the CKO_* values of the standard.
+type ObjectClass uint
+
+const (
+	ClassPublicKey  ObjectClass = 0x0002 // CKO_PUBLIC_KEY
+	ClassPrivateKey ObjectClass = 0x0003 // CKO_PRIVATE_KEY
+)
+
+// ObjectHandle references an object of a token session.
+type ObjectHandle uint
+
+// ErrObjectNotFound is returned when a token has no object with the requested class and ID.
+var ErrObjectNotFound = errors.New("token object not found")
+
+// Mechanism is a mechanism with its parameter, e.g. PSSParams for MechanismRSAPKCSPSS.
+type Mechanism struct {
+	Type      MechanismType
+	Parameter any
+}
+
+// PSSParams are the parameters of MechanismRSAPKCSPSS (CK_RSA_PKCS_PSS_PARAMS).
+// The MGF always uses the same hash as the signature.
+type PSSParams struct {
+	Hash       crypto.Hash
+	SaltLength int
+}
+
+// KeyTemplate holds the attributes of a key pair created on a token.
+type KeyTemplate struct {
+	ID          []byte // CKA_ID, shared by the public and the private key
+	Label       string // CKA_LABEL
+	ModulusBits int    // CKA_MODULUS_BITS of RSA keys
+	Curve       string // CKA_EC_PARAMS of EC keys, as curve name
+}
+
+// Token is the subset of a PKCS#11 session used by the PKCS11KeyStore.
+// Private keys created on a token are sensitive and not extractable: they can only be used through Sign.
+// Sign takes the input of the mechanism as defined by the standard, e.g. the hash for MechanismECDSA,
+// and returns ECDSA signatures in their raw r||s form.
+type Token interface {
+	GenerateKeyPair(mechanism Mechanism, template KeyTemplate) (publicKey, privateKey ObjectHandle, err error)
+	CreateKeyPair(template KeyTemplate, key any) (publicKey, privateKey ObjectHandle, err error)
+	FindObject(class ObjectClass, id []byte) (ObjectHandle, error)
+	PublicKey(object ObjectHandle) (any, error)
+	Sign(mechanism Mechanism, key ObjectHandle, data []byte) ([]byte, error)
+}
+
+// DigestInfo prefixes of the digests, prepended to the hash for MechanismRSAPKCS (RFC 8017, section 9.2)
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256:   {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384:   {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512:   {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+	crypto.SHA3_256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x08, 0x05, 0x00, 0x04, 0x20},
+}
+
+// PKCS11KeyStore keeps the private keys on a PKCS#11 token. Its handles are the CKA_ID of the keys,
+// so the keys never leave the token and cannot be exported.
+type PKCS11KeyStore struct {
+	token      Token
+	algorithms *Registry
+}
+
+// NewPKCS11KeyStore creates a PKCS11KeyStore on the token. The algorithms of the registry are used
+// to verify the signatures returned by the token.
+func NewPKCS11KeyStore(token Token, algorithms *Registry) *PKCS11KeyStore {
+	return &PKCS11KeyStore{
+		token:      token,
+		algorithms: algorithms,
+	}
+}
+
+// GenerateKey generates a key pair on the token, identified by the key ID.
+func (s *PKCS11KeyStore) GenerateKey(keyID, algorithm string, params KeyParameters) (KeyHandle, any, error) {
+	alg, err := s.algorithms.Get(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err = alg.Generator.ResolveParameters(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := KeyTemplate{ID: []byte(keyID), Label: keyID}
+	var mechanism Mechanism
+	switch algorithm {
+	case AlgorithmECC:
+		mechanism = Mechanism{Type: MechanismECKeyPairGen}
+		template.Curve = params.Curve
+	case AlgorithmRSA:
+		mechanism = Mechanism{Type: MechanismRSAPKCSKeyPairGen}
+		template.ModulusBits = params.Size
+	case AlgorithmED25519:
+		mechanism = Mechanism{Type: MechanismECEdwardsKeyPairGen}
+	default:
+		return nil, nil, fmt.Errorf("algorithm %s is not supported by the PKCS#11 key store", algorithm)
+	}
+
+	publicObject, _, err := s.token.GenerateKeyPair(mechanism, template)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair on token: %w", err)
+	}
+	publicKey, err := s.token.PublicKey(publicObject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return KeyHandle(keyID), publicKey, nil
+}
+
+// ImportKey creates the key pair of an existing private key on the token, identified by the key ID.
+func (s *PKCS11KeyStore) ImportKey(keyID, algorithm string, privateKey any) (KeyHandle, error) {
+	if _, err := s.algorithms.Get(algorithm); err != nil {
+		return nil, err
+	}
+
+	template := KeyTemplate{ID: []byte(keyID), Label: keyID}
+	if _, _, err := s.token.CreateKeyPair(template, privateKey); err != nil {
+		return nil, fmt.Errorf("failed to create key pair on token: %w", err)
+	}
+
+	return KeyHandle(keyID), nil
+}
+
+// PublicKey reads the public key of the handle from the token.
+func (s *PKCS11KeyStore) PublicKey(keyID, algorithm string, handle KeyHandle) (any, error) {
+	object, err := s.token.FindObject(ClassPublicKey, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.token.PublicKey(object)
+}
+
+// CheckSignOptions rejects deterministic nonces, as the token draws the nonces of its ECDSA signatures itself
+func (s *PKCS11KeyStore) CheckSignOptions(algorithm string, opts SignOptions) error {
+	if opts.Deterministic {
+		return fmt.Errorf("%w: deterministic nonces are not supported by the PKCS#11 key store", ErrInvalidSignOptions)
+	}
+
+	return nil
+}
+
+// Sign signs the data on the token with the mechanism matching the algorithm and signing options.
+// The data is hashed before it is sent to the token, except for Ed25519 which signs the message itself.
+func (s *PKCS11KeyStore) Sign(keyID, algorithm string, handle KeyHandle, data string, opts SignOptions) ([]byte, error) {
+	alg, err := s.algorithms.Get(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CheckSignOptions(algorithm, opts); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := s.PublicKey(keyID, algorithm, handle)
+	if err != nil {
+		return nil, err
+	}
+	privateObject, err := s.token.FindObject(ClassPrivateKey, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	switch algorithm {
+	case AlgorithmECC:
+		signature, err = s.signECDSA(privateObject, publicKey, data, opts)
+	case AlgorithmRSA:
+		signature, err = s.signRSA(privateObject, data, opts)
+	case AlgorithmED25519:
+		signature, err = s.token.Sign(Mechanism{Type: MechanismEdDSA}, privateObject, []byte(data))
+	default:
+		err = fmt.Errorf("algorithm %s is not supported by the PKCS#11 key store", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed signing data: %w", err)
+	}
+
+	// Verify if the signature is valid
+	if err := alg.Verifier.Verify(data, signature, publicKey, opts); err != nil {
+		return nil, fmt.Errorf("failed verifying the signed data: %w", err)
+	}
+
+	return signature, nil
+}
+
+// Sign the hash with CKM_ECDSA, which returns the raw r||s form, and convert it to the encoding of the device
+func (s *PKCS11KeyStore) signECDSA(key ObjectHandle, publicKey any, data string, opts SignOptions) ([]byte, error) {
+	publicKeyCasted, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("failed to assert type of ECC public key")
+	}
+
+	_, hashed, err := hashData(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := s.token.Sign(Mechanism{Type: MechanismECDSA}, key, hashed)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Encoding == EncodingP1363 {
+		return signature, nil
+	}
+
+	return ECDSASignatureToASN1(signature, publicKeyCasted.Curve)
+}
+
+// Sign the hash with CKM_RSA_PKCS_PSS, or the DigestInfo of the hash with CKM_RSA_PKCS
+func (s *PKCS11KeyStore) signRSA(key ObjectHandle, data string, opts SignOptions) ([]byte, error) {
+	hash, hashed, err := hashData(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Padding {
+	case PaddingPSS:
+		saltLength := opts.SaltLength
+		if saltLength == 0 {
+			saltLength = hash.Size()
+		}
+		mechanism := Mechanism{Type: MechanismRSAPKCSPSS, Parameter: PSSParams{Hash: hash, SaltLength: saltLength}}
+		return s.token.Sign(mechanism, key, hashed)
+	case "", PaddingPKCS1v15:
+		prefix, exists := digestInfoPrefixes[hash]
+		if !exists {
+			return nil, fmt.Errorf("%w: unsupported digest %s for RSA", ErrInvalidSignOptions, opts.Digest)
+		}
+		return s.token.Sign(Mechanism{Type: MechanismRSAPKCS}, key, append(append([]byte{}, prefix...), hashed...))
+	default:
+		return nil, fmt.Errorf("%w: unsupported RSA padding %s", ErrInvalidSignOptions, opts.Padding)
+	}
+}
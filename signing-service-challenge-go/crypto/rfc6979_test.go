@@ -0,0 +1,94 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// Build a key pair from the hex encoded private scalar of a test vector
+func rfc6979Key(curve elliptic.Curve, d string) *ecdsa.PrivateKey {
+	privateKey := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve},
+		D:         new(big.Int).SetBytes(fromHex(d)),
+	}
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(privateKey.D.Bytes())
+
+	return privateKey
+}
+
+func fromHex(s string) []byte {
+	value, ok := new(big.Int).SetString(s, 16)
+	Expect(ok).To(BeTrue(), "Invalid hex value in test vector")
+	return value.Bytes()
+}
+
+var _ = Describe("Deterministic ECDSA (RFC 6979)", func() {
+	var signer *ECCSigner
+
+	BeforeEach(func() {
+		signer = NewECCSigner()
+	})
+
+	// Test vectors from RFC 6979, appendix A.2.5 (P-256) and A.2.6 (P-384)
+	DescribeTable("should produce the signatures published in RFC 6979",
+		func(curve elliptic.Curve, d, digest, message, r, s string) {
+			privateKey := rfc6979Key(curve, d)
+			opts := SignOptions{Digest: digest, Encoding: EncodingP1363, Deterministic: true}
+
+			signature, err := signer.Sign(message, privateKey, &privateKey.PublicKey, opts)
+			Expect(err).To(BeNil(), "Failed to sign the test vector message")
+
+			size := (curve.Params().BitSize + 7) / 8
+			Expect(signature[:size]).To(Equal(new(big.Int).SetBytes(fromHex(r)).FillBytes(make([]byte, size))), "r should match the test vector")
+			Expect(signature[size:]).To(Equal(new(big.Int).SetBytes(fromHex(s)).FillBytes(make([]byte, size))), "s should match the test vector")
+		},
+		Entry("P-256, SHA-256, sample", elliptic.P256(),
+			"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			DigestSHA256, "sample",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8"),
+		Entry("P-256, SHA-256, test", elliptic.P256(),
+			"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			DigestSHA256, "test",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083"),
+		Entry("P-384, SHA-384, sample", elliptic.P384(),
+			"6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+			DigestSHA384, "sample",
+			"94EDBB92A5ECB8AAD4736E56C691916B3F88140666CE9FA73D64C4EA95AD133C81A648152E44ACF96E36DD1E80FABE46",
+			"99EF4AEB15F178CEA1FE40DB2603138F130E740A19624526203B6351D0A3A94FA329C145786E679E7B82C71A38628AC8"),
+		Entry("P-384, SHA-256, sample", elliptic.P384(),
+			"6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+			DigestSHA256, "sample",
+			"21B13D1E013C7FA1392D03C5F99AF8B30C570C6F98D4EA8E354B63A21D3DAA33BDE1E888E63355D92FA2B3C36D8FB2CD",
+			"F3AA443FB107745BF4BD77CB3891674632068A10CA67E3D45DB2266FA7D1FEEBEFDC63ECCD1AC42EC0CB8668A4FA0AB0"),
+	)
+
+	It("should sign the same data twice with the same signature", func() {
+		keyPair, err := (&ECCGenerator{}).Generate(elliptic.P384())
+		Expect(err).To(BeNil(), "Failed to generate ECC key pair")
+		opts := SignOptions{Digest: DigestSHA384, Encoding: EncodingASN1, Deterministic: true}
+
+		first, err := signer.Sign("0_data_c2lnbmF0dXJl", keyPair.Private, keyPair.Public, opts)
+		Expect(err).To(BeNil(), "Failed to sign data")
+		second, err := signer.Sign("0_data_c2lnbmF0dXJl", keyPair.Private, keyPair.Public, opts)
+		Expect(err).To(BeNil(), "Failed to sign data")
+		Expect(first).To(Equal(second), "Deterministic signatures should be reproducible")
+
+		randomized, err := signer.Sign("0_data_c2lnbmF0dXJl", keyPair.Private, keyPair.Public, SignOptions{Digest: DigestSHA384})
+		Expect(err).To(BeNil(), "Failed to sign data")
+		Expect(randomized).ToNot(Equal(first), "Randomized signatures should differ from the deterministic one")
+	})
+
+	It("should only be accepted for ECC devices", func() {
+		_, err := NewECCSigner().ResolveOptions(SignOptions{Deterministic: true}, KeyParameters{Size: 256, Curve: "P-256"})
+		Expect(err).To(BeNil(), "ECC devices should accept deterministic nonces")
+
+		_, err = NewRSASigner().ResolveOptions(SignOptions{Deterministic: true}, KeyParameters{Size: 2048})
+		Expect(err).To(MatchError(ErrInvalidSignOptions), "RSA devices should reject deterministic nonces")
+	})
+})
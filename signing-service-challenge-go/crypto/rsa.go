@@ -4,6 +4,8 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 )
 
 // RSAKeyPair is a DTO that holds RSA private and public keys.
@@ -39,12 +41,31 @@ func (m *RSAMarshaler) Marshal(keyPair RSAKeyPair) ([]byte, []byte, error) {
 	return encodePublic, encodedPrivate, nil
 }
 
-// Unmarshal takes an encoded RSA private key and transforms it into a rsa.PrivateKey.
+// Unmarshal takes an encoded PKCS#1 or PKCS#8 RSA private key and transforms it into a rsa.PrivateKey.
 func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
 	block, _ := pem.Decode(privateKeyBytes)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, err
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block containing the private key")
+	}
+
+	var privateKey *rsa.PrivateKey
+	if block.Type == "PRIVATE KEY" {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		privateKey, ok = key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("the private key is not an RSA key")
+		}
+	} else {
+		var err error
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &RSAKeyPair{
@@ -52,3 +73,86 @@ func (m *RSAMarshaler) Unmarshal(privateKeyBytes []byte) (*RSAKeyPair, error) {
 		Public:  &privateKey.PublicKey,
 	}, nil
 }
+
+// RSACodec converts RSA keys from and to PEM strings.
+type RSACodec struct {
+	marshaler RSAMarshaler
+}
+
+// NewRSACodec creates a new RSACodec.
+func NewRSACodec() RSACodec {
+	return RSACodec{
+		marshaler: NewRSAMarshaler(),
+	}
+}
+
+// EncodePublicKey converts a RSA public key to a PEM string.
+func (c RSACodec) EncodePublicKey(publicKey any) (string, error) {
+	publicKeyRSA, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("failed to assert type of RSA public key")
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKeyRSA)
+	if err != nil {
+		return "", err
+	}
+
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	})
+
+	return string(publicKeyPEM), nil
+}
+
+// DecodePublicKey parses a PEM encoded RSA public key.
+func (c RSACodec) DecodePublicKey(publicKeyBytes []byte) (any, error) {
+	publicKey, err := parsePublicKeyPEM(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyRSA, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA public key", ErrInvalidPublicKey)
+	}
+
+	return publicKeyRSA, nil
+}
+
+// EncodePrivateKey converts a RSA private key to a PEM string.
+func (c RSACodec) EncodePrivateKey(privateKey any) (string, error) {
+	privateKeyRSA, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("failed to assert type of RSA private key")
+	}
+
+	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKeyRSA)
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	return string(privateKeyPEM), nil
+}
+
+// DecodePrivateKey parses a PEM encoded RSA private key and returns the key pair.
+func (c RSACodec) DecodePrivateKey(privateKeyBytes []byte) (any, any, error) {
+	keyPair, err := c.marshaler.Unmarshal(privateKeyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+
+	return keyPair.Public, keyPair.Private, nil
+}
+
+// KeyParameters returns the modulus size of a RSA public key.
+func (c RSACodec) KeyParameters(publicKey any) (KeyParameters, error) {
+	publicKeyRSA, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return KeyParameters{}, fmt.Errorf("failed to assert type of RSA public key")
+	}
+
+	return KeyParameters{Size: publicKeyRSA.N.BitLen()}, nil
+}
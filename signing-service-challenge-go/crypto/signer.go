@@ -3,14 +3,17 @@ package crypto
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"fmt"
 )
 
+// SignerInterface signs data with a private key.
+// ResolveOptions validates the requested options for a key and fills in the defaults of the algorithm.
 type SignerInterface interface {
-	Sign(data string, privateKey, publicKey any) ([]byte, error)
+	ResolveOptions(requested SignOptions, params KeyParameters) (SignOptions, error)
+	Sign(data string, privateKey, publicKey any, opts SignOptions) ([]byte, error)
 }
 
 type ECCSigner struct{}
@@ -19,66 +22,276 @@ func NewECCSigner() *ECCSigner {
 	return &ECCSigner{}
 }
 
-func (s *ECCSigner) Sign(data string, privateKey, publicKey any) ([]byte, error) {
-	// Cast private and public key from any to *rsa.PrivateKey
-	privateKeyCasted, ok := privateKey.(*ecdsa.PrivateKey)
-	if !ok {
-		return []byte{}, fmt.Errorf("failed to assert type of RSA private key")
+// Digest matching the security level of each curve
+var eccDefaultDigests = map[string]string{
+	"P-256": DigestSHA256,
+	"P-384": DigestSHA384,
+	"P-521": DigestSHA512,
+}
+
+func (s *ECCSigner) ResolveOptions(requested SignOptions, params KeyParameters) (SignOptions, error) {
+	if requested.Padding != "" || requested.SaltLength != 0 {
+		return SignOptions{}, fmt.Errorf("%w: ECC signatures do not use padding", ErrInvalidSignOptions)
 	}
-	publicKeyCasted, ok := publicKey.(*ecdsa.PublicKey)
+
+	digest := requested.Digest
+	if digest == "" {
+		digest = eccDefaultDigests[params.Curve]
+	}
+	if _, err := digestHash(digest); err != nil {
+		return SignOptions{}, err
+	}
+
+	encoding := requested.Encoding
+	if encoding == "" {
+		encoding = EncodingASN1
+	}
+	if encoding != EncodingASN1 && encoding != EncodingP1363 {
+		return SignOptions{}, fmt.Errorf("%w: unsupported ECC signature encoding %s, must be %s or %s", ErrInvalidSignOptions, encoding, EncodingASN1, EncodingP1363)
+	}
+
+	return SignOptions{Digest: digest, Encoding: encoding, Deterministic: requested.Deterministic}, nil
+}
+
+func (s *ECCSigner) Sign(data string, privateKey, publicKey any, opts SignOptions) ([]byte, error) {
+	// Cast private key from any to *ecdsa.PrivateKey
+	privateKeyCasted, ok := privateKey.(*ecdsa.PrivateKey)
 	if !ok {
-		return []byte{}, fmt.Errorf("failed to assert type of RSA public key")
+		return []byte{}, fmt.Errorf("failed to assert type of ECC private key")
 	}
 
-	// Calculate the SHA-256 hash of the data
-	hashed := sha256.Sum256([]byte(data))
+	// Calculate the hash of the data with the digest of the device
+	hash, hashed, err := hashData(data, opts)
+	if err != nil {
+		return []byte{}, err
+	}
 
-	// Sign data
-	signature, err := ecdsa.SignASN1(rand.Reader, privateKeyCasted, hashed[:])
+	// Sign data, deriving the nonce from the key and the digest (RFC 6979) when the device is deterministic
+	var signature []byte
+	if opts.Deterministic {
+		signature, err = privateKeyCasted.Sign(nil, hashed, hash)
+	} else {
+		signature, err = ecdsa.SignASN1(rand.Reader, privateKeyCasted, hashed)
+	}
 	if err != nil {
 		return []byte{}, fmt.Errorf("failed signing data: %w", err)
 	}
 
+	// Convert the signature to the raw r||s form if the device requires it
+	if opts.Encoding == EncodingP1363 {
+		signature, err = ECDSASignatureToP1363(signature, privateKeyCasted.Curve)
+		if err != nil {
+			return []byte{}, fmt.Errorf("failed encoding the signature: %w", err)
+		}
+	}
+
 	// Verify if the signature is valid
-	valid := ecdsa.VerifyASN1(publicKeyCasted, hashed[:], signature)
-	if !valid {
+	err = s.Verify(data, signature, publicKey, opts)
+	if err != nil {
 		return []byte{}, fmt.Errorf("failed verifying the signed data: %w", err)
 	}
 
 	return signature, nil
 }
 
+func (s *ECCSigner) Verify(data string, signature []byte, publicKey any, opts SignOptions) error {
+	// Cast public key from any to *ecdsa.PublicKey
+	publicKeyCasted, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("failed to assert type of ECC public key")
+	}
+
+	// Calculate the hash of the data with the digest of the device
+	_, hashed, err := hashData(data, opts)
+	if err != nil {
+		return err
+	}
+
+	// Raw r||s signatures are converted back to ASN.1 to be verified
+	if opts.Encoding == EncodingP1363 {
+		signature, err = ECDSASignatureToASN1(signature, publicKeyCasted.Curve)
+		if err != nil {
+			return fmt.Errorf("invalid ECC signature: %w", err)
+		}
+	}
+
+	if !ecdsa.VerifyASN1(publicKeyCasted, hashed, signature) {
+		return fmt.Errorf("invalid ECC signature")
+	}
+
+	return nil
+}
+
 type RSASigner struct{}
 
 func NewRSASigner() *RSASigner {
 	return &RSASigner{}
 }
 
-func (s *RSASigner) Sign(data string, privateKey, publicKey any) ([]byte, error) {
-	// Cast private and public key from any to *rsa.PrivateKey
+func (s *RSASigner) ResolveOptions(requested SignOptions, params KeyParameters) (SignOptions, error) {
+	if requested.Encoding != "" {
+		return SignOptions{}, fmt.Errorf("%w: RSA signatures do not support a signature encoding", ErrInvalidSignOptions)
+	}
+	if requested.Deterministic {
+		return SignOptions{}, fmt.Errorf("%w: deterministic nonces only apply to ECC signatures", ErrInvalidSignOptions)
+	}
+
+	digest := requested.Digest
+	if digest == "" {
+		digest = DigestSHA256
+	}
+	hash, err := digestHash(digest)
+	if err != nil {
+		return SignOptions{}, err
+	}
+
+	switch requested.Padding {
+	case "", PaddingPKCS1v15:
+		if requested.SaltLength != 0 {
+			return SignOptions{}, fmt.Errorf("%w: salt length only applies to PSS padding", ErrInvalidSignOptions)
+		}
+		return SignOptions{Digest: digest, Padding: PaddingPKCS1v15}, nil
+	case PaddingPSS:
+		// The salt can't be longer than the encoded message minus the hash and two extra bytes
+		maxSaltLength := (params.Size+6)/8 - hash.Size() - 2
+		saltLength := requested.SaltLength
+		if saltLength == 0 {
+			saltLength = hash.Size()
+		}
+		if saltLength < 0 || saltLength > maxSaltLength {
+			return SignOptions{}, fmt.Errorf("%w: PSS salt length must be between 1 and %d bytes", ErrInvalidSignOptions, maxSaltLength)
+		}
+		return SignOptions{Digest: digest, Padding: PaddingPSS, SaltLength: saltLength}, nil
+	default:
+		return SignOptions{}, fmt.Errorf("%w: unsupported RSA padding %s, must be %s or %s", ErrInvalidSignOptions, requested.Padding, PaddingPKCS1v15, PaddingPSS)
+	}
+}
+
+func (s *RSASigner) Sign(data string, privateKey, publicKey any, opts SignOptions) ([]byte, error) {
+	// Cast private key from any to *rsa.PrivateKey
 	privateKeyCasted, ok := privateKey.(*rsa.PrivateKey)
 	if !ok {
 		return []byte{}, fmt.Errorf("failed to assert type of RSA private key")
 	}
+
+	// Calculate the hash of the data with the digest of the device
+	hash, hashed, err := hashData(data, opts)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	// Sign data with the padding scheme of the device
+	var signature []byte
+	switch opts.Padding {
+	case PaddingPSS:
+		signature, err = rsa.SignPSS(rand.Reader, privateKeyCasted, hash, hashed, pssOptions(hash, opts))
+	case "", PaddingPKCS1v15:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, privateKeyCasted, hash, hashed)
+	default:
+		err = fmt.Errorf("%w: unsupported RSA padding %s", ErrInvalidSignOptions, opts.Padding)
+	}
+	if err != nil {
+		return []byte{}, fmt.Errorf("failed signing data: %w", err)
+	}
+
+	// Verify if the signature is valid
+	err = s.Verify(data, signature, publicKey, opts)
+	if err != nil {
+		return []byte{}, fmt.Errorf("failed verifying the signed data: %w", err)
+	}
+
+	return signature, nil
+}
+
+func (s *RSASigner) Verify(data string, signature []byte, publicKey any, opts SignOptions) error {
+	// Cast public key from any to *rsa.PublicKey
 	publicKeyCasted, ok := publicKey.(*rsa.PublicKey)
 	if !ok {
-		return []byte{}, fmt.Errorf("failed to assert type of RSA public key")
+		return fmt.Errorf("failed to assert type of RSA public key")
 	}
 
-	// Calculate the SHA-256 hash of the data
-	hashed := sha256.Sum256([]byte(data))
-
-	// Sign data
-	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKeyCasted, crypto.SHA256, hashed[:])
+	// Calculate the hash of the data with the digest of the device
+	hash, hashed, err := hashData(data, opts)
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed signing data: %w", err)
+		return err
+	}
+
+	switch opts.Padding {
+	case PaddingPSS:
+		return rsa.VerifyPSS(publicKeyCasted, hash, hashed, signature, pssOptions(hash, opts))
+	case "", PaddingPKCS1v15:
+		return rsa.VerifyPKCS1v15(publicKeyCasted, hash, hashed, signature)
+	default:
+		return fmt.Errorf("%w: unsupported RSA padding %s", ErrInvalidSignOptions, opts.Padding)
+	}
+}
+
+// Build the PSS options from the signing options, always using the recorded salt length
+func pssOptions(hash crypto.Hash, opts SignOptions) *rsa.PSSOptions {
+	saltLength := opts.SaltLength
+	if saltLength == 0 {
+		saltLength = rsa.PSSSaltLengthEqualsHash
+	}
+
+	return &rsa.PSSOptions{
+		SaltLength: saltLength,
+		Hash:       hash,
+	}
+}
+
+type ED25519Signer struct{}
+
+func NewED25519Signer() *ED25519Signer {
+	return &ED25519Signer{}
+}
+
+// ResolveOptions only accepts SHA-512, the hash that pure Ed25519 applies internally.
+func (s *ED25519Signer) ResolveOptions(requested SignOptions, params KeyParameters) (SignOptions, error) {
+	if requested.Padding != "" || requested.SaltLength != 0 {
+		return SignOptions{}, fmt.Errorf("%w: ED25519 signatures do not use padding", ErrInvalidSignOptions)
+	}
+	if requested.Encoding != "" {
+		return SignOptions{}, fmt.Errorf("%w: ED25519 signatures do not support a signature encoding", ErrInvalidSignOptions)
+	}
+	if requested.Deterministic {
+		return SignOptions{}, fmt.Errorf("%w: ED25519 signatures are always deterministic", ErrInvalidSignOptions)
 	}
+	if requested.Digest != "" && requested.Digest != DigestSHA512 {
+		return SignOptions{}, fmt.Errorf("%w: ED25519 signatures always use %s", ErrInvalidSignOptions, DigestSHA512)
+	}
+
+	return SignOptions{Digest: DigestSHA512}, nil
+}
+
+func (s *ED25519Signer) Sign(data string, privateKey, publicKey any, opts SignOptions) ([]byte, error) {
+	// Cast private key from any to ed25519.PrivateKey
+	privateKeyCasted, ok := privateKey.(ed25519.PrivateKey)
+	if !ok {
+		return []byte{}, fmt.Errorf("failed to assert type of ED25519 private key")
+	}
+
+	// Ed25519 hashes the message internally, so the data is signed as is
+	signature := ed25519.Sign(privateKeyCasted, []byte(data))
 
 	// Verify if the signature is valid
-	err = rsa.VerifyPKCS1v15(publicKeyCasted, crypto.SHA256, hashed[:], signature)
+	err := s.Verify(data, signature, publicKey, opts)
 	if err != nil {
 		return []byte{}, fmt.Errorf("failed verifying the signed data: %w", err)
 	}
 
 	return signature, nil
 }
+
+func (s *ED25519Signer) Verify(data string, signature []byte, publicKey any, opts SignOptions) error {
+	// Cast public key from any to ed25519.PublicKey
+	publicKeyCasted, ok := publicKey.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("failed to assert type of ED25519 public key")
+	}
+
+	if !ed25519.Verify(publicKeyCasted, []byte(data), signature) {
+		return fmt.Errorf("invalid ED25519 signature")
+	}
+
+	return nil
+}
@@ -1,12 +1,28 @@
 package crypto
 
 type MockSigner struct {
-	SignFunc func(data string, privateKey, publicKey any) ([]byte, error)
+	ResolveOptionsFunc func(requested SignOptions, params KeyParameters) (SignOptions, error)
+	SignFunc           func(data string, privateKey, publicKey any, opts SignOptions) ([]byte, error)
+	VerifyFunc         func(data string, signature []byte, publicKey any, opts SignOptions) error
 }
 
-func (m *MockSigner) Sign(data string, privateKey, publicKey any) ([]byte, error) {
+func (m *MockSigner) ResolveOptions(requested SignOptions, params KeyParameters) (SignOptions, error) {
+	if m.ResolveOptionsFunc != nil {
+		return m.ResolveOptionsFunc(requested, params)
+	}
+	return requested, nil
+}
+
+func (m *MockSigner) Sign(data string, privateKey, publicKey any, opts SignOptions) ([]byte, error) {
 	if m.SignFunc != nil {
-		return m.SignFunc(data, privateKey, publicKey)
+		return m.SignFunc(data, privateKey, publicKey, opts)
 	}
 	return []byte("mock-signature"), nil
 }
+
+func (m *MockSigner) Verify(data string, signature []byte, publicKey any, opts SignOptions) error {
+	if m.VerifyFunc != nil {
+		return m.VerifyFunc(data, signature, publicKey, opts)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RSASigner", func() {
+	var (
+		signer     *RSASigner
+		params     KeyParameters
+		publicKey  *rsa.PublicKey
+		privateKey *rsa.PrivateKey
+	)
+
+	BeforeEach(func() {
+		signer = NewRSASigner()
+		params = KeyParameters{Size: 2048}
+		keyPair, err := (&RSAGenerator{}).Generate(params.Size)
+		Expect(err).To(BeNil(), "Setup failed in BeforeEach")
+		publicKey, privateKey = keyPair.Public, keyPair.Private
+	})
+
+	Describe("ResolveOptions", func() {
+		It("should default to PKCS#1 v1.5 padding", func() {
+			opts, err := signer.ResolveOptions(SignOptions{}, params)
+			Expect(err).To(BeNil(), "Failed to resolve the default options")
+			Expect(opts).To(Equal(SignOptions{Digest: DigestSHA256, Padding: PaddingPKCS1v15}), "The default should be PKCS#1 v1.5 with SHA-256")
+		})
+
+		It("should default the PSS salt length to the hash length", func() {
+			opts, err := signer.ResolveOptions(SignOptions{Padding: PaddingPSS}, params)
+			Expect(err).To(BeNil(), "Failed to resolve the PSS options")
+			Expect(opts).To(Equal(SignOptions{Digest: DigestSHA256, Padding: PaddingPSS, SaltLength: sha256.Size}), "The salt length should equal the SHA-256 size")
+
+			opts, err = signer.ResolveOptions(SignOptions{Digest: DigestSHA512, Padding: PaddingPSS}, params)
+			Expect(err).To(BeNil(), "Failed to resolve the PSS options")
+			Expect(opts.SaltLength).To(Equal(sha512.Size), "The salt length should equal the SHA-512 size")
+		})
+
+		It("should reject invalid combinations", func() {
+			_, err := signer.ResolveOptions(SignOptions{Padding: "OAEP"}, params)
+			Expect(err).To(MatchError(ErrInvalidSignOptions), "Unknown paddings should be rejected")
+
+			_, err = signer.ResolveOptions(SignOptions{Padding: PaddingPKCS1v15, SaltLength: 20}, params)
+			Expect(err).To(MatchError(ErrInvalidSignOptions), "A salt length should be rejected for PKCS#1 v1.5")
+
+			_, err = signer.ResolveOptions(SignOptions{Padding: PaddingPSS, SaltLength: 223}, params)
+			Expect(err).To(MatchError(ErrInvalidSignOptions), "A salt longer than the key allows should be rejected")
+
+			_, err = signer.ResolveOptions(SignOptions{Digest: "MD5"}, params)
+			Expect(err).To(MatchError(ErrInvalidSignOptions), "Unknown digests should be rejected")
+		})
+	})
+
+	Describe("Sign", func() {
+		Context("when using PSS padding", func() {
+			It("should produce a signature verifiable with the recorded salt length", func() {
+				opts := SignOptions{Padding: PaddingPSS, SaltLength: 20}
+				signature, err := signer.Sign("0_data_c2lnbmF0dXJl", privateKey, publicKey, opts)
+				Expect(err).To(BeNil(), "Failed to sign data")
+
+				hashed := sha256.Sum256([]byte("0_data_c2lnbmF0dXJl"))
+				Expect(rsa.VerifyPSS(publicKey, crypto.SHA256, hashed[:], signature, &rsa.PSSOptions{SaltLength: 20})).To(Succeed(), "The signature should be a valid PSS signature")
+				Expect(rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signature)).ToNot(Succeed(), "The signature should not be a PKCS#1 v1.5 signature")
+				Expect(signer.Verify("0_data_c2lnbmF0dXJl", signature, publicKey, SignOptions{Padding: PaddingPSS, SaltLength: 32})).ToNot(Succeed(), "The signature should not verify with another salt length")
+			})
+		})
+
+		Context("when using another digest", func() {
+			It("should hash the data with the selected digest", func() {
+				for _, digest := range []string{DigestSHA256, DigestSHA384, DigestSHA512, DigestSHA3_256} {
+					for _, padding := range []string{PaddingPKCS1v15, PaddingPSS} {
+						opts, err := signer.ResolveOptions(SignOptions{Digest: digest, Padding: padding}, params)
+						Expect(err).To(BeNil(), "Failed to resolve the options for "+digest)
+						signature, err := signer.Sign("0_data_c2lnbmF0dXJl", privateKey, publicKey, opts)
+						Expect(err).To(BeNil(), "Failed to sign data with "+digest)
+						Expect(signer.Verify("0_data_c2lnbmF0dXJl", signature, publicKey, opts)).To(Succeed(), "The signature should be valid with "+digest)
+					}
+				}
+
+				opts := SignOptions{Digest: DigestSHA384, Padding: PaddingPKCS1v15}
+				signature, err := signer.Sign("0_data_c2lnbmF0dXJl", privateKey, publicKey, opts)
+				Expect(err).To(BeNil(), "Failed to sign data")
+				hashed := sha512.Sum384([]byte("0_data_c2lnbmF0dXJl"))
+				Expect(rsa.VerifyPKCS1v15(publicKey, crypto.SHA384, hashed[:], signature)).To(Succeed(), "The signature should be made over the SHA-384 digest")
+			})
+		})
+
+		Context("when using PKCS#1 v1.5 padding", func() {
+			It("should produce a deterministic signature", func() {
+				opts := SignOptions{Padding: PaddingPKCS1v15}
+				first, err := signer.Sign("0_data_c2lnbmF0dXJl", privateKey, publicKey, opts)
+				Expect(err).To(BeNil(), "Failed to sign data")
+				second, err := signer.Sign("0_data_c2lnbmF0dXJl", privateKey, publicKey, opts)
+				Expect(err).To(BeNil(), "Failed to sign data")
+				Expect(first).To(Equal(second), "PKCS#1 v1.5 signatures should be deterministic")
+			})
+		})
+	})
+})
+
+var _ = Describe("ECCSigner", func() {
+	var signer *ECCSigner
+
+	BeforeEach(func() {
+		signer = NewECCSigner()
+	})
+
+	Describe("ResolveOptions", func() {
+		It("should default to the digest matching the curve", func() {
+			for curve, digest := range map[string]string{"P-256": DigestSHA256, "P-384": DigestSHA384, "P-521": DigestSHA512} {
+				opts, err := signer.ResolveOptions(SignOptions{}, KeyParameters{Curve: curve})
+				Expect(err).To(BeNil(), "Failed to resolve the default options for "+curve)
+				Expect(opts.Digest).To(Equal(digest), "Unexpected default digest for "+curve)
+			}
+		})
+
+		It("should reject RSA padding", func() {
+			_, err := signer.ResolveOptions(SignOptions{Padding: PaddingPSS}, KeyParameters{Curve: "P-256"})
+			Expect(err).To(MatchError(ErrInvalidSignOptions), "Padding should be rejected for ECC")
+		})
+	})
+
+	Describe("Sign", func() {
+		It("should hash the data with the selected digest", func() {
+			keyPair, err := (&ECCGenerator{}).Generate(elliptic.P384())
+			Expect(err).To(BeNil(), "Failed to generate ECC key pair")
+
+			signature, err := signer.Sign("0_data_c2lnbmF0dXJl", keyPair.Private, keyPair.Public, SignOptions{Digest: DigestSHA3_256})
+			Expect(err).To(BeNil(), "Failed to sign data")
+
+			hashed := sha3.Sum256([]byte("0_data_c2lnbmF0dXJl"))
+			Expect(ecdsa.VerifyASN1(keyPair.Public, hashed[:], signature)).To(BeTrue(), "The signature should be made over the SHA3-256 digest")
+		})
+	})
+})
+
+var _ = Describe("ED25519Signer", func() {
+	It("should only accept SHA-512", func() {
+		signer := NewED25519Signer()
+
+		opts, err := signer.ResolveOptions(SignOptions{}, KeyParameters{Size: 256})
+		Expect(err).To(BeNil(), "Failed to resolve the default options")
+		Expect(opts.Digest).To(Equal(DigestSHA512), "Ed25519 should report SHA-512")
+
+		_, err = signer.ResolveOptions(SignOptions{Digest: DigestSHA256}, KeyParameters{Size: 256})
+		Expect(err).To(MatchError(ErrInvalidSignOptions), "Other digests should be rejected")
+	})
+})
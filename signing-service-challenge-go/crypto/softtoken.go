@@ -0,0 +1,182 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SoftToken is an in-process Token for development and tests. Like a hardware token, it never returns
+// the private keys it holds, but they only live in memory.
+type SoftToken struct {
+	objects    map[ObjectHandle]tokenObject
+	nextHandle ObjectHandle
+	mu         sync.RWMutex
+}
+
+// tokenObject is a key stored on a SoftToken.
+type tokenObject struct {
+	class ObjectClass
+	id    []byte
+	key   any
+}
+
+// NewSoftToken creates an empty SoftToken.
+func NewSoftToken() *SoftToken {
+	return &SoftToken{
+		objects:    make(map[ObjectHandle]tokenObject),
+		nextHandle: 1,
+	}
+}
+
+// GenerateKeyPair generates a key pair with an EC, EC Edwards or RSA key pair generation mechanism.
+func (t *SoftToken) GenerateKeyPair(mechanism Mechanism, template KeyTemplate) (ObjectHandle, ObjectHandle, error) {
+	var privateKey any
+	var err error
+	switch mechanism.Type {
+	case MechanismECKeyPairGen:
+		curve, exists := eccCurves[template.Curve]
+		if !exists {
+			return 0, 0, fmt.Errorf("unsupported EC parameters %q", template.Curve)
+		}
+		privateKey, err = ecdsa.GenerateKey(curve, rand.Reader)
+	case MechanismRSAPKCSKeyPairGen:
+		privateKey, err = rsa.GenerateKey(rand.Reader, template.ModulusBits)
+	case MechanismECEdwardsKeyPairGen:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return 0, 0, fmt.Errorf("unsupported key pair generation mechanism 0x%04x", mechanism.Type)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return t.CreateKeyPair(template, privateKey)
+}
+
+// CreateKeyPair stores an existing private key and its public key on the token.
+func (t *SoftToken) CreateKeyPair(template KeyTemplate, privateKey any) (ObjectHandle, ObjectHandle, error) {
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return 0, 0, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	if len(template.ID) == 0 {
+		return 0, 0, errors.New("key pairs must have an ID")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, object := range t.objects {
+		if bytes.Equal(object.id, template.ID) {
+			return 0, 0, fmt.Errorf("a key pair with ID %q already exists", template.ID)
+		}
+	}
+
+	publicHandle := t.store(tokenObject{class: ClassPublicKey, id: template.ID, key: signer.Public()})
+	privateHandle := t.store(tokenObject{class: ClassPrivateKey, id: template.ID, key: privateKey})
+
+	return publicHandle, privateHandle, nil
+}
+
+// FindObject looks up the object of a class with the given CKA_ID.
+func (t *SoftToken) FindObject(class ObjectClass, id []byte) (ObjectHandle, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for handle, object := range t.objects {
+		if object.class == class && bytes.Equal(object.id, id) {
+			return handle, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: class 0x%x, ID %q", ErrObjectNotFound, class, id)
+}
+
+// PublicKey returns the key of a public key object.
+func (t *SoftToken) PublicKey(handle ObjectHandle) (any, error) {
+	object, err := t.object(handle, ClassPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.key, nil
+}
+
+// Sign signs the data with a private key object. ECDSA signatures are returned in their raw r||s form.
+func (t *SoftToken) Sign(mechanism Mechanism, handle ObjectHandle, data []byte) ([]byte, error) {
+	object, err := t.object(handle, ClassPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mechanism.Type {
+	case MechanismECDSA:
+		privateKey, ok := object.key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("CKM_ECDSA requires an EC key")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, privateKey, data)
+		if err != nil {
+			return nil, err
+		}
+		size := (privateKey.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		return signature, nil
+	case MechanismRSAPKCS:
+		privateKey, ok := object.key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("CKM_RSA_PKCS requires an RSA key")
+		}
+		// Without a hash function the data, a DigestInfo, is padded and signed as is
+		return rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.Hash(0), data)
+	case MechanismRSAPKCSPSS:
+		privateKey, ok := object.key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("CKM_RSA_PKCS_PSS requires an RSA key")
+		}
+		params, ok := mechanism.Parameter.(PSSParams)
+		if !ok {
+			return nil, errors.New("CKM_RSA_PKCS_PSS requires PSS parameters")
+		}
+		return rsa.SignPSS(rand.Reader, privateKey, params.Hash, data, &rsa.PSSOptions{SaltLength: params.SaltLength, Hash: params.Hash})
+	case MechanismEdDSA:
+		privateKey, ok := object.key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("CKM_EDDSA requires an EC Edwards key")
+		}
+		return ed25519.Sign(privateKey, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported signing mechanism 0x%04x", mechanism.Type)
+	}
+}
+
+// Store an object under a new handle, the caller must hold the lock
+func (t *SoftToken) store(object tokenObject) ObjectHandle {
+	handle := t.nextHandle
+	t.nextHandle++
+	t.objects[handle] = object
+
+	return handle
+}
+
+// Look up an object, checking that it has the expected class
+func (t *SoftToken) object(handle ObjectHandle, class ObjectClass) (tokenObject, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	object, exists := t.objects[handle]
+	if !exists || object.class != class {
+		return tokenObject{}, fmt.Errorf("%w: handle %d", ErrObjectNotFound, handle)
+	}
+
+	return object, nil
+}
@@ -0,0 +1,249 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MasterKeySize is the size in bytes of the AES-256 master keys.
+const MasterKeySize = 32
+
+// envelopeVersion identifies the format of the wrapped keys, in case it has to change.
+const envelopeVersion = 1
+
+// ErrKeyUnwrap is returned when a wrapped key cannot be decrypted, e.g. because it was tampered with,
+// it belongs to another device or its master key is not loaded.
+var ErrKeyUnwrap = errors.New("failed to unwrap key")
+
+// KeyWrapperInterface encrypts private keys at rest.
+// The associated data binds a wrapped key to its owner, so it cannot be moved to another device.
+type KeyWrapperInterface interface {
+	Wrap(plaintext, associatedData []byte) ([]byte, error)
+	Unwrap(wrapped, associatedData []byte) ([]byte, error)
+	Rewrap(wrapped, associatedData []byte) ([]byte, error)
+}
+
+// MasterKey is an AES-256 key used to wrap data keys, identified by its ID.
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// KeyWrapper implements envelope encryption with AES-GCM: every key is encrypted with a fresh data key,
+// and the data key is encrypted with the active master key. Wrapped keys record the ID of their master key,
+// so keys wrapped by previous master keys can still be unwrapped after the active one is rotated.
+type KeyWrapper struct {
+	activeID   string
+	masterKeys map[string]cipher.AEAD
+}
+
+// envelope is the stored form of a wrapped key.
+// DataKey and Ciphertext hold the GCM nonce followed by the sealed data.
+type envelope struct {
+	Version     int    `json:"v"`
+	MasterKeyID string `json:"kid"`
+	DataKey     []byte `json:"dek"`
+	Ciphertext  []byte `json:"ct"`
+}
+
+// NewKeyWrapper creates a KeyWrapper that wraps keys with the active master key
+// and can still unwrap keys wrapped with the previous ones.
+func NewKeyWrapper(active MasterKey, previous ...MasterKey) (*KeyWrapper, error) {
+	w := &KeyWrapper{
+		activeID:   active.ID,
+		masterKeys: make(map[string]cipher.AEAD),
+	}
+	for _, masterKey := range append([]MasterKey{active}, previous...) {
+		if masterKey.ID == "" {
+			return nil, errors.New("master keys must have an ID")
+		}
+		if _, exists := w.masterKeys[masterKey.ID]; exists {
+			return nil, fmt.Errorf("duplicated master key ID %q", masterKey.ID)
+		}
+		if len(masterKey.Key) != MasterKeySize {
+			return nil, fmt.Errorf("master key %q must be %d bytes long", masterKey.ID, MasterKeySize)
+		}
+
+		aead, err := newGCM(masterKey.Key)
+		if err != nil {
+			return nil, err
+		}
+		w.masterKeys[masterKey.ID] = aead
+	}
+
+	return w, nil
+}
+
+// NewEphemeralKeyWrapper creates a KeyWrapper with a random master key that only lives in memory.
+func NewEphemeralKeyWrapper() *KeyWrapper {
+	masterKey := NewEphemeralMasterKey()
+	w, err := NewKeyWrapper(masterKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return w
+}
+
+// NewEphemeralMasterKey generates a random master key.
+func NewEphemeralMasterKey() MasterKey {
+	key := make([]byte, MasterKeySize)
+	rand.Read(key)
+	id := make([]byte, 4)
+	rand.Read(id)
+
+	return MasterKey{ID: "ephemeral-" + hex.EncodeToString(id), Key: key}
+}
+
+// ParseMasterKeys parses a comma separated list of master keys in the form "id:base64key".
+// The first key of the list is the active one.
+func ParseMasterKeys(spec string) ([]MasterKey, error) {
+	var masterKeys []MasterKey
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, encoded, found := strings.Cut(entry, ":")
+		if !found || id == "" {
+			return nil, fmt.Errorf("invalid master key %q, expected id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %q: %w", id, err)
+		}
+		masterKeys = append(masterKeys, MasterKey{ID: id, Key: key})
+	}
+
+	return masterKeys, nil
+}
+
+// ActiveKeyID returns the ID of the master key used to wrap new keys.
+func (w *KeyWrapper) ActiveKeyID() string {
+	return w.activeID
+}
+
+// Wrap encrypts the plaintext with a new data key and wraps the data key with the active master key.
+func (w *KeyWrapper) Wrap(plaintext, associatedData []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(aead, plaintext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.wrapDataKey(dataKey, ciphertext)
+}
+
+// Unwrap decrypts a wrapped key with the master key it was wrapped with.
+func (w *KeyWrapper) Unwrap(wrapped, associatedData []byte) ([]byte, error) {
+	env, dataKey, err := w.unwrapDataKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(aead, env.Ciphertext, associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyUnwrap, err)
+	}
+
+	return plaintext, nil
+}
+
+// Rewrap wraps the data key of a wrapped key with the active master key, leaving the encrypted key untouched.
+// The associated data is checked before the key is rewrapped.
+func (w *KeyWrapper) Rewrap(wrapped, associatedData []byte) ([]byte, error) {
+	if _, err := w.Unwrap(wrapped, associatedData); err != nil {
+		return nil, err
+	}
+
+	env, dataKey, err := w.unwrapDataKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.wrapDataKey(dataKey, env.Ciphertext)
+}
+
+// Wrap the data key with the active master key and build the envelope
+func (w *KeyWrapper) wrapDataKey(dataKey, ciphertext []byte) ([]byte, error) {
+	wrappedDataKey, err := seal(w.masterKeys[w.activeID], dataKey, []byte(w.activeID))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope{
+		Version:     envelopeVersion,
+		MasterKeyID: w.activeID,
+		DataKey:     wrappedDataKey,
+		Ciphertext:  ciphertext,
+	})
+}
+
+// Parse the envelope and unwrap its data key with the master key it names
+func (w *KeyWrapper) unwrapDataKey(wrapped []byte) (envelope, []byte, error) {
+	var env envelope
+	if err := json.Unmarshal(wrapped, &env); err != nil {
+		return envelope{}, nil, fmt.Errorf("%w: invalid envelope: %v", ErrKeyUnwrap, err)
+	}
+	if env.Version != envelopeVersion {
+		return envelope{}, nil, fmt.Errorf("%w: unsupported envelope version %d", ErrKeyUnwrap, env.Version)
+	}
+
+	masterKey, exists := w.masterKeys[env.MasterKeyID]
+	if !exists {
+		return envelope{}, nil, fmt.Errorf("%w: unknown master key %q", ErrKeyUnwrap, env.MasterKeyID)
+	}
+	dataKey, err := open(masterKey, env.DataKey, []byte(env.MasterKeyID))
+	if err != nil {
+		return envelope{}, nil, fmt.Errorf("%w: %v", ErrKeyUnwrap, err)
+	}
+
+	return env, dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypt with a random nonce, which is prepended to the sealed data
+func seal(aead cipher.AEAD, plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func open(aead cipher.AEAD, sealed, associatedData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], associatedData)
+}
@@ -0,0 +1,29 @@
+package crypto
+
+// MockKeyWrapper is a mock implementation of KeyWrapperInterface that returns the keys unchanged by default
+type MockKeyWrapper struct {
+	WrapFunc   func(plaintext, associatedData []byte) ([]byte, error)
+	UnwrapFunc func(wrapped, associatedData []byte) ([]byte, error)
+	RewrapFunc func(wrapped, associatedData []byte) ([]byte, error)
+}
+
+func (m *MockKeyWrapper) Wrap(plaintext, associatedData []byte) ([]byte, error) {
+	if m.WrapFunc != nil {
+		return m.WrapFunc(plaintext, associatedData)
+	}
+	return plaintext, nil
+}
+
+func (m *MockKeyWrapper) Unwrap(wrapped, associatedData []byte) ([]byte, error) {
+	if m.UnwrapFunc != nil {
+		return m.UnwrapFunc(wrapped, associatedData)
+	}
+	return wrapped, nil
+}
+
+func (m *MockKeyWrapper) Rewrap(wrapped, associatedData []byte) ([]byte, error) {
+	if m.RewrapFunc != nil {
+		return m.RewrapFunc(wrapped, associatedData)
+	}
+	return wrapped, nil
+}
@@ -15,21 +15,43 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/all": {
+        "/v0/device/": {
             "get": {
-                "description": "Retrieves all the devices and its details.",
+                "description": "Retrieves a device by its ID and returns its details.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Get all the devices",
+                "summary": "Get a device",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceId",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "Devices successfully retrieved",
+                        "description": "Device successfully retrieved",
                         "schema": {
-                            "$ref": "#/definitions/api.GetAllDevicesResponse"
+                            "$ref": "#/definitions/api.GetDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
@@ -41,28 +63,26 @@ const docTemplate = `{
                 }
             }
         },
-        "/health": {
+        "/v0/device/all": {
             "get": {
-                "description": "Evaluates the health of the service and returns a standardized response.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Retrieves all the devices and its details.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Health"
+                    "Devices"
                 ],
-                "summary": "Check the health of the service",
+                "summary": "Get all the devices",
+                "deprecated": true,
                 "responses": {
                     "200": {
-                        "description": "Service is healthy",
+                        "description": "Devices successfully retrieved",
                         "schema": {
-                            "$ref": "#/definitions/api.HealthResponse"
+                            "$ref": "#/definitions/api.GetAllDevicesResponse"
                         }
                     },
-                    "405": {
-                        "description": "Method not allowed",
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -70,87 +90,91 @@ const docTemplate = `{
                 }
             }
         },
-        "/new-device": {
-            "post": {
-                "description": "Creates a new signature device with the specified parameters",
+        "/v0/device/audit": {
+            "get": {
+                "description": "Walks every stored signature of the device and checks that each one verifies, that the counters are contiguous from the start of the chain, that each signature references its predecessor and that the first one is chained to the base64 encoded device ID. Gaps and breaks are reported as issues.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Create a new signature device",
+                "summary": "Audit the signature chain of a device",
+                "deprecated": true,
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Algorithm (ECC or RSA)",
-                        "name": "algorithm",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Label for the device",
-                        "name": "label",
+                        "description": "Device ID",
+                        "name": "deviceId",
                         "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Audit report",
                         "schema": {
-                            "$ref": "#/definitions/api.CreateDeviceResponse"
+                            "$ref": "#/definitions/api.ChainAuditResponse"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Invalid input data",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "Internal server error",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/sign/{deviceId}": {
+        "/v0/device/export-key": {
             "post": {
-                "description": "Signs a transaction using the specified device ID and data payload.",
+                "description": "Returns the private key of a device as a password protected PKCS#8 PEM block. Exporting keys must be enabled in the server configuration and every attempt is audited.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Sign a transaction",
+                "summary": "Export the private key of a device",
+                "deprecated": true,
                 "parameters": [
                     {
                         "type": "string",
                         "description": "Device ID",
                         "name": "deviceId",
-                        "in": "path",
+                        "in": "query",
                         "required": true
                     },
                     {
-                        "description": "Data to be signed",
-                        "name": "data",
+                        "description": "Password protecting the exported key",
+                        "name": "password",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/api.ExportKeyRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Signature successfully generated",
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/api.SignaturedDataResponse"
+                            "$ref": "#/definitions/api.ExportKeyResponse"
                         }
                     },
                     "400": {
@@ -159,6 +183,12 @@ const docTemplate = `{
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
                     },
+                    "403": {
+                        "description": "Key export disabled or not supported by the key store",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
                     "404": {
                         "description": "Device not found",
                         "schema": {
@@ -174,30 +204,85 @@ const docTemplate = `{
                 }
             }
         },
-        "/{deviceId}": {
+        "/v0/device/import-device": {
+            "post": {
+                "description": "Creates a signature device from an existing private key, resuming its signature chain from the given counter and last signature. The secured data format defaults to v1.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Import a signature device",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "description": "Device to import",
+                        "name": "device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ImportDeviceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.GetDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v0/device/key": {
             "get": {
-                "description": "Retrieves a device by its ID and returns its details.",
+                "description": "Retrieves the current or a previous public key of a device by its key ID, with the signature counters it covers.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Devices"
                 ],
-                "summary": "Get a device",
+                "summary": "Get a key of a device",
+                "deprecated": true,
                 "parameters": [
                     {
                         "type": "string",
                         "description": "Device ID",
                         "name": "deviceId",
-                        "in": "path",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "keyId",
+                        "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Device successfully retrieved",
+                        "description": "Key successfully retrieved",
                         "schema": {
-                            "$ref": "#/definitions/api.GetDeviceResponse"
+                            "$ref": "#/definitions/api.DeviceKeyResponse"
                         }
                     },
                     "400": {
@@ -207,7 +292,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Device not found",
+                        "description": "Device or key not found",
                         "schema": {
                             "$ref": "#/definitions/api.ErrorResponse"
                         }
@@ -220,75 +305,1312 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "api.CreateDeviceResponse": {
-            "type": "object",
-            "properties": {
-                "algorithm": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string"
-                },
-                "label": {
-                    "type": "string"
-                },
-                "privateKey": {
-                    "type": "string"
-                },
-                "publicKey": {
-                    "type": "string"
-                }
-            }
         },
-        "api.ErrorResponse": {
-            "type": "object",
-            "properties": {
-                "errors": {
-                    "type": "array",
-                    "items": {
-                        "type": "string"
+        "/v0/device/new-device": {
+            "post": {
+                "description": "Creates a new signature device with the specified parameters",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Create a new signature device",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Algorithm (ECC, ED25519 or RSA)",
+                        "name": "algorithm",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Label for the device",
+                        "name": "label",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Key size in bits (RSA: 2048, 3072 or 4096, ECC: 256, 384 or 521)",
+                        "name": "keySize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Curve for ECC devices (P-256, P-384 or P-521)",
+                        "name": "curve",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Digest used for signing (SHA-256, SHA-384, SHA-512 or SHA3-256), defaults to the one matching the key",
+                        "name": "digest",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Padding scheme for RSA devices (PKCS1v15 or PSS)",
+                        "name": "padding",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Salt length in bytes for RSA-PSS devices (defaults to the hash length)",
+                        "name": "saltLength",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signature encoding for ECC devices (ASN1 for DER or P1363 for raw r||s), defaults to ASN1",
+                        "name": "encoding",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Derive the ECDSA nonce from the key and the data (RFC 6979) instead of drawing it at random",
+                        "name": "deterministic",
+                        "in": "query"
                     }
-                }
-            }
-        },
-        "api.GetAllDevicesResponse": {
-            "type": "object",
-            "properties": {
-                "devices": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/api.GetDeviceResponse"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
-                },
-                "total": {
-                    "type": "integer"
                 }
             }
         },
-        "api.GetDeviceResponse": {
-            "type": "object",
-            "properties": {
-                "algorithm": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string"
-                },
-                "label": {
-                    "type": "string"
-                },
-                "lastSignature": {
+        "/v0/device/rotate-key": {
+            "post": {
+                "description": "Replaces the key pair of a device with a new one. The rotation is signed by the old key as the next record of the signature chain, which the new key then continues. Previous public keys stay available by key ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Rotate the key of a device",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceId",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.GetDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Device modified concurrently",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v0/device/sign": {
+            "get": {
+                "description": "Signs a transaction using the specified device ID and data payload.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Sign a transaction",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceId",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "Data to be signed",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SignTransactionRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key making retries of the request return the first signature instead of signing again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Signature successfully generated",
+                        "schema": {
+                            "$ref": "#/definitions/api.SignaturedDataResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Device signing concurrently",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Idempotency key used with different data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v0/device/signature": {
+            "get": {
+                "description": "Retrieves the journaled signature of a device with the given signature counter.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Get a signature of a device",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceId",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Signature counter",
+                        "name": "counter",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Signature successfully retrieved",
+                        "schema": {
+                            "$ref": "#/definitions/api.SignatureResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device or signature not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v0/device/signatures": {
+            "get": {
+                "description": "Retrieves a page of the journaled signatures of a device, in the order they were issued.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "List the signatures of a device",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceId",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of signatures to skip, defaults to 0",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of signatures to return, defaults to 50 and at most 500",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Signatures successfully retrieved",
+                        "schema": {
+                            "$ref": "#/definitions/api.ListSignaturesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v0/device/verify": {
+            "post": {
+                "description": "Checks that a signature was issued by the device for the signed data, in the v1 format \"\u003ccounter\u003e_\u003cdata\u003e_\u003clast_signature\u003e\" or the v2 format \"v2_\u003ccounter\u003e_\u003ctime\u003e_\u003calgorithm\u003e_\u003cdata length\u003e_\u003cdata\u003e_\u003clast_signature\u003e\", using the key of the device that was active for the counter.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices"
+                ],
+                "summary": "Verify a signature",
+                "deprecated": true,
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "deviceId",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "description": "Signed data and base64 encoded signature",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.VerifySignatureRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Verification result, including the reason an invalid signature was rejected",
+                        "schema": {
+                            "$ref": "#/definitions/api.VerifySignatureResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v0/health": {
+            "get": {
+                "description": "Evaluates the health of the service and returns a standardized response.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Check the health of the service",
+                "responses": {
+                    "200": {
+                        "description": "Service is healthy",
+                        "schema": {
+                            "$ref": "#/definitions/api.HealthResponse"
+                        }
+                    },
+                    "405": {
+                        "description": "Method not allowed",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices": {
+            "get": {
+                "description": "Retrieves all the devices and their details.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "List the devices",
+                "responses": {
+                    "200": {
+                        "description": "Devices successfully retrieved",
+                        "schema": {
+                            "$ref": "#/definitions/api.GetAllDevicesResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a new signature device with a new key pair, under the ID chosen by the client or a random one. The key parameters and signing options default to the ones of the algorithm, and the secured data format to v1.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Create a new signature device",
+                "parameters": [
+                    {
+                        "description": "Device to create",
+                        "name": "device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateDeviceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.CreateDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data or unsupported secured data format",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "A device with the ID already exists",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}": {
+            "get": {
+                "description": "Retrieves a device by its ID and returns its details.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Get a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Device successfully retrieved",
+                        "schema": {
+                            "$ref": "#/definitions/api.GetDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}/audit": {
+            "get": {
+                "description": "Walks every stored signature of the device and checks that each one verifies, that the counters are contiguous from the start of the chain, that each signature references its predecessor and that the first one is chained to the base64 encoded device ID. Gaps and breaks are reported as issues.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Audit the signature chain of a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Audit report",
+                        "schema": {
+                            "$ref": "#/definitions/api.ChainAuditResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}/key-exports": {
+            "post": {
+                "description": "Returns the private key of a device as a password protected PKCS#8 PEM block. Exporting keys must be enabled in the server configuration and every attempt is audited.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Export the private key of a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Password protecting the exported key",
+                        "name": "password",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ExportKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/api.ExportKeyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Key export disabled or not supported by the key store",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}/keys/{keyId}": {
+            "get": {
+                "description": "Retrieves the current or a previous public key of a device by its key ID, with the signature counters it covers.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Get a key of a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key ID, e.g. \u003cdevice ID\u003e/1",
+                        "name": "keyId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Key successfully retrieved",
+                        "schema": {
+                            "$ref": "#/definitions/api.DeviceKeyResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device or key not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}/rotations": {
+            "post": {
+                "description": "Replaces the key pair of a device with a new one. The rotation is signed by the old key as the next record of the signature chain, which the new key then continues. Previous public keys stay available by key ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Rotate the key of a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.GetDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Device modified concurrently",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}/signatures": {
+            "get": {
+                "description": "Retrieves a page of the journaled signatures of a device, in the order they were issued.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "List the signatures of a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of signatures to skip, defaults to 0",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of signatures to return, defaults to 50 and at most 500",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Signatures successfully retrieved",
+                        "schema": {
+                            "$ref": "#/definitions/api.ListSignaturesResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Signs the data with the device, chaining the signature to the previous one of the device.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Sign a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Data to be signed",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.SignTransactionRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key making retries of the request return the first signature instead of signing again",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Signature successfully generated",
+                        "schema": {
+                            "$ref": "#/definitions/api.SignaturedDataResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Device signing concurrently",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Idempotency key used with different data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}/signatures/{counter}": {
+            "get": {
+                "description": "Retrieves the journaled signature of a device with the given signature counter.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Get a signature of a device",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Signature counter",
+                        "name": "counter",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Signature successfully retrieved",
+                        "schema": {
+                            "$ref": "#/definitions/api.SignatureResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device or signature not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices/{id}/verifications": {
+            "post": {
+                "description": "Checks that a signature was issued by the device for the signed data, in the v1 format \"\u003ccounter\u003e_\u003cdata\u003e_\u003clast_signature\u003e\" or the v2 format \"v2_\u003ccounter\u003e_\u003ctime\u003e_\u003calgorithm\u003e_\u003cdata length\u003e_\u003cdata\u003e_\u003clast_signature\u003e\", using the key of the device that was active for the counter.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Verify a signature",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Device ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Signed data and base64 encoded signature",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.VerifySignatureRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Verification result, including the reason an invalid signature was rejected",
+                        "schema": {
+                            "$ref": "#/definitions/api.VerifySignatureResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Device not found",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/devices:import": {
+            "post": {
+                "description": "Creates a signature device from an existing private key, resuming its signature chain from the given counter and last signature. The secured data format defaults to v1.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Devices v1"
+                ],
+                "summary": "Import a signature device",
+                "parameters": [
+                    {
+                        "description": "Device to import",
+                        "name": "device",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/api.ImportDeviceRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/api.GetDeviceResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input data",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/api.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "api.ChainAuditResponse": {
+            "type": "object",
+            "properties": {
+                "deviceId": {
+                    "type": "string"
+                },
+                "firstCounter": {
+                    "type": "integer"
+                },
+                "intact": {
+                    "type": "boolean"
+                },
+                "issues": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.ChainIssueResponse"
+                    }
+                },
+                "records": {
+                    "type": "integer"
+                },
+                "signatureCounter": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.ChainIssueResponse": {
+            "type": "object",
+            "properties": {
+                "counter": {
+                    "type": "integer"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreateDeviceRequest": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "curve": {
+                    "type": "string"
+                },
+                "deterministic": {
+                    "type": "boolean"
+                },
+                "digest": {
+                    "type": "string"
+                },
+                "encoding": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "keySize": {
+                    "type": "integer"
+                },
+                "label": {
+                    "type": "string"
+                },
+                "padding": {
+                    "type": "string"
+                },
+                "saltLength": {
+                    "type": "integer"
+                },
+                "securedDataFormat": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.CreateDeviceResponse": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "curve": {
+                    "type": "string"
+                },
+                "deterministic": {
+                    "type": "boolean"
+                },
+                "digest": {
+                    "type": "string"
+                },
+                "encoding": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "keyId": {
+                    "type": "string"
+                },
+                "keySize": {
+                    "type": "integer"
+                },
+                "label": {
+                    "type": "string"
+                },
+                "padding": {
+                    "type": "string"
+                },
+                "publicKey": {
+                    "type": "string"
+                },
+                "saltLength": {
+                    "type": "integer"
+                },
+                "securedDataFormat": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.DeviceKeyResponse": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "firstCounter": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "lastCounter": {
+                    "type": "integer"
+                },
+                "publicKey": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code is a stable machine-readable identifier of the error, e.g. \"device_not_found\"",
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "api.ExportKeyRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.ExportKeyResponse": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "id": {
                     "type": "string"
                 },
                 "privateKey": {
                     "type": "string"
+                }
+            }
+        },
+        "api.GetAllDevicesResponse": {
+            "type": "object",
+            "properties": {
+                "devices": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.GetDeviceResponse"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.GetDeviceResponse": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "curve": {
+                    "type": "string"
+                },
+                "deterministic": {
+                    "type": "boolean"
+                },
+                "digest": {
+                    "type": "string"
+                },
+                "encoding": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "keyId": {
+                    "type": "string"
+                },
+                "keySize": {
+                    "type": "integer"
+                },
+                "label": {
+                    "type": "string"
+                },
+                "lastSignature": {
+                    "type": "string"
+                },
+                "padding": {
+                    "type": "string"
+                },
+                "previousKeys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.DeviceKeyResponse"
+                    }
                 },
                 "publicKey": {
                     "type": "string"
                 },
+                "saltLength": {
+                    "type": "integer"
+                },
+                "securedDataFormat": {
+                    "type": "string"
+                },
                 "signatureCounter": {
                     "type": "integer"
                 }
@@ -305,9 +1627,113 @@ const docTemplate = `{
                 }
             }
         },
+        "api.ImportDeviceRequest": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "deterministic": {
+                    "type": "boolean"
+                },
+                "digest": {
+                    "type": "string"
+                },
+                "encoding": {
+                    "type": "string"
+                },
+                "label": {
+                    "type": "string"
+                },
+                "lastSignature": {
+                    "type": "string"
+                },
+                "padding": {
+                    "type": "string"
+                },
+                "privateKey": {
+                    "type": "string"
+                },
+                "saltLength": {
+                    "type": "integer"
+                },
+                "securedDataFormat": {
+                    "type": "string"
+                },
+                "signatureCounter": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.ListSignaturesResponse": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "signatures": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/api.SignatureResponse"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "api.SignTransactionRequest": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.SignatureResponse": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "counter": {
+                    "type": "integer"
+                },
+                "data": {
+                    "type": "string"
+                },
+                "deviceId": {
+                    "type": "string"
+                },
+                "keyId": {
+                    "type": "string"
+                },
+                "signature": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "signed_data": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                }
+            }
+        },
         "api.SignaturedDataResponse": {
             "type": "object",
             "properties": {
+                "digest": {
+                    "type": "string"
+                },
+                "encoding": {
+                    "type": "string"
+                },
                 "signature": {
                     "type": "array",
                     "items": {
@@ -318,6 +1744,49 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "api.VerifySignatureRequest": {
+            "type": "object",
+            "properties": {
+                "signature": {
+                    "type": "string"
+                },
+                "signed_data": {
+                    "type": "string"
+                }
+            }
+        },
+        "api.VerifySignatureResponse": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "type": "string"
+                },
+                "counter": {
+                    "type": "integer"
+                },
+                "data": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "keyId": {
+                    "type": "string"
+                },
+                "lastSignature": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "time": {
+                    "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
         }
     }
 }`
@@ -326,7 +1795,7 @@ const docTemplate = `{
 var SwaggerInfo = &swag.Spec{
 	Version:          "1.0",
 	Host:             "localhost:8080",
-	BasePath:         "/api/v0",
+	BasePath:         "/api",
 	Schemes:          []string{},
 	Title:            "Signing Service API",
 	Description:      "API for managing signature devices and signing transactions.",
@@ -3,8 +3,11 @@ package domain
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
@@ -15,52 +18,474 @@ import (
 
 // DeviceServiceInterface defines the interface for device-related operations
 type DeviceServiceInterface interface {
-	CreateSignatureDevice(ctx context.Context, algorithm, label string) (model.Device, error)
+	CreateSignatureDevice(ctx context.Context, spec DeviceSpec) (model.Device, error)
+	RotateDeviceKey(ctx context.Context, id uuid.UUID) (model.Device, error)
+	ImportSignatureDevice(ctx context.Context, spec ImportSpec) (model.Device, error)
 	SignTransaction(ctx context.Context, id uuid.UUID, data string) (model.SignaturedData, error)
+	SignTransactionIdempotent(ctx context.Context, id uuid.UUID, data, idempotencyKey string) (model.SignaturedData, error)
+	VerifySignature(ctx context.Context, id uuid.UUID, signedData string, signature []byte) (model.Verification, error)
+	AuditSignatureChain(ctx context.Context, id uuid.UUID) (model.ChainAudit, error)
+	ListSignatures(ctx context.Context, id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error)
+	GetSignature(ctx context.Context, id uuid.UUID, counter int) (model.SignatureRecord, error)
 	GetDevice(ctx context.Context, id uuid.UUID) (model.Device, error)
+	GetDeviceKey(ctx context.Context, id uuid.UUID, keyID string) (model.DeviceKey, error)
 	GetAllDevices(ctx context.Context) ([]model.Device, error)
+	ExportPrivateKey(ctx context.Context, id uuid.UUID, password string) (string, error)
 }
 
+// DeviceSpec describes the signature device to be created.
+// The device is created with a random ID unless the client chose one.
+type DeviceSpec struct {
+	ID            uuid.UUID
+	Algorithm     string
+	Label         string
+	KeyParameters crypto.KeyParameters
+	SignOptions   crypto.SignOptions
+	// Version of the format of the data signed by the device, DefaultSecuredDataFormat when empty
+	SecuredDataFormat string
+}
+
+// ImportSpec describes a signature device created from an existing private key.
+// SignatureCounter and LastSignature let the signature chain resume where the previous system left it.
+type ImportSpec struct {
+	Algorithm        string
+	Label            string
+	PrivateKey       []byte
+	SignOptions      crypto.SignOptions
+	SignatureCounter int
+	LastSignature    string
+	// Version of the format of the data signed by the device, DefaultSecuredDataFormat when empty
+	SecuredDataFormat string
+}
+
+// ErrInvalidChainState is returned when an imported signature counter and last signature do not form a valid chain
+var ErrInvalidChainState = errors.New("invalid signature chain state")
+
+var (
+	// ErrKeyExportDisabled is returned when exporting private keys has not been enabled
+	ErrKeyExportDisabled = errors.New("private key export is disabled")
+	// ErrWeakExportPassword is returned when the password protecting an exported key is too short
+	ErrWeakExportPassword = errors.New("export password is too weak")
+)
+
+// ErrIdempotencyKeyReused is returned when a signing request repeats the idempotency key of a previous one with other data
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used with different data")
+
+// ErrKeyNotFound is returned when a device has never had a key with the requested ID
+var ErrKeyNotFound = errors.New("device key not found")
+
+var (
+	// ErrMalformedSignedData is returned when signed data does not have the structure of its secured data format
+	ErrMalformedSignedData = errors.New("malformed signed data")
+	// ErrInvalidSignature is returned when a signature was not issued by a device for the signed data
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// ErrKeyFailure is matched by a KeyError with errors.Is
+var ErrKeyFailure = errors.New("key operation failed")
+
+// KeyError is returned when the key store fails an operation on the key of a device, e.g. because its HSM is unreachable
+type KeyError struct {
+	Op  string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("failed to %s: %v", e.Op, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrKeyFailure
+func (e *KeyError) Is(target error) bool {
+	return target == ErrKeyFailure
+}
+
+// KeyRotationEvent prefixes the data of the signature recording a key rotation in the chain of a device,
+// followed by the ID and the fingerprint of the new key: "key-rotation:<key ID>:<SHA-256 of the public key>"
+const KeyRotationEvent = "key-rotation"
+
+// Kinds of the issues reported by a signature chain audit
+const (
+	ChainIssueGap              = "gap"               // records are missing for a range of counters
+	ChainIssueOutOfOrder       = "out-of-order"      // a record repeats or goes back to an earlier counter
+	ChainIssueMalformed        = "malformed"         // the signed data of a record does not match its counter or structure
+	ChainIssueInvalidGenesis   = "invalid-genesis"   // the first record is not chained to the start of the chain
+	ChainIssueBrokenLink       = "broken-link"       // a record does not reference the signature of its predecessor
+	ChainIssueInvalidSignature = "invalid-signature" // the signature of a record does not verify
+)
+
+// DefaultConflictRetries is the number of times a signature is retried after a conflict, see WithConflictRetries
+const DefaultConflictRetries = 3
+
+// DefaultReservationTimeout is how long the counter reserved for a signature stays reserved, see WithReservationTimeout
+const DefaultReservationTimeout = 30 * time.Second
+
+// Delay before retrying a signature while another instance of the service holds the counter of the device,
+// multiplied by the number of the attempt
+const counterReservedRetryDelay = 20 * time.Millisecond
+
+// DefaultIdempotencyRetention is how long the idempotency key of a signature is remembered, see WithIdempotencyRetention
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+// MinExportPasswordLength is the minimum length of the password protecting an exported private key
+const MinExportPasswordLength = 12
+
+// Audit log values written for private key exports
+const (
+	AuditActionKeyExport = "key-export"
+	AuditOutcomeExported = "exported"
+	AuditOutcomeDenied   = "denied"
+	AuditOutcomeFailed   = "failed"
+)
+
 type DeviceService struct {
 	repo       persistence.DeviceRepoInterface
 	utils      utils.UtilsInterface
-	signer     crypto.SignerInterface
-	devicesMus map[uuid.UUID]*sync.Mutex // map to avoid signning from the same device at the same time
-	mu         sync.Mutex                // mutex to avoid concurrent access to the mutexes map
+	algorithms *crypto.Registry
+	keyPolicy  crypto.KeyPolicy
+	keyExport  bool
+	audit      persistence.AuditRepoInterface
+	keyStore   crypto.KeyStore
+	// Formats of the data signed by the devices
+	securedDataFormats *SecuredDataFormats
+	// Number of times a signature is retried when the chain state of the device changed, which the
+	// repository detects when several instances of the service sign with the same device
+	conflictRetries int
+	// How long the idempotency key of a signature is remembered
+	idempotencyRetention time.Duration
+	// How long the counter reserved for a signature stays reserved if it is neither committed nor released
+	reservationTimeout time.Duration
+	devicesMus         map[uuid.UUID]*sync.Mutex // map to avoid signning from the same device at the same time in this instance
+	mu                 sync.Mutex                // mutex to avoid concurrent access to the mutexes map
+}
+
+// Option configures optional behaviour of the DeviceService
+type Option func(*DeviceService)
+
+// WithKeyPolicy sets the minimum key sizes accepted when creating devices
+func WithKeyPolicy(policy crypto.KeyPolicy) Option {
+	return func(s *DeviceService) {
+		s.keyPolicy = policy
+	}
+}
+
+// WithKeyExport enables exporting the private keys of the devices
+func WithKeyExport(enabled bool) Option {
+	return func(s *DeviceService) {
+		s.keyExport = enabled
+	}
+}
+
+// WithAuditLog sets the log where security relevant operations are recorded
+func WithAuditLog(audit persistence.AuditRepoInterface) Option {
+	return func(s *DeviceService) {
+		s.audit = audit
+	}
+}
+
+// WithKeyStore sets the key store holding the private keys of the devices
+func WithKeyStore(keyStore crypto.KeyStore) Option {
+	return func(s *DeviceService) {
+		s.keyStore = keyStore
+	}
+}
+
+// WithConflictRetries sets how many times a signature is retried when another instance of the service
+// signed with the device in the meantime, before the conflict is reported
+func WithConflictRetries(retries int) Option {
+	return func(s *DeviceService) {
+		s.conflictRetries = retries
+	}
+}
+
+// WithIdempotencyRetention sets how long the idempotency key of a signature is remembered, during which
+// a signing request repeating it returns the signature instead of signing again
+func WithIdempotencyRetention(retention time.Duration) Option {
+	return func(s *DeviceService) {
+		s.idempotencyRetention = retention
+	}
+}
+
+// WithSecuredDataFormats sets the formats the devices can sign their data with
+func WithSecuredDataFormats(formats *SecuredDataFormats) Option {
+	return func(s *DeviceService) {
+		s.securedDataFormats = formats
+	}
+}
+
+// WithReservationTimeout sets how long the counter reserved for a signature stays reserved. It must exceed
+// the time it takes to sign, as a signer that crashed holds the counter of its device until then.
+func WithReservationTimeout(timeout time.Duration) Option {
+	return func(s *DeviceService) {
+		s.reservationTimeout = timeout
+	}
+}
+
+// NewDeviceService creates a new DeviceService instance with the provided repository and initializes the mutex map.
+// When no algorithm registry is provided the default one is used, and unless a key store is provided
+// private keys are kept by a software key store wrapping them with an ephemeral master key that is lost when the service stops.
+func NewDeviceService(repo persistence.DeviceRepoInterface, utils utils.UtilsInterface, algorithms *crypto.Registry, opts ...Option) *DeviceService {
+	if algorithms == nil {
+		algorithms = crypto.DefaultRegistry
+	}
+
+	s := &DeviceService{
+		repo:                 repo,
+		utils:                utils,
+		algorithms:           algorithms,
+		keyPolicy:            crypto.DefaultKeyPolicy,
+		audit:                persistence.NewAuditRepository(),
+		keyStore:             crypto.NewSoftwareKeyStore(algorithms, crypto.NewEphemeralKeyWrapper()),
+		securedDataFormats:   DefaultSecuredDataFormats,
+		conflictRetries:      DefaultConflictRetries,
+		idempotencyRetention: DefaultIdempotencyRetention,
+		reservationTimeout:   DefaultReservationTimeout,
+		devicesMus:           make(map[uuid.UUID]*sync.Mutex),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
-// NewDeviceService creates a new UserService instance with the provided repository and initializes the mutex map
-func NewDeviceService(repo persistence.DeviceRepoInterface, utils utils.UtilsInterface, signer crypto.SignerInterface) *DeviceService {
-	return &DeviceService{
-		repo:       repo,
-		utils:      utils,
-		signer:     signer,
-		devicesMus: make(map[uuid.UUID]*sync.Mutex),
+// CreateSignatureDevice creates a new signature device with the specified algorithm, label and key parameters
+func (s *DeviceService) CreateSignatureDevice(ctx context.Context, spec DeviceSpec) (model.Device, error) {
+	securedDataFormat, err := s.resolveSecuredDataFormat(spec.SecuredDataFormat)
+	if err != nil {
+		return model.Device{}, err
+	}
+
+	// Resolving the key parameters and checking them against the key policy
+	keyParameters, err := s.utils.ResolveKeyParameters(spec.Algorithm, spec.KeyParameters)
+	if err != nil {
+		return model.Device{}, err
+	}
+	err = s.keyPolicy.Check(spec.Algorithm, keyParameters)
+	if err != nil {
+		return model.Device{}, err
+	}
+
+	// Resolving the signing options supported by the algorithm
+	signOptions, err := s.resolveSignOptions(spec.Algorithm, spec.SignOptions, keyParameters)
+	if err != nil {
+		return model.Device{}, err
+	}
+
+	// Checking that the chosen ID is free before generating a key named after it
+	id := spec.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	} else if _, err := s.repo.FindByID(id); err == nil {
+		return model.Device{}, fmt.Errorf("%w: %s", persistence.ErrDeviceExists, id)
+	} else if !errors.Is(err, persistence.ErrDeviceNotFound) {
+		return model.Device{}, err
+	}
+
+	// Create the new device with a key pair generated by the key store
+	device := newDevice(id, spec.Algorithm, spec.Label, keyParameters, signOptions)
+	device.SecuredDataFormat = securedDataFormat
+	device.KeyHandle, device.PublicKey, err = s.keyStore.GenerateKey(device.KeyID, device.Algorithm, keyParameters)
+	if err != nil {
+		return model.Device{}, &KeyError{Op: "generate key pair", Err: err}
 	}
+
+	return s.saveNewDevice(device)
 }
 
-// CreateSignatureDevice creates a new signature device with the specified algorithm and label
-func (s *DeviceService) CreateSignatureDevice(ctx context.Context, algorithm, label string) (model.Device, error) {
-	id := uuid.New()
+// ImportSignatureDevice creates a signature device from an existing private key, continuing its signature chain
+func (s *DeviceService) ImportSignatureDevice(ctx context.Context, spec ImportSpec) (model.Device, error) {
+	// Validating the chain the device resumes from
+	if spec.SignatureCounter < 0 {
+		return model.Device{}, fmt.Errorf("%w: the signature counter cannot be negative", ErrInvalidChainState)
+	}
+	if spec.SignatureCounter == 0 && spec.LastSignature != "" {
+		return model.Device{}, fmt.Errorf("%w: a device without signatures cannot have a last signature", ErrInvalidChainState)
+	}
+	if spec.SignatureCounter > 0 {
+		if spec.LastSignature == "" {
+			return model.Device{}, fmt.Errorf("%w: the last signature is required to continue the chain", ErrInvalidChainState)
+		}
+		if _, err := base64.StdEncoding.DecodeString(spec.LastSignature); err != nil {
+			return model.Device{}, fmt.Errorf("%w: the last signature must be base64 encoded", ErrInvalidChainState)
+		}
+	}
 
-	// Creating new public and private keys
-	publicKey, privateKey, err := s.utils.GenerateNewKeyPair(algorithm)
+	securedDataFormat, err := s.resolveSecuredDataFormat(spec.SecuredDataFormat)
 	if err != nil {
-		return model.Device{}, fmt.Errorf("failed to generate key pair: %w", err)
+		return model.Device{}, err
 	}
 
-	// Create the new device
-	device := model.Device{
-		ID:               id,
-		Algorithm:        algorithm,
-		Label:            label,
-		PublicKey:        publicKey,
-		PrivateKey:       privateKey,
-		SignatureCounter: 0,
+	// Decoding the private key and checking its parameters against the key policy
+	publicKey, privateKey, keyParameters, err := s.utils.ImportKeyPair(spec.Algorithm, spec.PrivateKey)
+	if err != nil {
+		return model.Device{}, err
+	}
+	err = s.keyPolicy.Check(spec.Algorithm, keyParameters)
+	if err != nil {
+		return model.Device{}, err
 	}
 
-	// Save it in the database
-	err = s.repo.Create(device)
+	// Resolving the signing options supported by the algorithm
+	signOptions, err := s.resolveSignOptions(spec.Algorithm, spec.SignOptions, keyParameters)
+	if err != nil {
+		return model.Device{}, err
+	}
+
+	// Create the imported device, handing its private key over to the key store
+	device := newDevice(uuid.New(), spec.Algorithm, spec.Label, keyParameters, signOptions)
+	device.SecuredDataFormat = securedDataFormat
+	device.PublicKey = publicKey
+	device.KeyHandle, err = s.keyStore.ImportKey(device.KeyID, device.Algorithm, privateKey)
+	if err != nil {
+		return model.Device{}, &KeyError{Op: "import private key", Err: err}
+	}
+	device.SignatureCounter = spec.SignatureCounter
+	device.LastSignature = spec.LastSignature
+	if spec.SignatureCounter > 0 {
+		device.ImportedChain = &model.ChainState{
+			SignatureCounter: spec.SignatureCounter,
+			LastSignature:    spec.LastSignature,
+		}
+	}
+
+	return s.saveNewDevice(device)
+}
+
+// RewrapPrivateKeys wraps the private keys of all the devices with the active master key of the key store,
+// so previous master keys can be retired after a rotation. It returns the number of rewrapped keys.
+func (s *DeviceService) RewrapPrivateKeys(ctx context.Context) (int, error) {
+	rewrapper, ok := s.keyStore.(crypto.KeyRewrapper)
+	if !ok {
+		return 0, errors.New("the key store does not wrap private keys")
+	}
+
+	devices, err := s.repo.GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving all the devices: %w", err)
+	}
+
+	for i, device := range devices {
+		err = s.rewrapPrivateKey(rewrapper, device.ID)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(devices), nil
+}
+
+// Rewrap the private key of a device while no transaction is signed with it by this instance
+func (s *DeviceService) rewrapPrivateKey(rewrapper crypto.KeyRewrapper, id uuid.UUID) error {
+	deviceMu := s.deviceMutex(id)
+	deviceMu.Lock()
+	defer deviceMu.Unlock()
+
+	// Rewrapping the new key when another instance rotated the key of the device in the meantime
+	for attempt := 0; ; attempt++ {
+		err := s.rewrapActiveKey(rewrapper, id)
+		if !errors.Is(err, persistence.ErrKeyChanged) || attempt >= s.conflictRetries {
+			return err
+		}
+	}
+}
+
+// Rewrap the active key of a device. Only its key handle is saved, so the signatures other instances
+// commit meanwhile are kept, and the handle is only saved if the device still has the key.
+func (s *DeviceService) rewrapActiveKey(rewrapper crypto.KeyRewrapper, id uuid.UUID) error {
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	keyHandle, err := rewrapper.Rewrap(device.KeyID, device.KeyHandle)
+	if err != nil {
+		return &KeyError{Op: fmt.Sprintf("rewrap private key of device %s", device.ID), Err: err}
+	}
+
+	err = s.repo.UpdateKeyHandle(device.ID, device.KeyID, keyHandle)
+	if err != nil {
+		return fmt.Errorf("failed to save the key of device %s: %w", device.ID, err)
+	}
+
+	return nil
+}
+
+// Get the mutex of a device, creating it if the device was not created by this service
+func (s *DeviceService) deviceMutex(id uuid.UUID) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deviceMu, exists := s.devicesMus[id]
+	if !exists {
+		deviceMu = &sync.Mutex{}
+		s.devicesMus[id] = deviceMu
+	}
+
+	return deviceMu
+}
+
+// Resolve the signing options requested for a device with the signer of its algorithm,
+// checking that the key store can sign with them
+func (s *DeviceService) resolveSignOptions(algorithmName string, requested crypto.SignOptions, keyParameters crypto.KeyParameters) (crypto.SignOptions, error) {
+	algorithm, err := s.algorithms.Get(algorithmName)
+	if err != nil {
+		return crypto.SignOptions{}, err
+	}
+
+	signOptions, err := algorithm.Signer.ResolveOptions(requested, keyParameters)
+	if err != nil {
+		return crypto.SignOptions{}, err
+	}
+	if checker, ok := s.keyStore.(crypto.SignOptionsChecker); ok {
+		if err := checker.CheckSignOptions(algorithmName, signOptions); err != nil {
+			return crypto.SignOptions{}, err
+		}
+	}
+
+	return signOptions, nil
+}
+
+// Resolve the secured data format requested for a device, checking that it is supported
+func (s *DeviceService) resolveSecuredDataFormat(version string) (string, error) {
+	if version == "" {
+		version = DefaultSecuredDataFormat
+	}
+	if _, err := s.securedDataFormats.Get(version); err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// Build a device with the ID from its resolved key parameters and signing options
+func newDevice(id uuid.UUID, algorithm, label string, keyParameters crypto.KeyParameters, signOptions crypto.SignOptions) model.Device {
+	return model.Device{
+		ID:            id,
+		KeyID:         deviceKeyID(id, 1),
+		Algorithm:     algorithm,
+		Label:         label,
+		KeySize:       keyParameters.Size,
+		Curve:         keyParameters.Curve,
+		Digest:        signOptions.Digest,
+		Padding:       signOptions.Padding,
+		SaltLength:    signOptions.SaltLength,
+		Encoding:      signOptions.Encoding,
+		Deterministic: signOptions.Deterministic,
+	}
+}
+
+// Name the keys of a device after the device and the number of the key, starting with 1
+func deviceKeyID(id uuid.UUID, number int) string {
+	return fmt.Sprintf("%s/%d", id, number)
+}
+
+// Save a new device in the database and create its mutex
+func (s *DeviceService) saveNewDevice(device model.Device) (model.Device, error) {
+	err := s.repo.Create(device)
 	if err != nil {
 		return model.Device{}, fmt.Errorf("failed to save device: %w", err)
 	}
@@ -69,82 +494,466 @@ func (s *DeviceService) CreateSignatureDevice(ctx context.Context, algorithm, la
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.devicesMus[id] = &sync.Mutex{}
+	s.devicesMus[device.ID] = &sync.Mutex{}
 
 	return device, nil
 }
 
 // SignTransaction signs the provided data using the device's private key and returns the signed data
 func (s *DeviceService) SignTransaction(ctx context.Context, id uuid.UUID, data string) (model.SignaturedData, error) {
+	return s.SignTransactionIdempotent(ctx, id, data, "")
+}
+
+// SignTransactionIdempotent signs the provided data like SignTransaction, unless the device already signed it
+// with the idempotency key during the retention period, e.g. before a client retried a timed out request.
+// The previous signature is then returned without consuming a counter value.
+// An empty idempotency key signs the data in any case.
+func (s *DeviceService) SignTransactionIdempotent(ctx context.Context, id uuid.UUID, data, idempotencyKey string) (model.SignaturedData, error) {
+	// Blocking device from be modified or accessed by this instance until we have finished
+	deviceMu := s.deviceMutex(id)
+	deviceMu.Lock()
+	defer deviceMu.Unlock()
+
+	// Signing again from the new chain state when another instance signed with the device in the meantime
+	for attempt := 0; ; attempt++ {
+		signaturedData, err := s.signTransaction(id, data, idempotencyKey)
+		if !errors.Is(err, persistence.ErrConflict) || attempt >= s.conflictRetries {
+			return signaturedData, err
+		}
+
+		// Giving the instance holding the counter time to commit or release it
+		if errors.Is(err, persistence.ErrCounterReserved) {
+			time.Sleep(time.Duration(attempt+1) * counterReservedRetryDelay)
+		}
+	}
+}
+
+// Sign the data with the current chain state of the device, which must not change until the signature is saved
+func (s *DeviceService) signTransaction(id uuid.UUID, data, idempotencyKey string) (model.SignaturedData, error) {
 	// Retrieve the device from the persistence layer using the ID
 	device, err := s.repo.FindByID(id)
 	if err != nil {
 		return model.SignaturedData{}, err
 	}
 
-	// Checking if the device has an active mutex
-	_, exists := s.devicesMus[id]
-	if !exists {
-		s.devicesMus[id] = &sync.Mutex{}
+	// Returning the signature of a repeated request instead of signing again
+	if idempotencyKey != "" {
+		record, err := s.repo.FindSignatureByIdempotencyKey(id, idempotencyKey, time.Now().Add(-s.idempotencyRetention))
+		if err == nil {
+			if record.Data != data {
+				return model.SignaturedData{}, fmt.Errorf("%w: key %q signed other data as signature %d", ErrIdempotencyKeyReused, idempotencyKey, record.Counter)
+			}
+			return model.SignaturedData{
+				Signature:  record.Signature,
+				SignedData: record.SignedData,
+				Digest:     device.Digest,
+				Encoding:   device.Encoding,
+			}, nil
+		} else if !errors.Is(err, persistence.ErrSignatureNotFound) {
+			return model.SignaturedData{}, fmt.Errorf("failed to look up the idempotency key: %w", err)
+		}
 	}
 
-	// Blocking device from be modified or accessed until we have finished
-	s.devicesMus[id].Lock()
-	defer s.devicesMus[id].Unlock()
+	// Reserving the counter before signing, so it is only consumed by a signature that is saved
+	reservation, err := s.reserveCounter(device)
+	if err != nil {
+		return model.SignaturedData{}, err
+	}
 
-	// Preparing data to be signed
-	header := device.SignatureCounter
-	body := data
-	var end string
-	if device.SignatureCounter == 0 {
-		idBytes, err := device.ID.MarshalBinary()
-		if err != nil {
-			return model.SignaturedData{}, err
-		}
-		end = base64.StdEncoding.EncodeToString(idBytes)
-	} else {
-		end = device.LastSignature
-	}
-	preparedData := fmt.Sprintf("%d_%s_%s", header, body, end)
-
-	// Signing the data
-	var signature []byte
-
-	if _, ok := s.signer.(*crypto.MockSigner); ok {
-		// Mock signing for testing purposes
-		signature = []byte("mocked_signature")
-	} else {
-		switch device.Algorithm {
-		case "ECC":
-			eccSigner := crypto.ECCSigner{}
-			signature, err = eccSigner.Sign(preparedData, device.PrivateKey, device.PublicKey)
-			if err != nil {
-				return model.SignaturedData{}, fmt.Errorf("failed to sign data: %w", err)
-			}
-		case "RSA":
-			rsaSigner := crypto.RSASigner{}
-			signature, err = rsaSigner.Sign(preparedData, device.PrivateKey, device.PublicKey)
-			if err != nil {
-				return model.SignaturedData{}, fmt.Errorf("failed to sign data: %w", err)
-			}
-		}
+	// Signing the data chained to the previous signature of the device
+	signedAt := time.Now().UTC()
+	preparedData, signature, err := s.signChained(device, data, signedAt)
+	if err != nil {
+		s.releaseReservation(reservation)
+		return model.SignaturedData{}, err
 	}
 
 	// Creating returning data
 	signaturedData := model.SignaturedData{
 		Signature:  signature,
 		SignedData: preparedData,
+		Digest:     device.Digest,
+		Encoding:   device.Encoding,
 	}
 
-	// Updating signature counter and last signature of the device
-	err = s.repo.AfterSignUpdateDevice(device.ID, base64.StdEncoding.EncodeToString(signature))
+	// Updating signature counter and last signature of the device, journaling the signature in the same step.
+	// The signature is discarded when it cannot be saved, and its counter released for the next one.
+	record := newSignatureRecord(device, data, preparedData, signature, signedAt)
+	record.IdempotencyKey = idempotencyKey
+	err = s.repo.AfterSignUpdateDevice(reservation, record)
 	if err != nil {
+		s.releaseReservation(reservation)
 		return model.SignaturedData{}, fmt.Errorf("failed to update device after signing: %w", err)
 	}
 
 	return signaturedData, nil
 }
 
+// RotateDeviceKey replaces the key pair of a device with a new one of the same algorithm and key parameters.
+// The rotation is recorded in the signature chain of the device: the old key signs an event naming the new key,
+// which then continues the chain. The old public key stays on the device to verify the signatures it produced.
+func (s *DeviceService) RotateDeviceKey(ctx context.Context, id uuid.UUID) (model.Device, error) {
+	// Blocking device from be modified or accessed until we have finished
+	deviceMu := s.deviceMutex(id)
+	deviceMu.Lock()
+	defer deviceMu.Unlock()
+
+	// Retrieve the device from the persistence layer using the ID
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return model.Device{}, err
+	}
+
+	// Generating the new key pair
+	keyID := deviceKeyID(device.ID, len(device.PreviousKeys)+2)
+	keyParameters := crypto.KeyParameters{Size: device.KeySize, Curve: device.Curve}
+	keyHandle, publicKey, err := s.keyStore.GenerateKey(keyID, device.Algorithm, keyParameters)
+	if err != nil {
+		return model.Device{}, &KeyError{Op: "generate key pair", Err: err}
+	}
+	fingerprint, err := crypto.PublicKeyFingerprint(publicKey)
+	if err != nil {
+		return model.Device{}, fmt.Errorf("failed to fingerprint the new public key: %w", err)
+	}
+
+	// Signing the rotation event with the old key, at a reserved counter
+	reservation, err := s.reserveCounter(device)
+	if err != nil {
+		return model.Device{}, err
+	}
+	event := fmt.Sprintf("%s:%s:%s", KeyRotationEvent, keyID, fingerprint)
+	signedAt := time.Now().UTC()
+	preparedData, signature, err := s.signChained(device, event, signedAt)
+	if err != nil {
+		s.releaseReservation(reservation)
+		return model.Device{}, err
+	}
+	record := newSignatureRecord(device, event, preparedData, signature, signedAt)
+
+	// Retiring the old key and continuing the chain with the new one
+	retired := currentDeviceKey(device)
+	retired.LastCounter = device.SignatureCounter
+	retired.Active = false
+	device.PreviousKeys = append(slices.Clone(device.PreviousKeys), retired)
+	device.KeyID = keyID
+	device.PublicKey = publicKey
+	device.KeyHandle = keyHandle
+	device.SignatureCounter++
+	device.LastSignature = base64.StdEncoding.EncodeToString(signature)
+
+	// Saving the rotated device, journaling the rotation event in the same step. A conflict is not retried,
+	// as the device may have been rotated by another instance.
+	err = s.repo.AfterRotateUpdateDevice(reservation, *device, record)
+	if err != nil {
+		s.releaseReservation(reservation)
+		return model.Device{}, fmt.Errorf("failed to save device: %w", err)
+	}
+
+	return *device, nil
+}
+
+// RecoverReservations releases the counters left reserved by signers that stopped before committing or releasing
+// them, e.g. because an instance of the service crashed while signing, once their reservation expired.
+// No signature was saved for them, so the next signature of their device takes the counter. It returns the
+// recovered reservations. Expired reservations are also taken over when their device signs again.
+func (s *DeviceService) RecoverReservations(ctx context.Context) ([]model.Reservation, error) {
+	recovered, err := s.repo.RecoverReservations(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover the counter reservations: %w", err)
+	}
+
+	return recovered, nil
+}
+
+// Reserve the next counter of the device from its current chain state
+func (s *DeviceService) reserveCounter(device *model.Device) (model.Reservation, error) {
+	expected := model.ChainState{SignatureCounter: device.SignatureCounter, LastSignature: device.LastSignature}
+	reservation := persistence.NewReservation(device.ID, expected, s.reservationTimeout)
+	err := s.repo.ReserveCounter(reservation)
+	if err != nil {
+		return model.Reservation{}, fmt.Errorf("failed to reserve signature counter: %w", err)
+	}
+
+	return reservation, nil
+}
+
+// Release a reservation whose signature was not saved. A reservation that cannot be released expires.
+func (s *DeviceService) releaseReservation(reservation model.Reservation) {
+	_ = s.repo.ReleaseReservation(reservation)
+}
+
+// Build the journal record of a signature made by the current key of the device at its current counter
+func newSignatureRecord(device *model.Device, data, signedData string, signature []byte, signedAt time.Time) model.SignatureRecord {
+	return model.SignatureRecord{
+		DeviceID:   device.ID,
+		Counter:    device.SignatureCounter,
+		Data:       data,
+		SignedData: signedData,
+		Signature:  signature,
+		Algorithm:  device.Algorithm,
+		KeyID:      device.KeyID,
+		Time:       signedAt,
+	}
+}
+
+// Build the data to be signed with the secured data format of the device, starting the chain with the base64 encoded
+// device ID, and sign it with the current key of the device, which never leaves the key store
+func (s *DeviceService) signChained(device *model.Device, data string, signedAt time.Time) (string, []byte, error) {
+	formatter, err := s.securedDataFormatter(device)
+	if err != nil {
+		return "", nil, err
+	}
+
+	securedData := SecuredData{
+		Counter:       device.SignatureCounter,
+		Data:          data,
+		LastSignature: device.LastSignature,
+		Time:          signedAt,
+		Algorithm:     device.Algorithm,
+	}
+	if device.SignatureCounter == 0 {
+		securedData.LastSignature, err = chainStart(device.ID)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	preparedData, err := formatter.Format(securedData)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to format the data to be signed: %w", err)
+	}
+
+	signature, err := s.keyStore.Sign(device.KeyID, device.Algorithm, device.KeyHandle, preparedData, deviceSignOptions(device))
+	if err != nil {
+		return "", nil, &KeyError{Op: "sign data", Err: err}
+	}
+
+	return preparedData, signature, nil
+}
+
+// Get the formatter of the data signed by the device
+func (s *DeviceService) securedDataFormatter(device *model.Device) (SecuredDataFormatter, error) {
+	return s.securedDataFormats.Get(DeviceSecuredDataFormat(*device))
+}
+
+// DeviceSecuredDataFormat returns the version of the format of the data signed by the device,
+// which is v1 for the devices created before the format was versioned
+func DeviceSecuredDataFormat(device model.Device) string {
+	if device.SecuredDataFormat == "" {
+		return SecuredDataFormatV1
+	}
+
+	return device.SecuredDataFormat
+}
+
+// The base64 encoded device ID, which the first signature of a device is chained to
+func chainStart(id uuid.UUID) (string, error) {
+	idBytes, err := id.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(idBytes), nil
+}
+
+// VerifySignature checks that a signature was issued by a device for the signed data. The signed data must have the
+// structure of one of the secured data formats, as produced when signing, and the signature must match the key of the
+// device covering the counter, which is a previous key for signatures made before a rotation.
+// A signature that does not verify is not an error: the returned verification reports the reason it was rejected.
+func (s *DeviceService) VerifySignature(ctx context.Context, id uuid.UUID, signedData string, signature []byte) (model.Verification, error) {
+	// Retrieve the device from the persistence layer using the ID
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return model.Verification{}, err
+	}
+
+	verification, err := s.verifySignature(device, signedData, signature)
+	if err != nil {
+		verification.Reason = err.Error()
+		return verification, nil
+	}
+	verification.Valid = true
+
+	return verification, nil
+}
+
+// Check the structure of the signed data and the signature against the key of the device covering its counter
+func (s *DeviceService) verifySignature(device *model.Device, signedData string, signature []byte) (model.Verification, error) {
+	format, securedData, err := s.securedDataFormats.Parse(signedData)
+	if err != nil {
+		return model.Verification{}, err
+	}
+	counter, lastSignature := securedData.Counter, securedData.LastSignature
+	verification := model.Verification{
+		Counter:       counter,
+		Data:          securedData.Data,
+		LastSignature: lastSignature,
+		Format:        format,
+		Time:          securedData.Time,
+		Algorithm:     securedData.Algorithm,
+	}
+
+	// Checking the algorithm named by the signed data, in the formats carrying it
+	if securedData.Algorithm != "" && securedData.Algorithm != device.Algorithm {
+		return verification, fmt.Errorf("%w: the signed data names algorithm %s instead of %s", ErrInvalidSignature, securedData.Algorithm, device.Algorithm)
+	}
+
+	// Checking the position of the signature in the chain
+	if counter >= device.SignatureCounter {
+		return verification, fmt.Errorf("%w: the device has issued %d signatures, counter %d is not one of them", ErrInvalidSignature, device.SignatureCounter, counter)
+	}
+	if counter == 0 {
+		start, err := chainStart(device.ID)
+		if err != nil {
+			return verification, err
+		}
+		if lastSignature != start {
+			return verification, fmt.Errorf("%w: the first signature must be chained to the base64 encoded device ID", ErrInvalidSignature)
+		}
+	}
+
+	// Verifying the signature with the key that was active for the counter
+	verification.KeyID, err = s.checkSignature(device, counter, signedData, signature)
+	if err != nil {
+		return verification, err
+	}
+
+	return verification, nil
+}
+
+// Check a signature with the key of the device covering its counter and return the ID of that key
+func (s *DeviceService) checkSignature(device *model.Device, counter int, signedData string, signature []byte) (string, error) {
+	key, found := deviceKeyForCounter(device, counter)
+	if !found {
+		return "", fmt.Errorf("%w: no key of the device covers counter %d", ErrInvalidSignature, counter)
+	}
+
+	algorithm, err := s.algorithms.Get(device.Algorithm)
+	if err != nil {
+		return key.ID, err
+	}
+	err = algorithm.Verifier.Verify(signedData, signature, key.PublicKey, deviceSignOptions(device))
+	if err != nil {
+		return key.ID, fmt.Errorf("%w: the signature does not match key %s", ErrInvalidSignature, key.ID)
+	}
+
+	return key.ID, nil
+}
+
+// AuditSignatureChain walks the stored signatures of a device and reports every gap or break of its chain:
+// counters must be contiguous from the start of the chain up to the signature counter of the device,
+// the first record must be chained to the base64 encoded device ID, each following record to the signature
+// of its predecessor, and every signature must verify with the key that was active for its counter.
+// Devices imported with an existing chain are audited from the counter and last signature they were imported with.
+func (s *DeviceService) AuditSignatureChain(ctx context.Context, id uuid.UUID) (model.ChainAudit, error) {
+	// Retrieve the device and its signatures from the persistence layer
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return model.ChainAudit{}, err
+	}
+	records, _, err := s.repo.GetSignatures(id, 0, 0)
+	if err != nil {
+		return model.ChainAudit{}, fmt.Errorf("failed to retrieve the signatures of device %s: %w", id, err)
+	}
+
+	// The chain starts with the device ID, or where the previous system left it for imported devices
+	start := model.ChainState{}
+	start.LastSignature, err = chainStart(device.ID)
+	if err != nil {
+		return model.ChainAudit{}, err
+	}
+	if device.ImportedChain != nil {
+		start = *device.ImportedChain
+	}
+
+	audit := model.ChainAudit{
+		DeviceID:         device.ID,
+		FirstCounter:     start.SignatureCounter,
+		SignatureCounter: device.SignatureCounter,
+		Records:          len(records),
+	}
+	report := func(kind string, counter int, detail string, args ...any) {
+		audit.Issues = append(audit.Issues, model.ChainIssue{Kind: kind, Counter: counter, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	expected := start.SignatureCounter
+	previous := start.LastSignature
+	for _, record := range records {
+		// Checking the position of the record in the chain
+		linked := true
+		if record.Counter > expected {
+			report(ChainIssueGap, expected, "counters %d to %d are missing", expected, record.Counter-1)
+			linked = false
+		} else if record.Counter < expected {
+			report(ChainIssueOutOfOrder, record.Counter, "counter %d follows counter %d", record.Counter, expected-1)
+			linked = false
+		}
+
+		// Checking the structure of the signed data and the reference to the predecessor
+		_, securedData, err := s.securedDataFormats.Parse(record.SignedData)
+		lastSignature := securedData.LastSignature
+		if err != nil {
+			report(ChainIssueMalformed, record.Counter, "%v", err)
+		} else if securedData.Counter != record.Counter {
+			report(ChainIssueMalformed, record.Counter, "the signed data has counter %d", securedData.Counter)
+		} else if securedData.Algorithm != "" && securedData.Algorithm != record.Algorithm {
+			report(ChainIssueMalformed, record.Counter, "the signed data names algorithm %s instead of %s", securedData.Algorithm, record.Algorithm)
+		} else if record.Counter == start.SignatureCounter && lastSignature != start.LastSignature {
+			report(ChainIssueInvalidGenesis, record.Counter, "the first signature is chained to %q instead of %q", lastSignature, start.LastSignature)
+		} else if linked && record.Counter != start.SignatureCounter && lastSignature != previous {
+			report(ChainIssueBrokenLink, record.Counter, "the signature is chained to %q instead of the previous signature %q", lastSignature, previous)
+		}
+
+		// Verifying the signature with the key that was active for the counter
+		if _, err := s.checkSignature(device, record.Counter, record.SignedData, record.Signature); err != nil {
+			report(ChainIssueInvalidSignature, record.Counter, "%v", err)
+		}
+
+		// Records that do not move the chain forward are not taken as predecessors
+		if record.Counter >= expected {
+			expected = record.Counter + 1
+			previous = base64.StdEncoding.EncodeToString(record.Signature)
+		}
+	}
+	if expected < device.SignatureCounter {
+		report(ChainIssueGap, expected, "counters %d to %d are missing", expected, device.SignatureCounter-1)
+	}
+	audit.Intact = len(audit.Issues) == 0
+
+	return audit, nil
+}
+
+// Find the current or previous key of a device whose signatures cover the counter
+func deviceKeyForCounter(device *model.Device, counter int) (model.DeviceKey, bool) {
+	current := currentDeviceKey(device)
+	if counter >= current.FirstCounter {
+		return current, true
+	}
+	for _, key := range device.PreviousKeys {
+		if key.FirstCounter <= counter && counter <= key.LastCounter {
+			return key, true
+		}
+	}
+
+	return model.DeviceKey{}, false
+}
+
+// Describe the current key of a device. It covers the signatures since the last rotation, or since the
+// beginning of the chain, including those made by a previous system for imported devices.
+func currentDeviceKey(device *model.Device) model.DeviceKey {
+	firstCounter := 0
+	if len(device.PreviousKeys) > 0 {
+		firstCounter = device.PreviousKeys[len(device.PreviousKeys)-1].LastCounter + 1
+	}
+
+	return model.DeviceKey{
+		ID:           device.KeyID,
+		PublicKey:    device.PublicKey,
+		FirstCounter: firstCounter,
+		LastCounter:  device.SignatureCounter - 1,
+		Active:       true,
+	}
+}
+
 // GetDevice retrieves a device by its ID
 func (s *DeviceService) GetDevice(ctx context.Context, ID uuid.UUID) (model.Device, error) {
 	device, err := s.repo.FindByID(ID)
@@ -164,3 +973,123 @@ func (s *DeviceService) GetAllDevices(ctx context.Context) ([]model.Device, erro
 
 	return devices, nil
 }
+
+// ListSignatures retrieves a page of the journaled signatures of a device in the order they were issued,
+// together with the total number of signatures in the journal
+func (s *DeviceService) ListSignatures(ctx context.Context, id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error) {
+	records, total, err := s.repo.GetSignatures(id, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
+// GetSignature retrieves the journaled signature of a device with the given counter
+func (s *DeviceService) GetSignature(ctx context.Context, id uuid.UUID, counter int) (model.SignatureRecord, error) {
+	record, err := s.repo.GetSignature(id, counter)
+	if err != nil {
+		return model.SignatureRecord{}, err
+	}
+
+	return *record, nil
+}
+
+// GetDeviceKey retrieves the current or a previous public key of a device by its key ID
+func (s *DeviceService) GetDeviceKey(ctx context.Context, id uuid.UUID, keyID string) (model.DeviceKey, error) {
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return model.DeviceKey{}, err
+	}
+
+	if keyID == device.KeyID {
+		return currentDeviceKey(device), nil
+	}
+	for _, key := range device.PreviousKeys {
+		if key.ID == keyID {
+			return key, nil
+		}
+	}
+
+	return model.DeviceKey{}, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+}
+
+// ExportPrivateKey returns the private key of a device encrypted with the given password as PKCS#8.
+// Every attempt is recorded in the audit log, including the ones naming an unknown device, and the key
+// is only returned once its export has been recorded.
+func (s *DeviceService) ExportPrivateKey(ctx context.Context, id uuid.UUID, password string) (string, error) {
+	encrypted, err := s.exportPrivateKey(id, password)
+
+	entry := model.AuditEntry{
+		Time:     time.Now().UTC(),
+		Action:   AuditActionKeyExport,
+		DeviceID: id,
+		Outcome:  AuditOutcomeExported,
+		Details:  "encrypted PKCS#8",
+	}
+	if err != nil {
+		entry.Outcome = AuditOutcomeFailed
+		if isExportDenial(err) {
+			entry.Outcome = AuditOutcomeDenied
+		}
+		entry.Details = err.Error()
+	}
+	if auditErr := s.audit.Append(entry); auditErr != nil {
+		return "", fmt.Errorf("failed to write audit entry: %w", auditErr)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return encrypted, nil
+}
+
+// Export the private key of a device encrypted with the password, if the export is allowed
+func (s *DeviceService) exportPrivateKey(id uuid.UUID, password string) (string, error) {
+	// Keys can only be exported when enabled and when the key store lets them leave it
+	exporter, exportable := s.keyStore.(crypto.KeyExporter)
+	if !s.keyExport {
+		return "", ErrKeyExportDisabled
+	}
+	if !exportable {
+		return "", crypto.ErrKeyNotExportable
+	}
+	if len(password) < MinExportPasswordLength {
+		return "", fmt.Errorf("%w: it must be at least %d characters long", ErrWeakExportPassword, MinExportPasswordLength)
+	}
+
+	// Retrieve the device from the persistence layer using the ID
+	device, err := s.repo.FindByID(id)
+	if err != nil {
+		return "", err
+	}
+
+	privateKey, err := exporter.ExportKey(device.KeyID, device.Algorithm, device.KeyHandle)
+	if err != nil {
+		return "", &KeyError{Op: "export private key", Err: err}
+	}
+
+	encrypted, err := s.utils.EncryptPrivateKey(privateKey, password)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	return encrypted, nil
+}
+
+// Whether an export failed because the request was refused, rather than because of a failure of the service
+func isExportDenial(err error) bool {
+	return errors.Is(err, ErrKeyExportDisabled) || errors.Is(err, crypto.ErrKeyNotExportable) ||
+		errors.Is(err, ErrWeakExportPassword) || errors.Is(err, persistence.ErrDeviceNotFound)
+}
+
+// Build the signing options recorded on the device
+func deviceSignOptions(device *model.Device) crypto.SignOptions {
+	return crypto.SignOptions{
+		Digest:        device.Digest,
+		Padding:       device.Padding,
+		SaltLength:    device.SaltLength,
+		Encoding:      device.Encoding,
+		Deterministic: device.Deterministic,
+	}
+}
@@ -9,24 +9,69 @@ import (
 
 // MockDeviceService is a mock implementation of DeviceServiceInterface for testing purposes
 type MockDeviceService struct {
-	CreateSignatureDeviceFunc func(ctx context.Context, algorithm, label string) (model.Device, error)
-	SignTransactionFunc       func(ctx context.Context, id uuid.UUID, data string) (model.SignaturedData, error)
-	GetDeviceFunc             func(ctx context.Context, id uuid.UUID) (model.Device, error)
-	GetAllDevicesFunc         func(ctx context.Context) ([]model.Device, error)
+	CreateSignatureDeviceFunc     func(ctx context.Context, spec DeviceSpec) (model.Device, error)
+	RotateDeviceKeyFunc           func(ctx context.Context, id uuid.UUID) (model.Device, error)
+	ImportSignatureDeviceFunc     func(ctx context.Context, spec ImportSpec) (model.Device, error)
+	SignTransactionFunc           func(ctx context.Context, id uuid.UUID, data string) (model.SignaturedData, error)
+	SignTransactionIdempotentFunc func(ctx context.Context, id uuid.UUID, data, idempotencyKey string) (model.SignaturedData, error)
+	VerifySignatureFunc           func(ctx context.Context, id uuid.UUID, signedData string, signature []byte) (model.Verification, error)
+	AuditSignatureChainFunc       func(ctx context.Context, id uuid.UUID) (model.ChainAudit, error)
+	ListSignaturesFunc            func(ctx context.Context, id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error)
+	GetSignatureFunc              func(ctx context.Context, id uuid.UUID, counter int) (model.SignatureRecord, error)
+	GetDeviceFunc                 func(ctx context.Context, id uuid.UUID) (model.Device, error)
+	GetDeviceKeyFunc              func(ctx context.Context, id uuid.UUID, keyID string) (model.DeviceKey, error)
+	GetAllDevicesFunc             func(ctx context.Context) ([]model.Device, error)
+	ExportPrivateKeyFunc          func(ctx context.Context, id uuid.UUID, password string) (string, error)
 }
 
-func (m *MockDeviceService) CreateSignatureDevice(ctx context.Context, algorithm, label string) (model.Device, error) {
-	return m.CreateSignatureDeviceFunc(ctx, algorithm, label)
+func (m *MockDeviceService) CreateSignatureDevice(ctx context.Context, spec DeviceSpec) (model.Device, error) {
+	return m.CreateSignatureDeviceFunc(ctx, spec)
+}
+
+func (m *MockDeviceService) RotateDeviceKey(ctx context.Context, id uuid.UUID) (model.Device, error) {
+	return m.RotateDeviceKeyFunc(ctx, id)
+}
+
+func (m *MockDeviceService) ImportSignatureDevice(ctx context.Context, spec ImportSpec) (model.Device, error) {
+	return m.ImportSignatureDeviceFunc(ctx, spec)
 }
 
 func (m *MockDeviceService) SignTransaction(ctx context.Context, id uuid.UUID, data string) (model.SignaturedData, error) {
 	return m.SignTransactionFunc(ctx, id, data)
 }
 
+func (m *MockDeviceService) SignTransactionIdempotent(ctx context.Context, id uuid.UUID, data, idempotencyKey string) (model.SignaturedData, error) {
+	return m.SignTransactionIdempotentFunc(ctx, id, data, idempotencyKey)
+}
+
+func (m *MockDeviceService) VerifySignature(ctx context.Context, id uuid.UUID, signedData string, signature []byte) (model.Verification, error) {
+	return m.VerifySignatureFunc(ctx, id, signedData, signature)
+}
+
+func (m *MockDeviceService) AuditSignatureChain(ctx context.Context, id uuid.UUID) (model.ChainAudit, error) {
+	return m.AuditSignatureChainFunc(ctx, id)
+}
+
+func (m *MockDeviceService) ListSignatures(ctx context.Context, id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error) {
+	return m.ListSignaturesFunc(ctx, id, offset, limit)
+}
+
+func (m *MockDeviceService) GetSignature(ctx context.Context, id uuid.UUID, counter int) (model.SignatureRecord, error) {
+	return m.GetSignatureFunc(ctx, id, counter)
+}
+
 func (m *MockDeviceService) GetDevice(ctx context.Context, id uuid.UUID) (model.Device, error) {
 	return m.GetDeviceFunc(ctx, id)
 }
 
+func (m *MockDeviceService) GetDeviceKey(ctx context.Context, id uuid.UUID, keyID string) (model.DeviceKey, error) {
+	return m.GetDeviceKeyFunc(ctx, id, keyID)
+}
+
 func (m *MockDeviceService) GetAllDevices(ctx context.Context) ([]model.Device, error) {
 	return m.GetAllDevicesFunc(ctx)
 }
+
+func (m *MockDeviceService) ExportPrivateKey(ctx context.Context, id uuid.UUID, password string) (string, error) {
+	return m.ExportPrivateKeyFunc(ctx, id, password)
+}
@@ -0,0 +1,234 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Versions of the formats of the secured data signed by the devices
+const (
+	// SecuredDataFormatV1 is "<counter>_<data>_<last signature>", the format of the devices created before
+	// the format was versioned. Its fields are only told apart because the counter and the base64 encoded last
+	// signature cannot contain underscores.
+	SecuredDataFormatV1 = "v1"
+	// SecuredDataFormatV2 is "v2_<counter>_<time>_<algorithm>_<data length>_<data>_<last signature>", with the time
+	// of the signature in RFC 3339 and the length of the data in bytes, so the data is read without looking at it
+	SecuredDataFormatV2 = "v2"
+)
+
+// DefaultSecuredDataFormat is the format of the devices created without choosing one
+const DefaultSecuredDataFormat = SecuredDataFormatV1
+
+// ErrUnsupportedSecuredDataFormat is returned when no secured data formatter is registered with the requested version
+var ErrUnsupportedSecuredDataFormat = errors.New("unsupported secured data format")
+
+// SecuredData is the content of the data signed by a device: the counter of the signature, the data as requested
+// and the signature it is chained to. Formats after v1 also carry the time of the signature and the algorithm of the device.
+type SecuredData struct {
+	Counter       int
+	Data          string
+	LastSignature string
+	Time          time.Time
+	Algorithm     string
+}
+
+// SecuredDataFormatter builds the secured data signed by a device with a version of the format, and parses it back.
+// Parse returns an error matching ErrMalformedSignedData when the signed data does not have the format.
+type SecuredDataFormatter interface {
+	Version() string
+	Format(data SecuredData) (string, error)
+	Parse(signedData string) (SecuredData, error)
+}
+
+// SecuredDataV1 formats secured data as "<counter>_<data>_<last signature>"
+type SecuredDataV1 struct{}
+
+func (SecuredDataV1) Version() string {
+	return SecuredDataFormatV1
+}
+
+// Format builds the secured data, leaving out its time and algorithm
+func (SecuredDataV1) Format(data SecuredData) (string, error) {
+	return fmt.Sprintf("%d_%s_%s", data.Counter, data.Data, data.LastSignature), nil
+}
+
+// Parse splits signed data into its counter, data and last signature. The data may contain underscores,
+// the counter and the base64 encoded last signature cannot.
+func (SecuredDataV1) Parse(signedData string) (SecuredData, error) {
+	counterPart, rest, found := strings.Cut(signedData, "_")
+	separator := strings.LastIndex(rest, "_")
+	if !found || separator < 0 {
+		return SecuredData{}, fmt.Errorf("%w: expected \"<counter>_<data>_<last signature>\"", ErrMalformedSignedData)
+	}
+
+	counter, err := parseSecuredCounter(counterPart)
+	if err != nil {
+		return SecuredData{}, err
+	}
+	data := SecuredData{Counter: counter, Data: rest[:separator], LastSignature: rest[separator+1:]}
+	if err := checkSecuredLastSignature(data.LastSignature); err != nil {
+		return SecuredData{}, err
+	}
+
+	return data, nil
+}
+
+// SecuredDataV2 formats secured data as "v2_<counter>_<time>_<algorithm>_<data length>_<data>_<last signature>"
+type SecuredDataV2 struct{}
+
+func (SecuredDataV2) Version() string {
+	return SecuredDataFormatV2
+}
+
+// Format builds the secured data with its time in UTC. The algorithm cannot be empty nor contain underscores.
+func (SecuredDataV2) Format(data SecuredData) (string, error) {
+	if data.Algorithm == "" || strings.Contains(data.Algorithm, "_") {
+		return "", fmt.Errorf("algorithm %q cannot be written in the %s secured data format", data.Algorithm, SecuredDataFormatV2)
+	}
+
+	return fmt.Sprintf("%s_%d_%s_%s_%d_%s_%s", SecuredDataFormatV2, data.Counter, data.Time.UTC().Format(time.RFC3339Nano),
+		data.Algorithm, len(data.Data), data.Data, data.LastSignature), nil
+}
+
+// Parse reads the fields of signed data in order, taking the data by its length
+func (SecuredDataV2) Parse(signedData string) (SecuredData, error) {
+	malformed := fmt.Errorf("%w: expected \"v2_<counter>_<time>_<algorithm>_<data length>_<data>_<last signature>\"", ErrMalformedSignedData)
+	rest, found := strings.CutPrefix(signedData, SecuredDataFormatV2+"_")
+	if !found {
+		return SecuredData{}, malformed
+	}
+	fields := strings.SplitN(rest, "_", 5)
+	if len(fields) != 5 || fields[2] == "" {
+		return SecuredData{}, malformed
+	}
+
+	counter, err := parseSecuredCounter(fields[0])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	signedAt, err := time.Parse(time.RFC3339Nano, fields[1])
+	if err != nil {
+		return SecuredData{}, fmt.Errorf("%w: the time must be in RFC 3339 format", ErrMalformedSignedData)
+	}
+	length, err := strconv.Atoi(fields[3])
+	if err != nil || length < 0 || strconv.Itoa(length) != fields[3] {
+		return SecuredData{}, fmt.Errorf("%w: the data length must be a non-negative integer", ErrMalformedSignedData)
+	}
+	if len(fields[4]) <= length || fields[4][length] != '_' {
+		return SecuredData{}, fmt.Errorf("%w: the data is not %d bytes long", ErrMalformedSignedData, length)
+	}
+
+	data := SecuredData{
+		Counter:       counter,
+		Data:          fields[4][:length],
+		LastSignature: fields[4][length+1:],
+		Time:          signedAt.UTC(),
+		Algorithm:     fields[2],
+	}
+	if err := checkSecuredLastSignature(data.LastSignature); err != nil {
+		return SecuredData{}, err
+	}
+
+	return data, nil
+}
+
+// Parse the counter field of secured data, which must be written without sign nor leading zeros
+func parseSecuredCounter(field string) (int, error) {
+	counter, err := strconv.Atoi(field)
+	if err != nil || counter < 0 || strconv.Itoa(counter) != field {
+		return 0, fmt.Errorf("%w: the counter must be a non-negative integer", ErrMalformedSignedData)
+	}
+
+	return counter, nil
+}
+
+// Check the last signature field of secured data, which must be base64 encoded
+func checkSecuredLastSignature(field string) error {
+	if _, err := base64.StdEncoding.DecodeString(field); err != nil || field == "" {
+		return fmt.Errorf("%w: the last signature must be base64 encoded", ErrMalformedSignedData)
+	}
+
+	return nil
+}
+
+// SecuredDataFormats holds the supported secured data formatters indexed by version.
+type SecuredDataFormats struct {
+	formatters map[string]SecuredDataFormatter
+	mu         sync.RWMutex
+}
+
+// DefaultSecuredDataFormats contains every secured data format supported by the service.
+var DefaultSecuredDataFormats = NewSecuredDataFormats(SecuredDataV1{}, SecuredDataV2{})
+
+// NewSecuredDataFormats creates a registry with the given formatters.
+func NewSecuredDataFormats(formatters ...SecuredDataFormatter) *SecuredDataFormats {
+	f := &SecuredDataFormats{
+		formatters: make(map[string]SecuredDataFormatter),
+	}
+	for _, formatter := range formatters {
+		f.Register(formatter)
+	}
+
+	return f
+}
+
+// Register adds a formatter to the registry, replacing any formatter with the same version
+func (f *SecuredDataFormats) Register(formatter SecuredDataFormatter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.formatters[formatter.Version()] = formatter
+}
+
+// Get retrieves a formatter by its version
+func (f *SecuredDataFormats) Get(version string) (SecuredDataFormatter, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	formatter, exists := f.formatters[version]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSecuredDataFormat, version)
+	}
+
+	return formatter, nil
+}
+
+// Parse parses signed data with the formatter of its version. Formats after v1 start with their version, e.g.
+// "v2_", while v1 signed data starts with its counter.
+func (f *SecuredDataFormats) Parse(signedData string) (string, SecuredData, error) {
+	version := SecuredDataFormatV1
+	if prefix, _, found := strings.Cut(signedData, "_"); found && strings.HasPrefix(prefix, "v") {
+		version = prefix
+	}
+
+	formatter, err := f.Get(version)
+	if err != nil {
+		return version, SecuredData{}, fmt.Errorf("%w: %w", ErrMalformedSignedData, err)
+	}
+	data, err := formatter.Parse(signedData)
+	if err != nil {
+		return version, SecuredData{}, err
+	}
+
+	return version, data, nil
+}
+
+// Versions returns the versions of the registered formatters sorted alphabetically
+func (f *SecuredDataFormats) Versions() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	versions := make([]string, 0, len(f.formatters))
+	for version := range f.formatters {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	return versions
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SecuredDataFormats", func() {
+	securedData := SecuredData{
+		Counter:       12,
+		Data:          "amount_10_currency_EUR",
+		LastSignature: "bGFzdA==",
+		Time:          time.Date(2026, 3, 1, 12, 30, 0, 500, time.UTC),
+		Algorithm:     "ECC",
+	}
+
+	Describe("SecuredDataV1", func() {
+		It("should format the counter, the data and the last signature", func() {
+			signedData, err := SecuredDataV1{}.Format(securedData)
+			Expect(err).To(BeNil(), "Failed to format the secured data")
+			Expect(signedData).To(Equal("12_amount_10_currency_EUR_bGFzdA=="), "The v1 format should not change")
+		})
+
+		It("should parse the data it formats", func() {
+			parsed, err := SecuredDataV1{}.Parse("12_amount_10_currency_EUR_bGFzdA==")
+			Expect(err).To(BeNil(), "Failed to parse the signed data")
+			Expect(parsed).To(Equal(SecuredData{Counter: 12, Data: "amount_10_currency_EUR", LastSignature: "bGFzdA=="}), "The fields should be parsed")
+		})
+	})
+
+	Describe("SecuredDataV2", func() {
+		It("should parse the data it formats", func() {
+			signedData, err := SecuredDataV2{}.Format(securedData)
+			Expect(err).To(BeNil(), "Failed to format the secured data")
+			Expect(signedData).To(Equal("v2_12_2026-03-01T12:30:00.0000005Z_ECC_22_amount_10_currency_EUR_bGFzdA=="), "The data should be length-prefixed")
+
+			parsed, err := SecuredDataV2{}.Parse(signedData)
+			Expect(err).To(BeNil(), "Failed to parse the signed data")
+			Expect(parsed).To(Equal(securedData), "Every field should be parsed back")
+		})
+
+		It("should keep data ending like a last signature", func() {
+			data := securedData
+			data.Data = "x_bGFzdA=="
+			signedData, err := SecuredDataV2{}.Format(data)
+			Expect(err).To(BeNil(), "Failed to format the secured data")
+
+			parsed, err := SecuredDataV2{}.Parse(signedData)
+			Expect(err).To(BeNil(), "Failed to parse the signed data")
+			Expect(parsed.Data).To(Equal("x_bGFzdA=="), "The data should be read by its length")
+			Expect(parsed.LastSignature).To(Equal("bGFzdA=="), "The last signature should follow the data")
+		})
+
+		It("should not format algorithms that cannot be parsed back", func() {
+			for _, algorithm := range []string{"", "RSA_PSS"} {
+				data := securedData
+				data.Algorithm = algorithm
+				_, err := SecuredDataV2{}.Format(data)
+				Expect(err).To(HaveOccurred(), "Algorithm %q should be rejected", algorithm)
+			}
+		})
+
+		It("should reject signed data without the v2 structure", func() {
+			for _, signedData := range []string{
+				"12_data_bGFzdA==",
+				"v2_12_2026-03-01T12:30:00Z_ECC_4_data",
+				"v2_x_2026-03-01T12:30:00Z_ECC_4_data_bGFzdA==",
+				"v2_12_yesterday_ECC_4_data_bGFzdA==",
+				"v2_12_2026-03-01T12:30:00Z__4_data_bGFzdA==",
+				"v2_12_2026-03-01T12:30:00Z_ECC_04_data_bGFzdA==",
+				"v2_12_2026-03-01T12:30:00Z_ECC_3_data_bGFzdA==",
+				"v2_12_2026-03-01T12:30:00Z_ECC_40_data_bGFzdA==",
+				"v2_12_2026-03-01T12:30:00Z_ECC_4_data_",
+			} {
+				_, err := SecuredDataV2{}.Parse(signedData)
+				Expect(err).To(MatchError(ErrMalformedSignedData), "%q should be rejected", signedData)
+			}
+		})
+	})
+
+	Describe("Parse", func() {
+		It("should parse signed data with the formatter of its version", func() {
+			version, parsed, err := DefaultSecuredDataFormats.Parse("v2_12_2026-03-01T12:30:00.0000005Z_ECC_22_amount_10_currency_EUR_bGFzdA==")
+			Expect(err).To(BeNil(), "Failed to parse the v2 signed data")
+			Expect(version).To(Equal(SecuredDataFormatV2), "The version should be read from the prefix")
+			Expect(parsed).To(Equal(securedData), "The v2 fields should be parsed")
+
+			version, parsed, err = DefaultSecuredDataFormats.Parse("12_amount_10_currency_EUR_bGFzdA==")
+			Expect(err).To(BeNil(), "Failed to parse the v1 signed data")
+			Expect(version).To(Equal(SecuredDataFormatV1), "Signed data starting with its counter should be v1")
+			Expect(parsed.Data).To(Equal("amount_10_currency_EUR"), "The v1 fields should be parsed")
+		})
+
+		It("should report unknown versions as malformed", func() {
+			_, _, err := DefaultSecuredDataFormats.Parse("v9_12_data_bGFzdA==")
+			Expect(err).To(MatchError(ErrMalformedSignedData), "The signed data should be malformed")
+			Expect(err).To(MatchError(ErrUnsupportedSecuredDataFormat), "The version should be reported as unsupported")
+		})
+
+		It("should only parse the registered versions", func() {
+			formats := NewSecuredDataFormats(SecuredDataV1{})
+			_, err := formats.Get(SecuredDataFormatV2)
+			Expect(err).To(MatchError(ErrUnsupportedSecuredDataFormat), "v2 should not be registered")
+			Expect(formats.Versions()).To(Equal([]string{SecuredDataFormatV1}), "Only v1 should be registered")
+		})
+	})
+})
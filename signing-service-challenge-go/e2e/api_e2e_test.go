@@ -2,13 +2,33 @@ package e2etests
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	servicecrypto "github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/domain"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/utils"
 	. "github.com/onsi/ginkgo/v2"
@@ -21,6 +41,7 @@ var _ = Describe("Device API End-to-End", func() {
 	var (
 		deviceRepo    persistence.DeviceRepoInterface
 		realUtils     utils.UtilsInterface
+		keyStore      servicecrypto.KeyStore
 		deviceService domain.DeviceServiceInterface
 		deviceApi     *api.DeviceApi
 		w             *httptest.ResponseRecorder
@@ -28,9 +49,10 @@ var _ = Describe("Device API End-to-End", func() {
 	)
 
 	BeforeEach(func() {
-		realUtils = &utils.RealUtils{}
+		realUtils = utils.NewRealUtils(nil)
 		deviceRepo = persistence.NewDeviceRepository()
-		deviceService = domain.NewDeviceService(deviceRepo, realUtils, nil)
+		keyStore = servicecrypto.NewSoftwareKeyStore(servicecrypto.DefaultRegistry, servicecrypto.NewEphemeralKeyWrapper())
+		deviceService = domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore))
 		deviceApi = api.NewDeviceApi(deviceService, realUtils)
 		w = httptest.NewRecorder()
 	})
@@ -46,6 +68,7 @@ var _ = Describe("Device API End-to-End", func() {
 
 				// Verify response code
 				Expect(w.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+				Expect(w.Body.String()).ToNot(ContainSubstring("PRIVATE KEY"), "Expected no private key material in the response")
 
 				var wrapper struct {
 					Data api.CreateDeviceResponse `json:"data"`
@@ -59,7 +82,69 @@ var _ = Describe("Device API End-to-End", func() {
 				Expect(resp.ID).ToNot(BeEmpty(), "Expected ID to be generated")
 				Expect(resp.ID).To(BeAssignableToTypeOf(uuid.UUID{}), "Expected ID to be of type uuid.UUID")
 				Expect(resp.PublicKey).ToNot(BeEmpty(), "Expected PublicKey to be generated")
-				Expect(resp.PrivateKey).ToNot(BeEmpty(), "Expected PrivateKey to be generated")
+			})
+		})
+	})
+
+	Describe("ImportSignatureDevice", func() {
+		Context("when importing a PKCS#8 key with an existing chain", func() {
+			It("should continue the chain with the imported key", func() {
+				// Export a key from the "legacy" system
+				legacyKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				Expect(err).To(BeNil(), "Failed to generate legacy key")
+				privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(legacyKey)
+				Expect(err).To(BeNil(), "Failed to marshal legacy key")
+				privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})
+
+				// Import the device
+				body, _ := json.Marshal(api.ImportDeviceRequest{
+					Algorithm:        "ECC",
+					Label:            "legacy",
+					PrivateKey:       string(privateKeyPEM),
+					SignatureCounter: 5,
+					LastSignature:    "bGVnYWN5LXNpZ25hdHVyZQ==",
+				})
+				r := httptest.NewRequest("POST", "/import-device", bytes.NewReader(body))
+				deviceApi.ImportSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusCreated), "Failed importing the device")
+
+				var imported struct {
+					Data api.GetDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&imported)).To(Succeed(), "Expected to decode response body without error")
+				Expect(imported.Data.Curve).To(Equal("P-256"), "Expected the curve of the imported key")
+				Expect(imported.Data.SignatureCounter).To(Equal(5), "Expected the imported signature counter")
+				w = httptest.NewRecorder()
+
+				// Sign with the imported device
+				body, _ = json.Marshal(map[string]string{"data": "hello Fiskaly!"})
+				req := httptest.NewRequest("POST", fmt.Sprintf("/sign?deviceId=%s", imported.Data.ID.String()), bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				deviceApi.SignTransaction(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				var wrapper struct {
+					Data api.SignaturedDataResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&wrapper)).To(Succeed(), "Expected to decode response body without error")
+				Expect(wrapper.Data.SignedData).To(Equal("5_hello Fiskaly!_bGVnYWN5LXNpZ25hdHVyZQ=="), "Expected the chain to resume from the imported state")
+
+				// The legacy public key should verify the new signature
+				hashed := sha256.Sum256([]byte(wrapper.Data.SignedData))
+				Expect(ecdsa.VerifyASN1(&legacyKey.PublicKey, hashed[:], wrapper.Data.Signature)).To(BeTrue(), "Expected the signature to be valid for the legacy key")
+			})
+		})
+
+		Context("when the key does not match the algorithm", func() {
+			It("should return a 400 error", func() {
+				legacyKey, err := rsa.GenerateKey(rand.Reader, 2048)
+				Expect(err).To(BeNil(), "Failed to generate legacy key")
+				privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(legacyKey)})
+
+				body, _ := json.Marshal(api.ImportDeviceRequest{Algorithm: "ECC", Label: "legacy", PrivateKey: string(privateKeyPEM)})
+				r := httptest.NewRequest("POST", "/import-device", bytes.NewReader(body))
+				deviceApi.ImportSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
 			})
 		})
 	})
@@ -114,6 +199,131 @@ var _ = Describe("Device API End-to-End", func() {
 				Expect(resp).To(BeAssignableToTypeOf(api.SignaturedDataResponse{}), "Expected data to be of type SignaturedDataResponse")
 				Expect(resp.Signature).ToNot(BeEmpty(), "Expected non-empty signature")
 				Expect(resp.SignedData).To(ContainSubstring(text), "Expected signed data to match input data")
+				Expect(resp.Digest).To(Equal("SHA-384"), "Expected the P-384 device to sign with SHA-384")
+			})
+		})
+
+		Context("when the device uses ED25519", func() {
+			It("should sign data with a verifiable Ed25519 signature", func() {
+				// Creating an Ed25519 device
+				r := httptest.NewRequest("POST", "/new-device?algorithm=ED25519&label=edlabel", nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the Ed25519 device")
+
+				var created struct {
+					Data api.CreateDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+				w = httptest.NewRecorder()
+
+				// Prepare the request
+				body, _ := json.Marshal(map[string]string{"data": "hello Fiskaly!"})
+				url := fmt.Sprintf("/sign?deviceId=%s", created.Data.ID.String())
+				req := httptest.NewRequest("POST", url, bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+
+				// Call the handler
+				deviceApi.SignTransaction(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				var wrapper struct {
+					Data api.SignaturedDataResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&wrapper)).To(Succeed(), "Expected to decode response body without error")
+
+				// Verify the signature with the returned public key
+				block, _ := pem.Decode([]byte(created.Data.PublicKey))
+				Expect(block).ToNot(BeNil(), "Expected a PEM encoded public key")
+				publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+				Expect(err).To(BeNil(), "Expected a PKIX public key")
+				Expect(publicKey).To(BeAssignableToTypeOf(ed25519.PublicKey{}), "Expected an Ed25519 public key")
+				Expect(wrapper.Data.Signature).To(HaveLen(ed25519.SignatureSize), "Expected a fixed size Ed25519 signature")
+				Expect(ed25519.Verify(publicKey.(ed25519.PublicKey), []byte(wrapper.Data.SignedData), wrapper.Data.Signature)).To(BeTrue(), "Expected the signature to be valid")
+			})
+		})
+
+		Context("when the device uses raw ECDSA signatures", func() {
+			It("should return fixed size r||s signatures", func() {
+				// Creating a P-521 device with P1363 encoding
+				r := httptest.NewRequest("POST", "/new-device?algorithm=ECC&label=rawlabel&curve=P-521&encoding=P1363", nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the P1363 device")
+
+				var created struct {
+					Data api.CreateDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+				Expect(created.Data.Encoding).To(Equal("P1363"), "Expected the device encoding to be P1363")
+				w = httptest.NewRecorder()
+
+				// Prepare the request
+				body, _ := json.Marshal(map[string]string{"data": "hello Fiskaly!"})
+				url := fmt.Sprintf("/sign?deviceId=%s", created.Data.ID.String())
+				req := httptest.NewRequest("POST", url, bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+
+				// Call the handler
+				deviceApi.SignTransaction(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				var wrapper struct {
+					Data api.SignaturedDataResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&wrapper)).To(Succeed(), "Expected to decode response body without error")
+				Expect(wrapper.Data.Encoding).To(Equal("P1363"), "Expected the response to document the encoding")
+				Expect(wrapper.Data.Digest).To(Equal("SHA-512"), "Expected the P-521 device to sign with SHA-512")
+				Expect(wrapper.Data.Signature).To(HaveLen(132), "Expected a 2 x 66 bytes P-521 signature")
+
+				// Verify the raw signature with the returned public key
+				block, _ := pem.Decode([]byte(created.Data.PublicKey))
+				Expect(block).ToNot(BeNil(), "Expected a PEM encoded public key")
+				publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+				Expect(err).To(BeNil(), "Expected a PKIX public key")
+				hashed := sha512.Sum512([]byte(wrapper.Data.SignedData))
+				rValue := new(big.Int).SetBytes(wrapper.Data.Signature[:66])
+				sValue := new(big.Int).SetBytes(wrapper.Data.Signature[66:])
+				Expect(ecdsa.Verify(publicKey.(*ecdsa.PublicKey), hashed[:], rValue, sValue)).To(BeTrue(), "Expected the raw signature to be valid")
+			})
+		})
+
+		Context("when the device uses RSA-PSS", func() {
+			It("should sign data with a verifiable PSS signature", func() {
+				// Creating an RSA-PSS device
+				r := httptest.NewRequest("POST", "/new-device?algorithm=RSA&label=psslabel&padding=PSS&saltLength=20", nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the RSA-PSS device")
+
+				var created struct {
+					Data api.CreateDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+				Expect(created.Data.Padding).To(Equal("PSS"), "Expected the device padding to be PSS")
+				Expect(created.Data.SaltLength).To(Equal(20), "Expected the device salt length to be 20")
+				w = httptest.NewRecorder()
+
+				// Prepare the request
+				body, _ := json.Marshal(map[string]string{"data": "hello Fiskaly!"})
+				url := fmt.Sprintf("/sign?deviceId=%s", created.Data.ID.String())
+				req := httptest.NewRequest("POST", url, bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+
+				// Call the handler
+				deviceApi.SignTransaction(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK))
+
+				var wrapper struct {
+					Data api.SignaturedDataResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&wrapper)).To(Succeed(), "Expected to decode response body without error")
+
+				// Verify the signature with the returned public key
+				block, _ := pem.Decode([]byte(created.Data.PublicKey))
+				Expect(block).ToNot(BeNil(), "Expected a PEM encoded public key")
+				publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+				Expect(err).To(BeNil(), "Expected a PKIX public key")
+				hashed := sha256.Sum256([]byte(wrapper.Data.SignedData))
+				err = rsa.VerifyPSS(publicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], wrapper.Data.Signature, &rsa.PSSOptions{SaltLength: 20})
+				Expect(err).To(BeNil(), "Expected the PSS signature to be valid")
 			})
 		})
 
@@ -190,6 +400,64 @@ var _ = Describe("Device API End-to-End", func() {
 				Expect(resp.Algorithm).To(Equal("RSA"), "Expected algorithm to be RSA")
 				Expect(resp.Label).To(Equal("testlabel"), "Expected label to be 'testlabel'")
 				Expect(resp.SignatureCounter).To(Equal(0), "Expected signature counter to be 0")
+				Expect(resp.KeySize).To(Equal(2048), "Expected the default RSA key size of 2048 bits")
+			})
+		})
+
+		Context("when the device was created with key parameters", func() {
+			It("should return the chosen key parameters", func() {
+				// Creating a P-256 device
+				r := httptest.NewRequest("POST", "/new-device?algorithm=ECC&label=p256&curve=P-256", nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the P-256 device")
+
+				var created struct {
+					Data api.CreateDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+				w = httptest.NewRecorder()
+
+				// Prepare the request
+				url := fmt.Sprintf("/device?deviceId=%s", created.Data.ID.String())
+				req := httptest.NewRequest("GET", url, nil)
+
+				// Call the handler
+				deviceApi.GetDevice(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+
+				var wrapper struct {
+					Data api.GetDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&wrapper)).To(Succeed(), "Expected to decode response body without error")
+
+				// Check the response
+				Expect(wrapper.Data.Curve).To(Equal("P-256"), "Expected the device curve to be P-256")
+				Expect(wrapper.Data.KeySize).To(Equal(256), "Expected the device key size to be 256")
+				Expect(wrapper.Data.Digest).To(Equal("SHA-256"), "Expected the P-256 device to default to SHA-256")
+			})
+
+			It("should reject keys below the server policy", func() {
+				r := httptest.NewRequest("POST", "/new-device?algorithm=RSA&label=weak&keySize=1024", nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+			})
+
+			It("should return whether the device signs deterministically", func() {
+				r := httptest.NewRequest("POST", "/new-device?algorithm=ECC&label=deterministic&deterministic=true", nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the deterministic device")
+
+				var created struct {
+					Data api.CreateDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+				Expect(created.Data.Deterministic).To(BeTrue(), "Expected the device to be deterministic")
+			})
+
+			It("should reject deterministic RSA devices", func() {
+				r := httptest.NewRequest("POST", "/new-device?algorithm=RSA&label=deterministic&deterministic=true", nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
 			})
 		})
 
@@ -216,6 +484,713 @@ var _ = Describe("Device API End-to-End", func() {
 		})
 	})
 
+	Describe("ExportPrivateKey", func() {
+		var created struct {
+			Data api.CreateDeviceResponse `json:"data"`
+		}
+
+		BeforeEach(func() {
+			r := httptest.NewRequest("POST", "/new-device?algorithm=ECC&label=exported", nil)
+			deviceApi.CreateSignatureDevice(w, r)
+			Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Setup failed in BeforeEach")
+			w = httptest.NewRecorder()
+		})
+
+		Context("when key export is disabled", func() {
+			It("should return a 403 error", func() {
+				body, _ := json.Marshal(api.ExportKeyRequest{Password: "correct horse battery staple"})
+				r := httptest.NewRequest("POST", fmt.Sprintf("/export-key?deviceId=%s", created.Data.ID), bytes.NewReader(body))
+				deviceApi.ExportPrivateKey(w, r)
+				Expect(w.Code).To(Equal(http.StatusForbidden), "Expected status code 403 Forbidden")
+			})
+		})
+
+		Context("when key export is enabled", func() {
+			It("should return a key that decrypts with the password and matches the device", func() {
+				exportService := domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore), domain.WithKeyExport(true))
+				exportApi := api.NewDeviceApi(exportService, realUtils)
+
+				body, _ := json.Marshal(api.ExportKeyRequest{Password: "correct horse battery staple"})
+				r := httptest.NewRequest("POST", fmt.Sprintf("/export-key?deviceId=%s", created.Data.ID), bytes.NewReader(body))
+				exportApi.ExportPrivateKey(w, r)
+				Expect(w.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+
+				var wrapper struct {
+					Data api.ExportKeyResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&wrapper)).To(Succeed(), "Expected to decode response body without error")
+
+				// The decrypted key should belong to the public key of the device
+				privateKey, err := servicecrypto.DecryptPKCS8PrivateKey([]byte(wrapper.Data.PrivateKey), []byte("correct horse battery staple"))
+				Expect(err).To(BeNil(), "Expected the key to decrypt with the password")
+				publicKeyPEM, err := realUtils.PublicKeyToString("ECC", &privateKey.(*ecdsa.PrivateKey).PublicKey)
+				Expect(err).To(BeNil(), "Failed to encode the public key")
+				Expect(publicKeyPEM).To(Equal(created.Data.PublicKey), "Expected the exported key to belong to the device")
+			})
+		})
+	})
+
+	Describe("Private keys at rest", func() {
+		It("should only store wrapped keys and keep signing across master key rotations", func() {
+			oldMasterKey := servicecrypto.NewEphemeralMasterKey()
+			newMasterKey := servicecrypto.NewEphemeralMasterKey()
+			oldWrapper, err := servicecrypto.NewKeyWrapper(oldMasterKey)
+			Expect(err).To(BeNil(), "Failed to create the key wrapper")
+			service := domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(servicecrypto.NewSoftwareKeyStore(servicecrypto.DefaultRegistry, oldWrapper)))
+
+			// Create a device with the old master key
+			device, err := service.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ECC", Label: "wrapped"})
+			Expect(err).To(BeNil(), "Failed to create the device")
+			stored, err := deviceRepo.FindByID(device.ID)
+			Expect(err).To(BeNil(), "Failed to find the device")
+			Expect(string(stored.KeyHandle)).ToNot(ContainSubstring("PRIVATE KEY"), "Expected no plaintext private key at rest")
+
+			// Rotate the master key and rewrap the stored keys
+			rotatedWrapper, err := servicecrypto.NewKeyWrapper(newMasterKey, oldMasterKey)
+			Expect(err).To(BeNil(), "Failed to create the key wrapper")
+			service = domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(servicecrypto.NewSoftwareKeyStore(servicecrypto.DefaultRegistry, rotatedWrapper)))
+			_, err = service.SignTransaction(context.Background(), device.ID, "before rewrap")
+			Expect(err).To(BeNil(), "Expected keys of the previous master key to keep working")
+			count, err := service.RewrapPrivateKeys(context.Background())
+			Expect(err).To(BeNil(), "Failed to rewrap the keys")
+			Expect(count).To(Equal(1), "Expected the key of the device to be rewrapped")
+
+			// Retire the old master key
+			newWrapper, err := servicecrypto.NewKeyWrapper(newMasterKey)
+			Expect(err).To(BeNil(), "Failed to create the key wrapper")
+			service = domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(servicecrypto.NewSoftwareKeyStore(servicecrypto.DefaultRegistry, newWrapper)))
+			signaturedData, err := service.SignTransaction(context.Background(), device.ID, "after rewrap")
+			Expect(err).To(BeNil(), "Expected the rewrapped key to work without the old master key")
+			Expect(signaturedData.SignedData).To(HavePrefix("1_"), "Expected the counter to survive the rewrap")
+		})
+
+		It("should require master keys to store the devices in a database", func() {
+			for _, driver := range []string{api.FileDatabaseDriver, "sqlite"} {
+				_, err := api.NewServer(":0", api.Config{DatabaseDriver: driver, DatabaseDSN: "file:" + filepath.Join(GinkgoT().TempDir(), "devices.db")})
+				Expect(err).To(MatchError(api.ErrMissingMasterKeys), "Expected the %s driver to require master keys", driver)
+			}
+
+			_, err := api.NewServer(":0", api.Config{})
+			Expect(err).To(BeNil(), "Expected the in-memory devices to use an ephemeral master key")
+		})
+
+		It("should let operators retire a master key by rewrapping the stored keys through the server", func() {
+			oldMasterKey := servicecrypto.NewEphemeralMasterKey()
+			newMasterKey := servicecrypto.NewEphemeralMasterKey()
+			dsn := "file:" + filepath.Join(GinkgoT().TempDir(), "devices.db")
+			newServer := func(masterKeys ...servicecrypto.MasterKey) *api.Server {
+				server, err := api.NewServer(":0", api.Config{MasterKeys: masterKeys, DatabaseDriver: "sqlite", DatabaseDSN: dsn})
+				Expect(err).To(BeNil(), "Failed to create the server")
+				return server
+			}
+			serve := func(server *api.Server, method, target, body string) *httptest.ResponseRecorder {
+				recorder := httptest.NewRecorder()
+				server.Handler().ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+				return recorder
+			}
+
+			// Create a device with the old master key
+			created := serve(newServer(oldMasterKey), "POST", "/api/v1/devices", `{"algorithm":"ECC"}`)
+			Expect(created.Code).To(Equal(http.StatusCreated), "Failed creating the device")
+			var device struct {
+				Data api.CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(created.Body).Decode(&device)).To(Succeed(), "Expected to decode the created device")
+
+			// Rewrap with the new master key active, as the rewrap-keys command does
+			count, err := newServer(newMasterKey, oldMasterKey).RewrapPrivateKeys(context.Background())
+			Expect(err).To(BeNil(), "Failed to rewrap the keys")
+			Expect(count).To(Equal(1), "Expected the key of the device to be rewrapped")
+
+			// Sign without the old master key
+			signed := serve(newServer(newMasterKey), "POST", "/api/v1/devices/"+device.Data.ID.String()+"/signatures", `{"data":"after rewrap"}`)
+			Expect(signed.Code).To(Equal(http.StatusCreated), "Expected the rewrapped key to work without the old master key: %s", signed.Body.String())
+		})
+	})
+
+	Describe("RotateDeviceKey", func() {
+		It("should continue the chain with the new key and keep the old one verifiable", func() {
+			// Create a device and sign with it
+			r := httptest.NewRequest("POST", "/new-device?algorithm=ECC&label=rotating&curve=P-256", nil)
+			deviceApi.CreateSignatureDevice(w, r)
+			Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the device")
+			var created struct {
+				Data api.CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+
+			sign := func(data string) api.SignaturedDataResponse {
+				body, _ := json.Marshal(map[string]string{"data": data})
+				req := httptest.NewRequest("POST", fmt.Sprintf("/sign?deviceId=%s", created.Data.ID), bytes.NewReader(body))
+				deviceApi.SignTransaction(w, req)
+				Expect(w.Code).To(Equal(http.StatusOK), "Failed signing with the device")
+				var signed struct {
+					Data api.SignaturedDataResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&signed)).To(Succeed(), "Expected to decode response body without error")
+				w = httptest.NewRecorder()
+				return signed.Data
+			}
+			verify := func(publicKeyPEM string, signed api.SignaturedDataResponse) bool {
+				block, _ := pem.Decode([]byte(publicKeyPEM))
+				Expect(block).ToNot(BeNil(), "Expected a PEM encoded public key")
+				publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+				Expect(err).To(BeNil(), "Expected a PKIX public key")
+				hashed := sha256.Sum256([]byte(signed.SignedData))
+				return ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), hashed[:], signed.Signature)
+			}
+			before := sign("before rotation")
+
+			// Rotate the key
+			r = httptest.NewRequest("POST", fmt.Sprintf("/rotate-key?deviceId=%s", created.Data.ID), nil)
+			deviceApi.RotateDeviceKey(w, r)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed rotating the key")
+			var rotated struct {
+				Data api.GetDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&rotated)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+			Expect(rotated.Data.KeyID).ToNot(Equal(created.Data.KeyID), "Expected a new key")
+			Expect(rotated.Data.PublicKey).ToNot(Equal(created.Data.PublicKey), "Expected a new public key")
+			Expect(rotated.Data.SignatureCounter).To(Equal(2), "Expected the rotation to be recorded in the chain")
+			Expect(rotated.Data.PreviousKeys).To(HaveLen(1), "Expected the old key to be kept")
+
+			// The next signature continues the chain from the rotation event with the new key
+			after := sign("after rotation")
+			Expect(after.SignedData).To(Equal("2_after rotation_"+rotated.Data.LastSignature), "Expected the chain to continue from the rotation event")
+			Expect(verify(rotated.Data.PublicKey, after)).To(BeTrue(), "Expected the new key to sign")
+
+			// The old key stays retrievable and verifies the signatures made before the rotation
+			r = httptest.NewRequest("GET", fmt.Sprintf("/key?deviceId=%s&keyId=%s", created.Data.ID, created.Data.KeyID), nil)
+			deviceApi.GetDeviceKey(w, r)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed retrieving the old key")
+			var oldKey struct {
+				Data api.DeviceKeyResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&oldKey)).To(Succeed(), "Expected to decode response body without error")
+			Expect(oldKey.Data.PublicKey).To(Equal(created.Data.PublicKey), "Expected the old public key")
+			Expect(oldKey.Data.Active).To(BeFalse(), "Expected the old key to be retired")
+			Expect(oldKey.Data.LastCounter).To(Equal(1), "Expected the old key to have signed the rotation event")
+			Expect(verify(oldKey.Data.PublicKey, before)).To(BeTrue(), "Expected the old key to verify signatures made before the rotation")
+		})
+	})
+
+	Describe("VerifySignature", func() {
+		// Verify a signature through the API, returning the verification
+		verify := func(id uuid.UUID, signedData string, signature []byte) api.VerifySignatureResponse {
+			body, _ := json.Marshal(map[string]string{"signed_data": signedData, "signature": base64.StdEncoding.EncodeToString(signature)})
+			r := httptest.NewRequest("POST", fmt.Sprintf("/verify?deviceId=%s", id), bytes.NewReader(body))
+			deviceApi.VerifySignature(w, r)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed verifying the signature")
+			var verified struct {
+				Data api.VerifySignatureResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&verified)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+			return verified.Data
+		}
+
+		It("should accept the signatures of the devices and reject tampered ones", func() {
+			for _, params := range []string{"algorithm=ECC", "algorithm=ECC&encoding=P1363", "algorithm=RSA&padding=PSS", "algorithm=ED25519"} {
+				r := httptest.NewRequest("POST", "/new-device?label=verify&"+params, nil)
+				deviceApi.CreateSignatureDevice(w, r)
+				Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the device with %s", params)
+				var created struct {
+					Data api.CreateDeviceResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+				w = httptest.NewRecorder()
+
+				for i := 0; i < 2; i++ {
+					signed, err := deviceService.SignTransaction(context.Background(), created.Data.ID, "data_with_underscores")
+					Expect(err).To(BeNil(), "Failed signing with %s", params)
+
+					verification := verify(created.Data.ID, signed.SignedData, signed.Signature)
+					Expect(verification.Valid).To(BeTrue(), "Expected the signature of %s to be valid: %s", params, verification.Reason)
+					Expect(verification.Counter).To(Equal(i), "Expected the counter of the signed data")
+					Expect(verification.Data).To(Equal("data_with_underscores"), "Expected the data of the signed data")
+
+					tampered := verify(created.Data.ID, strings.Replace(signed.SignedData, "data", "date", 1), signed.Signature)
+					Expect(tampered.Valid).To(BeFalse(), "Expected tampered data to be rejected with %s", params)
+				}
+			}
+		})
+
+		It("should verify signatures made before a key rotation with the old key", func() {
+			device, err := deviceService.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ECC", Label: "rotating"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+			before, err := deviceService.SignTransaction(context.Background(), device.ID, "before rotation")
+			Expect(err).To(BeNil(), "Failed signing")
+			rotated, err := deviceService.RotateDeviceKey(context.Background(), device.ID)
+			Expect(err).To(BeNil(), "Failed rotating the key")
+			after, err := deviceService.SignTransaction(context.Background(), device.ID, "after rotation")
+			Expect(err).To(BeNil(), "Failed signing")
+
+			verification := verify(device.ID, before.SignedData, before.Signature)
+			Expect(verification.Valid).To(BeTrue(), "Expected the old signature to be valid: %s", verification.Reason)
+			Expect(verification.KeyID).To(Equal(device.KeyID), "Expected the old signature to be checked with the old key")
+
+			verification = verify(device.ID, after.SignedData, after.Signature)
+			Expect(verification.Valid).To(BeTrue(), "Expected the new signature to be valid: %s", verification.Reason)
+			Expect(verification.KeyID).To(Equal(rotated.KeyID), "Expected the new signature to be checked with the new key")
+
+			// A signature of the new key does not verify where the old key was active
+			forged := strings.Replace(after.SignedData, "2_", "0_", 1)
+			verification = verify(device.ID, forged, after.Signature)
+			Expect(verification.Valid).To(BeFalse(), "Expected the signature to be rejected for another position in the chain")
+		})
+	})
+
+	Describe("Secured data formats", func() {
+		It("should sign, verify and audit data containing underscores with the v2 format", func() {
+			body := strings.NewReader(`{"algorithm":"ECC","label":"v2","securedDataFormat":"v2"}`)
+			r := httptest.NewRequest("POST", "/api/v1/devices", body)
+			deviceApi.CreateDevice(w, r)
+			Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the device")
+			var created struct {
+				Data api.CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+			Expect(created.Data.SecuredDataFormat).To(Equal(domain.SecuredDataFormatV2), "Expected the device to sign with the v2 format")
+
+			var signed model.SignaturedData
+			for _, data := range []string{"amount_10", "x_" + base64.StdEncoding.EncodeToString([]byte("forged"))} {
+				var err error
+				signed, err = deviceService.SignTransaction(context.Background(), created.Data.ID, data)
+				Expect(err).To(BeNil(), "Failed signing")
+				Expect(signed.SignedData).To(HavePrefix("v2_"), "Expected the signed data to have the v2 format")
+			}
+
+			r = httptest.NewRequest("POST", fmt.Sprintf("/verify?deviceId=%s", created.Data.ID), strings.NewReader(fmt.Sprintf(`{"signed_data":%q,"signature":%q}`,
+				signed.SignedData, base64.StdEncoding.EncodeToString(signed.Signature))))
+			deviceApi.VerifySignature(w, r)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed verifying the signature")
+			var verified struct {
+				Data api.VerifySignatureResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&verified)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+			Expect(verified.Data.Valid).To(BeTrue(), "Expected the signature to be valid: %s", verified.Data.Reason)
+			Expect(verified.Data.Format).To(Equal(domain.SecuredDataFormatV2), "Expected the format of the signed data")
+			Expect(verified.Data.Data).To(Equal("x_"+base64.StdEncoding.EncodeToString([]byte("forged"))), "Expected the data to be read by its length")
+			Expect(verified.Data.Algorithm).To(Equal("ECC"), "Expected the algorithm of the signed data")
+			Expect(verified.Data.Time).ToNot(BeZero(), "Expected the time of the signed data")
+
+			audit, err := deviceService.AuditSignatureChain(context.Background(), created.Data.ID)
+			Expect(err).To(BeNil(), "Failed auditing the chain")
+			Expect(audit.Intact).To(BeTrue(), "Expected the chain to be intact: %v", audit.Issues)
+		})
+	})
+
+	Describe("Signature journal", func() {
+		It("should keep every signature of a device", func() {
+			device, err := deviceService.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ECC", Label: "journaled"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+			var issued []api.SignaturedDataResponse
+			for i := 0; i < 3; i++ {
+				body, _ := json.Marshal(map[string]string{"data": fmt.Sprintf("transaction %d", i)})
+				r := httptest.NewRequest("POST", fmt.Sprintf("/sign?deviceId=%s", device.ID), bytes.NewReader(body))
+				deviceApi.SignTransaction(w, r)
+				Expect(w.Code).To(Equal(http.StatusOK), "Failed signing")
+				var signed struct {
+					Data api.SignaturedDataResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&signed)).To(Succeed(), "Expected to decode response body without error")
+				issued = append(issued, signed.Data)
+				w = httptest.NewRecorder()
+			}
+
+			// Listing the second page of the journal
+			r := httptest.NewRequest("GET", fmt.Sprintf("/signatures?deviceId=%s&offset=2&limit=2", device.ID), nil)
+			deviceApi.ListSignatures(w, r)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed listing the signatures")
+			var page struct {
+				Data api.ListSignaturesResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&page)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+			Expect(page.Data.Total).To(Equal(3), "Expected every signature to be journaled")
+			Expect(page.Data.Signatures).To(HaveLen(1), "Expected the last signature on the second page")
+			Expect(page.Data.Signatures[0].Signature).To(Equal(issued[2].Signature), "Expected the journaled signature to be the issued one")
+
+			// Retrieving a signature by its counter
+			r = httptest.NewRequest("GET", fmt.Sprintf("/signature?deviceId=%s&counter=1", device.ID), nil)
+			deviceApi.GetSignature(w, r)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed retrieving the signature")
+			var signature struct {
+				Data api.SignatureResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&signature)).To(Succeed(), "Expected to decode response body without error")
+			Expect(signature.Data.Data).To(Equal("transaction 1"), "Expected the raw data of the signature")
+			Expect(signature.Data.SignedData).To(Equal(issued[1].SignedData), "Expected the secured data of the signature")
+			Expect(signature.Data.Signature).To(Equal(issued[1].Signature), "Expected the issued signature")
+			Expect(signature.Data.Algorithm).To(Equal("ECC"), "Expected the algorithm of the device")
+		})
+	})
+
+	Describe("AuditSignatureChain", func() {
+		// Audit the chain of a device through the API, returning the report
+		audit := func(id uuid.UUID) api.ChainAuditResponse {
+			r := httptest.NewRequest("GET", fmt.Sprintf("/audit?deviceId=%s", id), nil)
+			deviceApi.AuditSignatureChain(w, r)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed auditing the chain")
+			var report struct {
+				Data api.ChainAuditResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&report)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+			return report.Data
+		}
+
+		It("should prove an unbroken chain across key rotations", func() {
+			device, err := deviceService.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "RSA", Label: "audited"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+			for i := 0; i < 3; i++ {
+				_, err = deviceService.SignTransaction(context.Background(), device.ID, fmt.Sprintf("transaction %d", i))
+				Expect(err).To(BeNil(), "Failed signing")
+			}
+			_, err = deviceService.RotateDeviceKey(context.Background(), device.ID)
+			Expect(err).To(BeNil(), "Failed rotating the key")
+			_, err = deviceService.SignTransaction(context.Background(), device.ID, "after rotation")
+			Expect(err).To(BeNil(), "Failed signing")
+
+			report := audit(device.ID)
+			Expect(report.Intact).To(BeTrue(), "Expected the chain to be intact: %v", report.Issues)
+			Expect(report.Records).To(Equal(5), "Expected the signatures and the rotation event to be audited")
+			Expect(report.SignatureCounter).To(Equal(5), "Expected the signature counter of the device")
+		})
+
+		It("should report signatures missing from the journal", func() {
+			deviceService = domain.NewDeviceService(&lossyJournalRepo{DeviceRepository: persistence.NewDeviceRepository(), lost: 1}, realUtils, nil, domain.WithKeyStore(keyStore))
+			deviceApi = api.NewDeviceApi(deviceService, realUtils)
+
+			device, err := deviceService.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ED25519", Label: "lossy"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+			for i := 0; i < 3; i++ {
+				_, err = deviceService.SignTransaction(context.Background(), device.ID, fmt.Sprintf("transaction %d", i))
+				Expect(err).To(BeNil(), "Failed signing")
+			}
+
+			report := audit(device.ID)
+			Expect(report.Intact).To(BeFalse(), "Expected the chain not to be intact")
+			Expect(report.Issues).To(Equal([]api.ChainIssueResponse{
+				{Kind: domain.ChainIssueGap, Counter: 1, Detail: "counters 1 to 1 are missing"},
+			}), "Expected the missing signature to be reported")
+		})
+	})
+
+	Describe("Durable repositories", func() {
+		// Sign, rotate and restart the service on the repository, expecting the chains to continue
+		keepsChainsAcrossRestarts := func(openRepo func() persistence.DeviceRepoInterface) {
+			// Start the service on the repository, as the server does on every start
+			start := func() {
+				deviceRepo = openRepo()
+				deviceService = domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore))
+				deviceApi = api.NewDeviceApi(deviceService, realUtils)
+			}
+
+			start()
+			var ids []uuid.UUID
+			for _, algorithm := range []string{"ECC", "RSA", "ED25519"} {
+				device, err := deviceService.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: algorithm, Label: "stored"})
+				Expect(err).To(BeNil(), "Failed creating the %s device", algorithm)
+				_, err = deviceService.SignTransaction(context.Background(), device.ID, "before rotation")
+				Expect(err).To(BeNil(), "Failed signing")
+				_, err = deviceService.RotateDeviceKey(context.Background(), device.ID)
+				Expect(err).To(BeNil(), "Failed rotating the key")
+				ids = append(ids, device.ID)
+			}
+
+			start()
+			for _, id := range ids {
+				signed, err := deviceService.SignTransaction(context.Background(), id, "after restart")
+				Expect(err).To(BeNil(), "Failed signing after the restart")
+				Expect(signed.SignedData).To(HavePrefix("2_after restart_"), "Expected the chain to continue after the restart")
+
+				r := httptest.NewRequest("GET", fmt.Sprintf("/audit?deviceId=%s", id), nil)
+				deviceApi.AuditSignatureChain(w, r)
+				Expect(w.Code).To(Equal(http.StatusOK), "Failed auditing the chain")
+				var report struct {
+					Data api.ChainAuditResponse `json:"data"`
+				}
+				Expect(json.NewDecoder(w.Body).Decode(&report)).To(Succeed(), "Expected to decode response body without error")
+				w = httptest.NewRecorder()
+				Expect(report.Data.Intact).To(BeTrue(), "Expected the stored chain to be intact: %v", report.Data.Issues)
+				Expect(report.Data.Records).To(Equal(3), "Expected the stored signatures to be audited")
+			}
+		}
+
+		// Export a key and try to export the key of an unknown device, then restart the service on the repository,
+		// expecting both attempts to be in the audit log
+		keepsExportAuditAcrossRestarts := func(openRepo func() (persistence.DeviceRepoInterface, persistence.AuditRepoInterface)) {
+			var auditRepo persistence.AuditRepoInterface
+			// Start the service on the repository, as the server does on every start
+			start := func() {
+				deviceRepo, auditRepo = openRepo()
+				deviceService = domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore), domain.WithKeyExport(true), domain.WithAuditLog(auditRepo))
+			}
+
+			start()
+			device, err := deviceService.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ED25519", Label: "exported"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+			_, err = deviceService.ExportPrivateKey(context.Background(), device.ID, "correct horse battery staple")
+			Expect(err).To(BeNil(), "Failed exporting the key")
+			unknown := uuid.New()
+			_, err = deviceService.ExportPrivateKey(context.Background(), unknown, "correct horse battery staple")
+			Expect(err).To(MatchError(persistence.ErrDeviceNotFound), "Expected the unknown device not to be exported")
+
+			start()
+			entries, err := auditRepo.GetAll()
+			Expect(err).To(BeNil(), "Failed reading the audit log")
+			Expect(entries).To(HaveLen(2), "Expected both export attempts to survive the restart")
+			Expect(entries[0].DeviceID).To(Equal(device.ID), "Expected the export of the device first")
+			Expect(entries[0].Outcome).To(Equal(domain.AuditOutcomeExported), "Expected the export to be audited as exported")
+			Expect(entries[1].DeviceID).To(Equal(unknown), "Expected the attempt on the unknown device second")
+			Expect(entries[1].Outcome).To(Equal(domain.AuditOutcomeDenied), "Expected the attempt to be audited as denied")
+		}
+
+		It("should keep the key export audit log across restarts of a SQL database", func() {
+			dsn := "file:" + filepath.Join(GinkgoT().TempDir(), "devices.db")
+			keepsExportAuditAcrossRestarts(func() (persistence.DeviceRepoInterface, persistence.AuditRepoInterface) {
+				db, dialect, err := persistence.OpenDatabase("sqlite", dsn)
+				Expect(err).To(BeNil(), "Failed opening the database")
+				DeferCleanup(db.Close)
+				repo, err := persistence.NewSQLDeviceRepository(db, dialect, servicecrypto.DefaultRegistry)
+				Expect(err).To(BeNil(), "Failed creating the repository")
+				return repo, persistence.NewSQLAuditRepository(repo)
+			})
+		})
+
+		It("should keep the key export audit log across restarts of a write-ahead log", func() {
+			dir := GinkgoT().TempDir()
+			var previous *persistence.FileDeviceRepository
+			keepsExportAuditAcrossRestarts(func() (persistence.DeviceRepoInterface, persistence.AuditRepoInterface) {
+				// The previous process is gone, with its open log
+				if previous != nil {
+					Expect(previous.Close()).To(Succeed(), "Failed closing the repository")
+				}
+				repo, err := persistence.NewFileDeviceRepository(dir, servicecrypto.DefaultRegistry, 0)
+				Expect(err).To(BeNil(), "Failed opening the repository")
+				DeferCleanup(repo.Close)
+				previous = repo
+				return repo, persistence.NewFileAuditRepository(repo)
+			})
+		})
+
+		It("should keep the devices and their chains across restarts of a SQL database", func() {
+			dsn := "file:" + filepath.Join(GinkgoT().TempDir(), "devices.db")
+			keepsChainsAcrossRestarts(func() persistence.DeviceRepoInterface {
+				db, dialect, err := persistence.OpenDatabase("sqlite", dsn)
+				Expect(err).To(BeNil(), "Failed opening the database")
+				DeferCleanup(db.Close)
+				repo, err := persistence.NewSQLDeviceRepository(db, dialect, servicecrypto.DefaultRegistry)
+				Expect(err).To(BeNil(), "Failed creating the repository")
+				return repo
+			})
+		})
+
+		It("should sign a retried request once across instances sharing a database", func() {
+			db, dialect, err := persistence.OpenDatabase("sqlite", "file:"+filepath.Join(GinkgoT().TempDir(), "devices.db"))
+			Expect(err).To(BeNil(), "Failed opening the database")
+			DeferCleanup(db.Close)
+			deviceRepo, err = persistence.NewSQLDeviceRepository(db, dialect, servicecrypto.DefaultRegistry)
+			Expect(err).To(BeNil(), "Failed creating the repository")
+
+			instances := []domain.DeviceServiceInterface{
+				domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore), domain.WithConflictRetries(100)),
+				domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore), domain.WithConflictRetries(100)),
+			}
+			device, err := instances[0].CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ED25519", Label: "replicated"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+
+			// The terminal retries the same request on both instances
+			signed := make([]string, 10)
+			var wg sync.WaitGroup
+			for i := range signed {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					signaturedData, err := instances[i%2].SignTransactionIdempotent(context.Background(), device.ID, "receipt", "terminal-1/receipt-1")
+					Expect(err).To(BeNil(), "Failed signing")
+					signed[i] = signaturedData.SignedData
+				}()
+			}
+			wg.Wait()
+
+			Expect(slices.Compact(signed)).To(HaveLen(1), "Expected every retry to return the same signature")
+			found, err := deviceRepo.FindByID(device.ID)
+			Expect(err).To(BeNil(), "Failed finding the device")
+			Expect(found.SignatureCounter).To(Equal(1), "Expected the request to consume a single counter value")
+		})
+
+		It("should reuse the counter reserved by an instance that crashed while signing", func() {
+			db, dialect, err := persistence.OpenDatabase("sqlite", "file:"+filepath.Join(GinkgoT().TempDir(), "devices.db"))
+			Expect(err).To(BeNil(), "Failed opening the database")
+			DeferCleanup(db.Close)
+			deviceRepo, err = persistence.NewSQLDeviceRepository(db, dialect, servicecrypto.DefaultRegistry)
+			Expect(err).To(BeNil(), "Failed creating the repository")
+			service := domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore))
+			device, err := service.CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ECC", Label: "crashed"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+
+			// The crashed instance reserved the first counter and never committed it
+			crashed := persistence.NewReservation(device.ID, model.ChainState{}, time.Millisecond)
+			Expect(deviceRepo.ReserveCounter(crashed)).To(Succeed(), "Failed reserving the counter")
+			time.Sleep(10 * time.Millisecond)
+
+			recovered, err := service.RecoverReservations(context.Background())
+			Expect(err).To(BeNil(), "Failed recovering the reservations")
+			Expect(recovered).To(HaveLen(1), "Expected the reservation of the crashed instance to be recovered")
+
+			signed, err := service.SignTransaction(context.Background(), device.ID, "after crash")
+			Expect(err).To(BeNil(), "Failed signing after the crash")
+			Expect(signed.SignedData).To(HavePrefix("0_after crash_"), "Expected the reserved counter to be signed")
+			audit, err := service.AuditSignatureChain(context.Background(), device.ID)
+			Expect(err).To(BeNil(), "Failed auditing the chain")
+			Expect(audit.Intact).To(BeTrue(), "Expected the chain to have no gap: %v", audit.Issues)
+		})
+
+		It("should keep the counters gapless across instances sharing a database", func() {
+			db, dialect, err := persistence.OpenDatabase("sqlite", "file:"+filepath.Join(GinkgoT().TempDir(), "devices.db"))
+			Expect(err).To(BeNil(), "Failed opening the database")
+			DeferCleanup(db.Close)
+			deviceRepo, err = persistence.NewSQLDeviceRepository(db, dialect, servicecrypto.DefaultRegistry)
+			Expect(err).To(BeNil(), "Failed creating the repository")
+
+			// Two instances of the service, which do not share their device mutexes
+			instances := []domain.DeviceServiceInterface{
+				domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore), domain.WithConflictRetries(100)),
+				domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore), domain.WithConflictRetries(100)),
+			}
+			device, err := instances[0].CreateSignatureDevice(context.Background(), domain.DeviceSpec{Algorithm: "ED25519", Label: "replicated"})
+			Expect(err).To(BeNil(), "Failed creating the device")
+
+			var wg sync.WaitGroup
+			for i := range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					_, err := instances[i%2].SignTransaction(context.Background(), device.ID, fmt.Sprintf("transaction %d", i))
+					Expect(err).To(BeNil(), "Failed signing")
+				}()
+			}
+			wg.Wait()
+
+			report, err := instances[1].AuditSignatureChain(context.Background(), device.ID)
+			Expect(err).To(BeNil(), "Failed auditing the chain")
+			Expect(report.Intact).To(BeTrue(), "Expected the chain to be intact: %v", report.Issues)
+			Expect(report.SignatureCounter).To(Equal(20), "Expected every signature to be counted once")
+		})
+
+		It("should keep the devices and their chains across restarts of a write-ahead log", func() {
+			dir := GinkgoT().TempDir()
+			var previous *persistence.FileDeviceRepository
+			keepsChainsAcrossRestarts(func() persistence.DeviceRepoInterface {
+				// The previous process is gone, with its open log
+				if previous != nil {
+					Expect(previous.Close()).To(Succeed(), "Failed closing the repository")
+				}
+				repo, err := persistence.NewFileDeviceRepository(dir, servicecrypto.DefaultRegistry, 2)
+				Expect(err).To(BeNil(), "Failed opening the repository")
+				DeferCleanup(repo.Close)
+				previous = repo
+				return repo
+			})
+		})
+	})
+
+	Describe("PKCS#11 key store", func() {
+		BeforeEach(func() {
+			keyStore = servicecrypto.NewPKCS11KeyStore(servicecrypto.NewSoftToken(), servicecrypto.DefaultRegistry)
+			deviceService = domain.NewDeviceService(deviceRepo, realUtils, nil, domain.WithKeyStore(keyStore), domain.WithKeyExport(true))
+			deviceApi = api.NewDeviceApi(deviceService, realUtils)
+		})
+
+		// Create a device with the query of the request and sign data with it on the token
+		createAndSign := func(query string) (api.CreateDeviceResponse, api.SignaturedDataResponse, any) {
+			r := httptest.NewRequest("POST", "/new-device?"+query, nil)
+			deviceApi.CreateSignatureDevice(w, r)
+			Expect(w.Code).To(Equal(http.StatusCreated), "Failed creating the device")
+
+			var created struct {
+				Data api.CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&created)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+
+			body, _ := json.Marshal(map[string]string{"data": "hello Fiskaly!"})
+			req := httptest.NewRequest("POST", fmt.Sprintf("/sign?deviceId=%s", created.Data.ID), bytes.NewReader(body))
+			deviceApi.SignTransaction(w, req)
+			Expect(w.Code).To(Equal(http.StatusOK), "Failed signing with the device")
+
+			var signed struct {
+				Data api.SignaturedDataResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(w.Body).Decode(&signed)).To(Succeed(), "Expected to decode response body without error")
+			w = httptest.NewRecorder()
+
+			block, _ := pem.Decode([]byte(created.Data.PublicKey))
+			Expect(block).ToNot(BeNil(), "Expected a PEM encoded public key")
+			publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+			Expect(err).To(BeNil(), "Expected a PKIX public key")
+
+			return created.Data, signed.Data, publicKey
+		}
+
+		It("should sign with ECC keys generated on the token", func() {
+			_, signed, publicKey := createAndSign("algorithm=ECC&label=token&curve=P-256")
+			hashed := sha256.Sum256([]byte(signed.SignedData))
+			Expect(ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), hashed[:], signed.Signature)).To(BeTrue(), "Expected the signature to be valid")
+		})
+
+		It("should sign with RSA keys generated on the token", func() {
+			_, signed, publicKey := createAndSign("algorithm=RSA&label=token")
+			hashed := sha256.Sum256([]byte(signed.SignedData))
+			err := rsa.VerifyPKCS1v15(publicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signed.Signature)
+			Expect(err).To(BeNil(), "Expected the PKCS#1 v1.5 signature to be valid")
+		})
+
+		It("should sign with RSA-PSS on the token", func() {
+			_, signed, publicKey := createAndSign("algorithm=RSA&label=token&padding=PSS&saltLength=20")
+			hashed := sha256.Sum256([]byte(signed.SignedData))
+			err := rsa.VerifyPSS(publicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signed.Signature, &rsa.PSSOptions{SaltLength: 20})
+			Expect(err).To(BeNil(), "Expected the PSS signature to be valid")
+		})
+
+		It("should sign with ED25519 keys generated on the token", func() {
+			_, signed, publicKey := createAndSign("algorithm=ED25519&label=token")
+			Expect(ed25519.Verify(publicKey.(ed25519.PublicKey), []byte(signed.SignedData), signed.Signature)).To(BeTrue(), "Expected the signature to be valid")
+		})
+
+		It("should reject deterministic ECC devices when they are created", func() {
+			r := httptest.NewRequest("POST", "/new-device?algorithm=ECC&label=token&deterministic=true", nil)
+			deviceApi.CreateSignatureDevice(w, r)
+			Expect(w.Code).To(Equal(http.StatusBadRequest), "Expected a device the token cannot sign with to be rejected")
+			Expect(w.Body.String()).To(ContainSubstring(api.ErrorCodeInvalidSignOptions), "Expected the invalid sign options error code")
+
+			devices, err := deviceRepo.GetAll()
+			Expect(err).To(BeNil(), "Failed to list the devices")
+			Expect(devices).To(BeEmpty(), "Expected no device to be created")
+		})
+
+		It("should keep the keys on the token", func() {
+			created, _, _ := createAndSign("algorithm=ECC&label=token")
+
+			stored, err := deviceRepo.FindByID(created.ID)
+			Expect(err).To(BeNil(), "Failed to find the device")
+			Expect(stored.KeyHandle).To(Equal([]byte(stored.KeyID)), "Expected the device to only reference its key on the token")
+
+			body, _ := json.Marshal(api.ExportKeyRequest{Password: "correct horse battery staple"})
+			r := httptest.NewRequest("POST", fmt.Sprintf("/export-key?deviceId=%s", created.ID), bytes.NewReader(body))
+			deviceApi.ExportPrivateKey(w, r)
+			Expect(w.Code).To(Equal(http.StatusForbidden), "Expected keys on the token not to be exportable")
+		})
+	})
+
 	Describe("GetAllDevices", func() {
 		BeforeEach(func() {
 			req1 := httptest.NewRequest("POST", "/new-device?algorithm=ECC&label=first", nil)
@@ -236,6 +1211,7 @@ var _ = Describe("Device API End-to-End", func() {
 
 			// Verify response code
 			Expect(w.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(w.Body.String()).ToNot(ContainSubstring("PRIVATE KEY"), "Expected no private key material in the response")
 
 			var wrapper struct {
 				Data api.GetAllDevicesResponse `json:"data"`
@@ -252,4 +1228,160 @@ var _ = Describe("Device API End-to-End", func() {
 			Expect(resp.Devices[1].Label).To(BeElementOf([]string{"first", "second"}), "Expected second device label to be either 'first' or 'second'")
 		})
 	})
+
+	Describe("Routes", func() {
+		var handler http.Handler
+
+		// Serve the request with the routes of the server
+		serve := func(method, target, body string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+			return recorder
+		}
+
+		BeforeEach(func() {
+			server, err := api.NewServer(":0", api.Config{})
+			Expect(err).To(BeNil(), "Failed to create the server")
+			handler = server.Handler()
+		})
+
+		It("should create, sign with and read a device through the v1 routes", func() {
+			created := serve("POST", "/api/v1/devices", `{"algorithm":"ECC","label":"v1 device","curve":"P-384"}`)
+			Expect(created.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			Expect(created.Header().Get("Deprecation")).To(BeEmpty(), "The v1 routes should not be deprecated")
+			var device struct {
+				Data api.CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(created.Body).Decode(&device)).To(Succeed(), "Expected to decode the created device")
+			Expect(device.Data.Curve).To(Equal("P-384"), "Expected the curve of the request body")
+
+			signed := serve("POST", "/api/v1/devices/"+device.Data.ID.String()+"/signatures", `{"data":"v1 data"}`)
+			Expect(signed.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			var signature struct {
+				Data api.SignaturedDataResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(signed.Body).Decode(&signature)).To(Succeed(), "Expected to decode the signature")
+			Expect(signature.Data.SignedData).To(HavePrefix("0_v1 data_"), "Expected the first signature of the chain")
+
+			found := serve("GET", "/api/v1/devices/"+device.Data.ID.String(), "")
+			Expect(found.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			var details struct {
+				Data api.GetDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(found.Body).Decode(&details)).To(Succeed(), "Expected to decode the device")
+			Expect(details.Data.SignatureCounter).To(Equal(1), "Expected the signature to be counted")
+
+			listed := serve("GET", "/api/v1/devices", "")
+			Expect(listed.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			var devices struct {
+				Data api.GetAllDevicesResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(listed.Body).Decode(&devices)).To(Succeed(), "Expected to decode the devices")
+			Expect(devices.Data.Total).To(Equal(1), "Expected the created device to be listed")
+		})
+
+		It("should not overwrite a device created with a taken client chosen ID", func() {
+			id := uuid.New()
+			created := serve("POST", "/api/v1/devices", fmt.Sprintf(`{"id":"%s","algorithm":"ECC","label":"first"}`, id))
+			Expect(created.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+
+			duplicate := serve("POST", "/api/v1/devices", fmt.Sprintf(`{"id":"%s","algorithm":"RSA","label":"second"}`, id))
+			Expect(duplicate.Code).To(Equal(http.StatusConflict), "Expected status code 409 Conflict")
+			var errorResponse api.ErrorResponse
+			Expect(json.NewDecoder(duplicate.Body).Decode(&errorResponse)).To(Succeed(), "Expected to decode the error response")
+			Expect(errorResponse.Code).To(Equal(api.ErrorCodeDeviceExists), "Expected the device exists error code")
+
+			found := serve("GET", "/api/v1/devices/"+id.String(), "")
+			var details struct {
+				Data api.GetDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(found.Body).Decode(&details)).To(Succeed(), "Expected to decode the device")
+			Expect(details.Data.Label).To(Equal("first"), "Expected the first device to be kept")
+			Expect(details.Data.Algorithm).To(Equal("ECC"), "Expected the first device to be kept")
+		})
+
+		It("should replay a signing request repeating its idempotency key", func() {
+			created := serve("POST", "/api/v1/devices", `{"algorithm":"ED25519"}`)
+			Expect(created.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			var device struct {
+				Data api.CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(created.Body).Decode(&device)).To(Succeed(), "Expected to decode the created device")
+
+			// Sign the data with the idempotency key
+			sign := func(data string) *httptest.ResponseRecorder {
+				recorder := httptest.NewRecorder()
+				r := httptest.NewRequest("POST", "/api/v1/devices/"+device.Data.ID.String()+"/signatures", strings.NewReader(fmt.Sprintf(`{"data":"%s"}`, data)))
+				r.Header.Set(api.IdempotencyKeyHeader, "receipt-1")
+				handler.ServeHTTP(recorder, r)
+				return recorder
+			}
+
+			first := sign("receipt")
+			Expect(first.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			retried := sign("receipt")
+			Expect(retried.Code).To(Equal(http.StatusCreated), "Expected the retry to succeed")
+			Expect(retried.Body.String()).To(Equal(first.Body.String()), "Expected the retry to return the first signature")
+
+			reused := sign("other receipt")
+			Expect(reused.Code).To(Equal(http.StatusUnprocessableEntity), "Expected status code 422 Unprocessable Entity")
+		})
+
+		It("should reject a device ID that is not a UUID", func() {
+			recorder := serve("GET", "/api/v1/devices/not-a-uuid", "")
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest), "Expected status code 400 Bad Request")
+		})
+
+		It("should keep serving the v0 routes as deprecated aliases", func() {
+			created := serve("POST", "/api/v0/device/new-device?algorithm=ED25519&label=v0%20device", "")
+			Expect(created.Code).To(Equal(http.StatusCreated), "Expected status code 201 Created")
+			Expect(created.Header().Get("Deprecation")).To(Equal("true"), "Expected the v0 route to be deprecated")
+			Expect(created.Header().Get("Link")).To(Equal(`</api/v1/devices>; rel="successor-version"`), "Expected a link to the v1 route")
+			var device struct {
+				Data api.CreateDeviceResponse `json:"data"`
+			}
+			Expect(json.NewDecoder(created.Body).Decode(&device)).To(Succeed(), "Expected to decode the created device")
+
+			signed := serve("GET", "/api/v0/device/sign?deviceId="+device.Data.ID.String(), `{"data":"v0 data"}`)
+			Expect(signed.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(signed.Header().Get("Deprecation")).To(Equal("true"), "Expected the v0 route to be deprecated")
+
+			audited := serve("GET", "/api/v0/device/audit?deviceId="+device.Data.ID.String(), "")
+			Expect(audited.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(audited.Header().Get("Deprecation")).To(Equal("true"), "Expected the v0 route to be deprecated")
+			Expect(audited.Header().Get("Link")).To(Equal(`</api/v1/devices/`+device.Data.ID.String()+`/audit>; rel="successor-version"`), "Expected a link to the v1 audit of the device")
+
+			signatures := serve("GET", "/api/v0/device/signatures?deviceId="+device.Data.ID.String(), "")
+			Expect(signatures.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(signatures.Header().Get("Link")).To(Equal(`</api/v1/devices/`+device.Data.ID.String()+`/signatures>; rel="successor-version"`), "Expected a link to the v1 signatures of the device")
+
+			signature := serve("GET", "/api/v0/device/signature?deviceId="+device.Data.ID.String()+"&counter=0", "")
+			Expect(signature.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(signature.Header().Get("Link")).To(Equal(`</api/v1/devices/`+device.Data.ID.String()+`/signatures/0>; rel="successor-version"`), "Expected a link to the v1 signature")
+
+			successor := serve("GET", "/api/v1/devices/"+device.Data.ID.String()+"/signatures/0", "")
+			Expect(successor.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(successor.Body.String()).To(Equal(signature.Body.String()), "Expected the v1 route to return the same signature")
+			listed := serve("GET", "/api/v1/devices/"+device.Data.ID.String()+"/signatures", "")
+			Expect(listed.Code).To(Equal(http.StatusOK), "Expected status code 200 OK")
+			Expect(listed.Body.String()).To(Equal(signatures.Body.String()), "Expected the v1 route to return the same signatures")
+		})
+	})
 })
+
+// lossyJournalRepo is a device repository whose journal has lost the signature with the given counter
+type lossyJournalRepo struct {
+	*persistence.DeviceRepository
+	lost int
+}
+
+func (r *lossyJournalRepo) GetSignatures(id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error) {
+	records, _, err := r.DeviceRepository.GetSignatures(id, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	records = slices.DeleteFunc(records, func(record model.SignatureRecord) bool {
+		return record.Counter == r.lost
+	})
+	return records, len(records), nil
+}
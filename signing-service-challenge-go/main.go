@@ -1,13 +1,34 @@
+// Command signing-service serves the signing service API on ListenAddress.
+//
+// Running it with the rewrap-keys command instead wraps the private keys of all the stored devices with the
+// active master key and exits. To rotate the master key, an operator:
+//
+//  1. prepends the new master key to SIGNING_SERVICE_MASTER_KEYS, keeping the previous ones after it,
+//     and restarts the service, which wraps new keys with it while still unwrapping the old ones;
+//  2. runs "signing-service rewrap-keys" with the same configuration;
+//  3. removes the previous master keys from SIGNING_SERVICE_MASTER_KEYS and restarts the service.
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/api"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 )
 
 const (
-	ListenAddress = ":8080"
+	ListenAddress        = ":8080"
+	MinRSAKeySize        = 2048                          // minimum RSA modulus size in bits
+	MinECCKeySize        = 256                           // minimum ECC curve size in bits
+	KeyExportEnabled     = false                         // allow exporting encrypted private keys, every export is audited
+	MasterKeysEnv        = "SIGNING_SERVICE_MASTER_KEYS" // comma separated id:base64key master keys, the first one is active, required with a database
+	DatabaseEnv          = "SIGNING_SERVICE_DATABASE"    // driver:dsn of the device database, e.g. sqlite:file:devices.db or file:/var/lib/signing, in memory when empty
+	IdempotencyRetention = 24 * time.Hour                // how long the Idempotency-Key of a signing request is remembered per device
+	RewrapKeysCommand    = "rewrap-keys"                 // command rewrapping the stored private keys with the active master key
 	// TODO: add further configuration parameters here ...
 )
 
@@ -15,10 +36,44 @@ const (
 // @version 1.0
 // @description API for managing signature devices and signing transactions.
 // @host localhost:8080
-// @BasePath /api/v0
+// @BasePath /api
 
 func main() {
-	server := api.NewServer(ListenAddress)
+	masterKeys, err := crypto.ParseMasterKeys(os.Getenv(MasterKeysEnv))
+	if err != nil {
+		log.Fatal("Invalid ", MasterKeysEnv, ": ", err)
+	}
+
+	databaseDriver, databaseDSN, _ := strings.Cut(os.Getenv(DatabaseEnv), ":")
+
+	server, err := api.NewServer(ListenAddress, api.Config{
+		KeyPolicy: crypto.KeyPolicy{
+			MinKeySizes: map[string]int{
+				crypto.AlgorithmRSA: MinRSAKeySize,
+				crypto.AlgorithmECC: MinECCKeySize,
+			},
+		},
+		KeyExportEnabled:     KeyExportEnabled,
+		MasterKeys:           masterKeys,
+		DatabaseDriver:       databaseDriver,
+		DatabaseDSN:          databaseDSN,
+		IdempotencyRetention: IdempotencyRetention,
+	})
+	if err != nil {
+		log.Fatal("Could not configure server: ", err)
+	}
+
+	if len(os.Args) > 1 {
+		if os.Args[1] != RewrapKeysCommand {
+			log.Fatalf("Unknown command %q, the only command is %q", os.Args[1], RewrapKeysCommand)
+		}
+		count, err := server.RewrapPrivateKeys(context.Background())
+		if err != nil {
+			log.Fatalf("Could not rewrap the private keys, %d were rewrapped: %v", count, err)
+		}
+		log.Printf("Rewrapped the private keys of %d devices", count)
+		return
+	}
 
 	if err := server.Run(); err != nil {
 		log.Fatal("Could not start server on ", ListenAddress)
@@ -1,18 +1,128 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
 
+	"github.com/google/uuid"
+)
+
+// Device is a signature device. SecuredDataFormat is the version of the format of the data it signs,
+// v1 for the devices created before the format was versioned.
 type Device struct {
-	ID               uuid.UUID `json:"id"`
-	Algorithm        string    `json:"algorithm"`
-	Label            string    `json:"label"`
-	PublicKey        any       `json:"publicKey"`
-	PrivateKey       any       `json:"privateKey"`
-	SignatureCounter int       `json:"signatureCounter"`
-	LastSignature    string    `json:"lastSignature,omitempty"`
+	ID                uuid.UUID   `json:"id"`
+	Algorithm         string      `json:"algorithm"`
+	Label             string      `json:"label"`
+	KeySize           int         `json:"keySize"`
+	Curve             string      `json:"curve,omitempty"`
+	Digest            string      `json:"digest"`
+	Padding           string      `json:"padding,omitempty"`
+	SaltLength        int         `json:"saltLength,omitempty"`
+	Encoding          string      `json:"encoding,omitempty"`
+	Deterministic     bool        `json:"deterministic,omitempty"`
+	KeyID             string      `json:"keyId"`
+	PublicKey         any         `json:"publicKey"`
+	KeyHandle         []byte      `json:"keyHandle"`
+	PreviousKeys      []DeviceKey `json:"previousKeys,omitempty"`
+	SignatureCounter  int         `json:"signatureCounter"`
+	LastSignature     string      `json:"lastSignature,omitempty"`
+	ImportedChain     *ChainState `json:"importedChain,omitempty"`
+	SecuredDataFormat string      `json:"securedDataFormat,omitempty"`
+}
+
+// ChainState is the position of a signature chain: the counter of its next signature and the signature it will be chained to.
+// Devices imported with an existing chain keep the state they were imported with, as the signatures before it were made elsewhere.
+type ChainState struct {
+	SignatureCounter int    `json:"signatureCounter"`
+	LastSignature    string `json:"lastSignature"`
+}
+
+// DeviceKey is a public key a device signs or has signed with, and the range of signature counters it covers.
+// The keys replaced by a rotation stay on the device so the signatures they produced can still be verified.
+type DeviceKey struct {
+	ID           string `json:"id"`
+	PublicKey    any    `json:"publicKey"`
+	FirstCounter int    `json:"firstCounter"`
+	LastCounter  int    `json:"lastCounter"`
+	Active       bool   `json:"active"`
 }
 
 type SignaturedData struct {
 	Signature  []byte `json:"signature"`
 	SignedData string `json:"signed_data"`
+	Digest     string `json:"digest"`
+	Encoding   string `json:"encoding,omitempty"`
+}
+
+// Verification is the outcome of checking a signature of a device. Counter, Data and LastSignature are the parts
+// of the signed data, parsed with its secured data Format, and KeyID the key whose signatures cover the counter.
+// Formats after v1 also carry the Time of the signature and the Algorithm of the device.
+// Reason explains why an invalid signature was rejected.
+type Verification struct {
+	Valid         bool      `json:"valid"`
+	Reason        string    `json:"reason,omitempty"`
+	KeyID         string    `json:"keyId,omitempty"`
+	Format        string    `json:"format,omitempty"`
+	Counter       int       `json:"counter"`
+	Data          string    `json:"data"`
+	LastSignature string    `json:"lastSignature"`
+	Time          time.Time `json:"time,omitzero"`
+	Algorithm     string    `json:"algorithm,omitempty"`
+}
+
+// SignatureRecord is a signature issued by a device, journaled to prove the continuity of its signature chain.
+// Data is the raw data as requested, SignedData the secured data that was signed, in the secured data format of the
+// device when it signed (see domain.SecuredDataFormats), and KeyID names the device key that produced the signature.
+// The format version of a record is carried by its SignedData: formats after v1 start with their version, e.g. "v2_",
+// while v1 secured data "<counter>_<data>_<last signature>" starts with the counter, so records journaled before the
+// format was versioned keep reading as v1. IdempotencyKey is the key the client sent to make retries of the signing
+// request return this signature instead of signing again, if any.
+type SignatureRecord struct {
+	DeviceID       uuid.UUID `json:"deviceId"`
+	Counter        int       `json:"counter"`
+	Data           string    `json:"data"`
+	SignedData     string    `json:"signedData"`
+	Signature      []byte    `json:"signature"`
+	Algorithm      string    `json:"algorithm"`
+	KeyID          string    `json:"keyId"`
+	Time           time.Time `json:"time"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty"`
+}
+
+// Reservation is the exclusive right to sign the next counter of a device from the Expected chain state, taken
+// before signing so that a counter is only consumed by a signature that is persisted. A reservation that was
+// neither committed nor released, e.g. because its signer crashed, expires and can then be taken over or recovered.
+type Reservation struct {
+	ID       uuid.UUID  `json:"id"`
+	DeviceID uuid.UUID  `json:"deviceId"`
+	Expected ChainState `json:"expected"`
+	Expires  time.Time  `json:"expires"`
+}
+
+// ChainAudit reports the result of walking the stored signatures of a device. The chain is intact when
+// the records cover every counter from the start of the chain up to the signature counter of the device
+// and each of them verifies and references its predecessor.
+type ChainAudit struct {
+	DeviceID         uuid.UUID    `json:"deviceId"`
+	Intact           bool         `json:"intact"`
+	FirstCounter     int          `json:"firstCounter"`
+	SignatureCounter int          `json:"signatureCounter"`
+	Records          int          `json:"records"`
+	Issues           []ChainIssue `json:"issues,omitempty"`
+}
+
+// ChainIssue is a gap or break found in the signature chain of a device, at the counter of the record
+// where it was detected, or of the first missing record for gaps.
+type ChainIssue struct {
+	Kind    string `json:"kind"`
+	Counter int    `json:"counter"`
+	Detail  string `json:"detail"`
+}
+
+// AuditEntry records a security relevant operation performed on a device
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	DeviceID uuid.UUID `json:"deviceId"`
+	Outcome  string    `json:"outcome"`
+	Details  string    `json:"details,omitempty"`
 }
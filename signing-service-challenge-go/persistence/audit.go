@@ -0,0 +1,43 @@
+package persistence
+
+import (
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+)
+
+type AuditRepoInterface interface {
+	Append(entry model.AuditEntry) error
+	GetAll() ([]model.AuditEntry, error)
+}
+
+// AuditRepository keeps an append-only log of audit entries
+type AuditRepository struct {
+	entries []model.AuditEntry
+	mu      sync.RWMutex
+}
+
+// Initialize
+func NewAuditRepository() *AuditRepository {
+	return &AuditRepository{}
+}
+
+// Append adds an entry at the end of the audit log
+func (r *AuditRepository) Append(entry model.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+// GetAll retrieves all the audit entries in the order they were appended
+func (r *AuditRepository) GetAll() ([]model.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]model.AuditEntry, len(r.entries))
+	copy(entries, r.entries)
+
+	return entries, nil
+}
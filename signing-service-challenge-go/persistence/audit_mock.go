@@ -0,0 +1,24 @@
+package persistence
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+)
+
+type MockAuditRepo struct {
+	AppendFunc func(entry model.AuditEntry) error
+	GetAllFunc func() ([]model.AuditEntry, error)
+}
+
+func (m *MockAuditRepo) Append(entry model.AuditEntry) error {
+	if m.AppendFunc != nil {
+		return m.AppendFunc(entry)
+	}
+	return nil
+}
+
+func (m *MockAuditRepo) GetAll() ([]model.AuditEntry, error) {
+	if m.GetAllFunc != nil {
+		return m.GetAllFunc()
+	}
+	return []model.AuditEntry{}, nil
+}
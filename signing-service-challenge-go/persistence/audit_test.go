@@ -0,0 +1,45 @@
+package persistence
+
+import (
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/google/uuid"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AuditRepo", func() {
+	var (
+		auditRepo *AuditRepository
+	)
+
+	BeforeEach(func() {
+		auditRepo = NewAuditRepository()
+	})
+
+	Describe("Append", func() {
+		It("should keep the entries in order", func() {
+			first := model.AuditEntry{Action: "key-export", DeviceID: uuid.New(), Outcome: "denied"}
+			second := model.AuditEntry{Action: "key-export", DeviceID: uuid.New(), Outcome: "exported"}
+
+			Expect(auditRepo.Append(first)).To(Succeed(), "Failed to append the first entry")
+			Expect(auditRepo.Append(second)).To(Succeed(), "Failed to append the second entry")
+
+			entries, err := auditRepo.GetAll()
+			Expect(err).To(BeNil(), "Failed to retrieve the audit log")
+			Expect(entries).To(Equal([]model.AuditEntry{first, second}), "The entries should be returned in the order they were appended")
+		})
+
+		It("should not let callers modify the log", func() {
+			Expect(auditRepo.Append(model.AuditEntry{Action: "key-export"})).To(Succeed(), "Failed to append the entry")
+
+			entries, err := auditRepo.GetAll()
+			Expect(err).To(BeNil(), "Failed to retrieve the audit log")
+			entries[0].Action = "tampered"
+
+			entries, err = auditRepo.GetAll()
+			Expect(err).To(BeNil(), "Failed to retrieve the audit log")
+			Expect(entries[0].Action).To(Equal("key-export"), "The stored entry should not change")
+		})
+	})
+})
@@ -0,0 +1,118 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/google/uuid"
+)
+
+// ErrConflict is matched by a ConflictError with errors.Is
+var ErrConflict = errors.New("device chain state conflict")
+
+var (
+	// ErrCounterReserved is returned when the next counter of a device is reserved by another signer.
+	// It matches ErrConflict, as the signature can be retried once the reservation is committed or released.
+	ErrCounterReserved = fmt.Errorf("%w: counter is reserved", ErrConflict)
+	// ErrReservationLost is returned when a signer commits a reservation it no longer holds, because it expired
+	// and was taken over or recovered. It matches ErrConflict.
+	ErrReservationLost = fmt.Errorf("%w: reservation lost", ErrConflict)
+	// ErrKeyChanged is returned when the key handle of a device is replaced while the device no longer has the key,
+	// because it was rotated in the meantime. It matches ErrConflict.
+	ErrKeyChanged = fmt.Errorf("%w: key changed", ErrConflict)
+)
+
+// ConflictError is returned when the chain state of a device changed since the caller read it,
+// e.g. because another instance of the service signed with the device in the meantime.
+type ConflictError struct {
+	DeviceID uuid.UUID
+	Expected model.ChainState
+	Actual   model.ChainState
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: device %s is at counter %d instead of %d", ErrConflict, e.DeviceID, e.Actual.SignatureCounter, e.Expected.SignatureCounter)
+}
+
+// Is matches ErrConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// NewReservation returns a reservation of the next counter of a device at the expected chain state,
+// which expires after the timeout
+func NewReservation(id uuid.UUID, expected model.ChainState, timeout time.Duration) model.Reservation {
+	return model.Reservation{
+		ID:       uuid.New(),
+		DeviceID: id,
+		Expected: expected,
+		Expires:  time.Now().Add(timeout).UTC(),
+	}
+}
+
+// Check that a reservation can be taken while another one is held, which is only the case once it expired
+func checkReservable(reservation model.Reservation, held model.Reservation, exists bool) error {
+	if exists && held.ID != reservation.ID && held.Expires.After(time.Now()) {
+		return fmt.Errorf("%w: counter %d of device %s is reserved until %s", ErrCounterReserved,
+			held.Expected.SignatureCounter, held.DeviceID, held.Expires.Format(time.RFC3339Nano))
+	}
+
+	return nil
+}
+
+// Check that the reservation committed by a signer is the one held for the device
+func checkReservationHeld(reservation model.Reservation, held model.Reservation, exists bool) error {
+	if !exists || held.ID != reservation.ID {
+		return fmt.Errorf("%w: reservation %s of counter %d of device %s", ErrReservationLost,
+			reservation.ID, reservation.Expected.SignatureCounter, reservation.DeviceID)
+	}
+
+	return nil
+}
+
+// Check that the active key of a device is the expected one
+func checkKeyID(device model.Device, keyID string) error {
+	if device.KeyID != keyID {
+		return fmt.Errorf("%w: device %s has key %s instead of %s", ErrKeyChanged, device.ID, device.KeyID, keyID)
+	}
+
+	return nil
+}
+
+// Get the chain state of a device
+func deviceChainState(device model.Device) model.ChainState {
+	return model.ChainState{SignatureCounter: device.SignatureCounter, LastSignature: device.LastSignature}
+}
+
+// Check that the chain state of a device is the expected one
+func checkChainState(id uuid.UUID, expected, actual model.ChainState) error {
+	if actual != expected {
+		return &ConflictError{DeviceID: id, Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
+
+// Check that a signature record continues the chain from the expected state
+func checkSignRecord(id uuid.UUID, expected model.ChainState, record model.SignatureRecord) error {
+	if record.DeviceID != id || record.Counter != expected.SignatureCounter {
+		return fmt.Errorf("signature %d of device %s does not continue the chain of device %s at counter %d", record.Counter, record.DeviceID, id, expected.SignatureCounter)
+	}
+
+	return nil
+}
+
+// Check that the record of a rotation event continues the chain from the expected state, and precedes the
+// counter of the rotated device
+func checkRotateRecord(device model.Device, expected model.ChainState, record model.SignatureRecord) error {
+	if err := checkSignRecord(device.ID, expected, record); err != nil {
+		return err
+	}
+	if device.SignatureCounter != record.Counter+1 {
+		return fmt.Errorf("signature %d of device %s does not precede counter %d", record.Counter, record.DeviceID, device.SignatureCounter)
+	}
+
+	return nil
+}
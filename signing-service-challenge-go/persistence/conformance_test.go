@@ -0,0 +1,32 @@
+package persistence_test
+
+import (
+	"path/filepath"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence/repotest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = repotest.DescribeDeviceRepository("DeviceRepository", func() persistence.DeviceRepoInterface {
+	return persistence.NewDeviceRepository()
+})
+
+var _ = repotest.DescribeDeviceRepository("SQLDeviceRepository", func() persistence.DeviceRepoInterface {
+	db, dialect, err := persistence.OpenDatabase("sqlite", "file:"+filepath.Join(GinkgoT().TempDir(), "devices.db"))
+	Expect(err).To(BeNil(), "Failed to open the database")
+	DeferCleanup(db.Close)
+
+	repo, err := persistence.NewSQLDeviceRepository(db, dialect, nil)
+	Expect(err).To(BeNil(), "Failed to create the repository")
+	return repo
+})
+
+var _ = repotest.DescribeDeviceRepository("FileDeviceRepository", func() persistence.DeviceRepoInterface {
+	repo, err := persistence.NewFileDeviceRepository(GinkgoT().TempDir(), nil, 0)
+	Expect(err).To(BeNil(), "Failed to open the repository")
+	DeferCleanup(repo.Close)
+	return repo
+})
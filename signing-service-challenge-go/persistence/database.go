@@ -0,0 +1,41 @@
+package persistence
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// OpenDatabase opens the database of a driver and returns it with its dialect. The "sqlite" driver is embedded,
+// with a DSN such as "file:devices.db"; other drivers, like "postgres", must be registered by the program.
+// SQLite connections start their transactions as IMMEDIATE, waiting up to 5 seconds for the database lock,
+// which serializes the signature counter increments as it has no row-level locks.
+func OpenDatabase(driver, dsn string) (*sql.DB, Dialect, error) {
+	var dialect Dialect
+	switch driver {
+	case DialectSQLite.Name:
+		dialect = DialectSQLite
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	case DialectPostgres.Name, "pgx":
+		dialect = DialectPostgres
+	default:
+		return nil, Dialect{}, fmt.Errorf("unsupported database driver %q", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, Dialect{}, err
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, Dialect{}, fmt.Errorf("failed to connect to the %s database: %w", driver, err)
+	}
+
+	return db, dialect, nil
+}
@@ -0,0 +1,12 @@
+package persistence
+
+import "errors"
+
+var (
+	// ErrDeviceNotFound is returned when no device is stored with the requested ID
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceExists is returned when a device is created with the ID of a stored device
+	ErrDeviceExists = errors.New("device already exists")
+	// ErrSignatureNotFound is returned when a device has not journaled a signature with the requested counter
+	ErrSignatureNotFound = errors.New("signature not found")
+)
@@ -1,8 +1,11 @@
 package persistence
 
 import (
-	"errors"
+	"encoding/base64"
+	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
 	"github.com/google/uuid"
@@ -12,27 +15,65 @@ type DeviceRepoInterface interface {
 	Create(device model.Device) error
 	FindByID(id uuid.UUID) (*model.Device, error)
 	GetAll() ([]model.Device, error)
-	AfterSignUpdateDevice(id uuid.UUID, lastSignature string) error
+	ReserveCounter(reservation model.Reservation) error
+	AfterSignUpdateDevice(reservation model.Reservation, record model.SignatureRecord) error
+	AfterRotateUpdateDevice(reservation model.Reservation, device model.Device, record model.SignatureRecord) error
+	ReleaseReservation(reservation model.Reservation) error
+	RecoverReservations(now time.Time) ([]model.Reservation, error)
+	UpdateKeyHandle(id uuid.UUID, keyID string, keyHandle []byte) error
+	GetSignatures(id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error)
+	GetSignature(id uuid.UUID, counter int) (*model.SignatureRecord, error)
+	FindSignatureByIdempotencyKey(id uuid.UUID, key string, since time.Time) (*model.SignatureRecord, error)
 }
 
+// DeviceRepository keeps the devices together with the journal of the signatures they issued,
+// so a signature is journaled in the same step as the counter increment of its device
 type DeviceRepository struct {
-	data map[uuid.UUID]model.Device
-	mu   sync.RWMutex
+	data         map[uuid.UUID]model.Device
+	signatures   map[uuid.UUID][]model.SignatureRecord
+	reservations map[uuid.UUID]model.Reservation // reserved counter of each device, by device ID
+	mu           sync.RWMutex
 }
 
 // Initialize
 func NewDeviceRepository() *DeviceRepository {
 	return &DeviceRepository{
-		data: make(map[uuid.UUID]model.Device),
+		data:         make(map[uuid.UUID]model.Device),
+		signatures:   make(map[uuid.UUID][]model.SignatureRecord),
+		reservations: make(map[uuid.UUID]model.Reservation),
 	}
 }
 
-// Create stores a new device
+// Create stores a new device, unless a device with its ID is already stored
 func (r *DeviceRepository) Create(device model.Device) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.data[device.ID] = device
+	if _, exists := r.data[device.ID]; exists {
+		return ErrDeviceExists
+	}
+
+	r.data[device.ID] = cloneDevice(device)
+	return nil
+}
+
+// UpdateKeyHandle replaces the key handle of a device, e.g. once its private key is wrapped with another master key.
+// The device must still have the key, otherwise an error matching ErrKeyChanged is returned. The rest of the device,
+// and in particular its chain state, is left as it is.
+func (r *DeviceRepository) UpdateKeyHandle(id uuid.UUID, keyID string, keyHandle []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device, exists := r.data[id]
+	if !exists {
+		return ErrDeviceNotFound
+	}
+	if err := checkKeyID(device, keyID); err != nil {
+		return err
+	}
+
+	device.KeyHandle = slices.Clone(keyHandle)
+	r.data[id] = device
 	return nil
 }
 
@@ -43,9 +84,10 @@ func (r *DeviceRepository) FindByID(id uuid.UUID) (*model.Device, error) {
 
 	device, exists := r.data[id]
 	if !exists {
-		return nil, errors.New("device not found")
+		return nil, ErrDeviceNotFound
 	}
 
+	device = cloneDevice(device)
 	return &device, nil
 }
 
@@ -56,25 +98,231 @@ func (r *DeviceRepository) GetAll() ([]model.Device, error) {
 
 	devices := make([]model.Device, 0, len(r.data))
 	for _, device := range r.data {
-		devices = append(devices, device)
+		devices = append(devices, cloneDevice(device))
 	}
 
 	return devices, nil
 }
 
-// AfterSignUpdateDevice increments the signature counter and update the last signature checking multiple accesses
-func (r *DeviceRepository) AfterSignUpdateDevice(id uuid.UUID, lastSignature string) error {
+// ReserveCounter reserves the next counter of a device for a signature, before it is signed. The device must have
+// the expected chain state of the reservation, otherwise a ConflictError is returned, and its counter must not be
+// reserved by another signer, otherwise an error matching ErrCounterReserved is returned until that reservation expires.
+func (r *DeviceRepository) ReserveCounter(reservation model.Reservation) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	device, exists := r.data[id]
+	device, exists := r.data[reservation.DeviceID]
+	if !exists {
+		return ErrDeviceNotFound
+	}
+	held, reserved := r.reservations[reservation.DeviceID]
+	if err := checkReservable(reservation, held, reserved); err != nil {
+		return err
+	}
+	if err := checkChainState(device.ID, reservation.Expected, deviceChainState(device)); err != nil {
+		return err
+	}
+
+	r.reservations[reservation.DeviceID] = reservation
+	return nil
+}
+
+// AfterSignUpdateDevice commits a reservation: it increments the signature counter, updates the last signature
+// and journals the signature in one step, checking multiple accesses. The reservation must still be held,
+// otherwise an error matching ErrReservationLost is returned, and the record must continue its expected chain state.
+func (r *DeviceRepository) AfterSignUpdateDevice(reservation model.Reservation, record model.SignatureRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkCommit(reservation); err != nil {
+		return err
+	}
+	if err := checkSignRecord(reservation.DeviceID, reservation.Expected, record); err != nil {
+		return err
+	}
+
+	return r.journalSignature(reservation.Expected, record)
+}
+
+// AfterRotateUpdateDevice commits a reservation: it stores the rotated device and journals the signature of its
+// rotation event in one step. The reservation must still be held, otherwise an error matching ErrReservationLost
+// is returned, and the record must continue its expected chain state. The rotated device continues the chain after the record.
+func (r *DeviceRepository) AfterRotateUpdateDevice(reservation model.Reservation, device model.Device, record model.SignatureRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkCommit(reservation); err != nil {
+		return err
+	}
+	if device.ID != reservation.DeviceID {
+		return fmt.Errorf("reservation of device %s cannot rotate device %s", reservation.DeviceID, device.ID)
+	}
+	if err := checkRotateRecord(device, reservation.Expected, record); err != nil {
+		return err
+	}
+
+	return r.journalRotation(device, reservation.Expected, record)
+}
+
+// ReleaseReservation gives up a reservation without consuming its counter, e.g. because signing failed.
+// A reservation that is no longer held is ignored.
+func (r *DeviceRepository) ReleaseReservation(reservation model.Reservation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if held, reserved := r.reservations[reservation.DeviceID]; reserved && held.ID == reservation.ID {
+		delete(r.reservations, reservation.DeviceID)
+	}
+
+	return nil
+}
+
+// RecoverReservations releases the reservations that expired at the given time without being committed or released,
+// and returns them. As a reservation is committed in the same step as its signature, their counters were not consumed.
+func (r *DeviceRepository) RecoverReservations(now time.Time) ([]model.Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var recovered []model.Reservation
+	for id, reservation := range r.reservations {
+		if !reservation.Expires.After(now) {
+			recovered = append(recovered, reservation)
+			delete(r.reservations, id)
+		}
+	}
+
+	return recovered, nil
+}
+
+// GetSignatures retrieves a page of the journaled signatures of a device in the order they were issued,
+// together with their total number. A limit of 0 returns all the signatures from the offset.
+func (r *DeviceRepository) GetSignatures(id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, exists := r.data[id]; !exists {
+		return nil, 0, ErrDeviceNotFound
+	}
+
+	journal := r.signatures[id]
+	start := min(max(offset, 0), len(journal))
+	end := len(journal)
+	if limit > 0 {
+		end = min(start+limit, end)
+	}
+
+	records := make([]model.SignatureRecord, 0, end-start)
+	for _, record := range journal[start:end] {
+		records = append(records, cloneSignatureRecord(record))
+	}
+
+	return records, len(journal), nil
+}
+
+// GetSignature retrieves the journaled signature of a device with the given counter
+func (r *DeviceRepository) GetSignature(id uuid.UUID, counter int) (*model.SignatureRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, exists := r.data[id]; !exists {
+		return nil, ErrDeviceNotFound
+	}
+
+	for _, record := range r.signatures[id] {
+		if record.Counter == counter {
+			record = cloneSignatureRecord(record)
+			return &record, nil
+		}
+	}
+
+	return nil, ErrSignatureNotFound
+}
+
+// FindSignatureByIdempotencyKey retrieves the last signature of a device journaled with the idempotency key
+// since the given time
+func (r *DeviceRepository) FindSignatureByIdempotencyKey(id uuid.UUID, key string, since time.Time) (*model.SignatureRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, exists := r.data[id]; !exists {
+		return nil, ErrDeviceNotFound
+	}
+
+	// Walk the journal back to the start of the period, the signatures being journaled in time order
+	journal := r.signatures[id]
+	for i := len(journal) - 1; i >= 0 && !journal[i].Time.Before(since); i-- {
+		if journal[i].IdempotencyKey == key {
+			record := cloneSignatureRecord(journal[i])
+			return &record, nil
+		}
+	}
+
+	return nil, ErrSignatureNotFound
+}
+
+// Check that a reservation can be committed, with the lock held
+func (r *DeviceRepository) checkCommit(reservation model.Reservation) error {
+	if _, exists := r.data[reservation.DeviceID]; !exists {
+		return ErrDeviceNotFound
+	}
+	held, reserved := r.reservations[reservation.DeviceID]
+
+	return checkReservationHeld(reservation, held, reserved)
+}
+
+// Increment the signature counter, update the last signature and journal the signature of a device in the
+// expected chain state, with the lock held. The reservation of the device is consumed.
+func (r *DeviceRepository) journalSignature(expected model.ChainState, record model.SignatureRecord) error {
+	device, exists := r.data[record.DeviceID]
 	if !exists {
-		return errors.New("device not found")
+		return ErrDeviceNotFound
+	}
+	if err := checkChainState(device.ID, expected, deviceChainState(device)); err != nil {
+		return err
 	}
 
 	device.SignatureCounter++
-	device.LastSignature = lastSignature
+	device.LastSignature = base64.StdEncoding.EncodeToString(record.Signature)
 
-	r.data[id] = device
+	r.data[device.ID] = device
+	r.signatures[device.ID] = append(r.signatures[device.ID], cloneSignatureRecord(record))
+	delete(r.reservations, device.ID)
+	return nil
+}
+
+// Store the rotated device and journal the signature of its rotation event from the expected chain state,
+// with the lock held. The reservation of the device is consumed.
+func (r *DeviceRepository) journalRotation(device model.Device, expected model.ChainState, record model.SignatureRecord) error {
+	stored, exists := r.data[device.ID]
+	if !exists {
+		return ErrDeviceNotFound
+	}
+	if err := checkChainState(device.ID, expected, deviceChainState(stored)); err != nil {
+		return err
+	}
+
+	r.data[device.ID] = cloneDevice(device)
+	r.signatures[device.ID] = append(r.signatures[device.ID], cloneSignatureRecord(record))
+	delete(r.reservations, device.ID)
 	return nil
 }
+
+// Copy a device so the stored state shares no memory with the devices of the callers.
+// Public keys are never modified, so they are shared.
+func cloneDevice(device model.Device) model.Device {
+	device.KeyHandle = slices.Clone(device.KeyHandle)
+	device.PreviousKeys = slices.Clone(device.PreviousKeys)
+	if device.ImportedChain != nil {
+		importedChain := *device.ImportedChain
+		device.ImportedChain = &importedChain
+	}
+
+	return device
+}
+
+// Copy a signature record so the journal shares no memory with the records of the callers
+func cloneSignatureRecord(record model.SignatureRecord) model.SignatureRecord {
+	record.Signature = slices.Clone(record.Signature)
+
+	return record
+}
@@ -1,15 +1,25 @@
 package persistence
 
 import (
+	"time"
+
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
 	"github.com/google/uuid"
 )
 
 type MockDeviceRepo struct {
-	CreateFunc                func(device model.Device) error
-	FindByIDFunc              func(id uuid.UUID) (*model.Device, error)
-	GetAllFunc                func() ([]model.Device, error)
-	AfterSignUpdateDeviceFunc func(id uuid.UUID, lastSignature string) error
+	CreateFunc                        func(device model.Device) error
+	FindByIDFunc                      func(id uuid.UUID) (*model.Device, error)
+	GetAllFunc                        func() ([]model.Device, error)
+	ReserveCounterFunc                func(reservation model.Reservation) error
+	AfterSignUpdateDeviceFunc         func(reservation model.Reservation, record model.SignatureRecord) error
+	AfterRotateUpdateDeviceFunc       func(reservation model.Reservation, device model.Device, record model.SignatureRecord) error
+	ReleaseReservationFunc            func(reservation model.Reservation) error
+	RecoverReservationsFunc           func(now time.Time) ([]model.Reservation, error)
+	UpdateKeyHandleFunc               func(id uuid.UUID, keyID string, keyHandle []byte) error
+	GetSignaturesFunc                 func(id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error)
+	GetSignatureFunc                  func(id uuid.UUID, counter int) (*model.SignatureRecord, error)
+	FindSignatureByIdempotencyKeyFunc func(id uuid.UUID, key string, since time.Time) (*model.SignatureRecord, error)
 }
 
 func (m *MockDeviceRepo) Create(device model.Device) error {
@@ -28,7 +38,6 @@ func (m *MockDeviceRepo) FindByID(id uuid.UUID) (*model.Device, error) {
 		Algorithm:        "ECC",
 		Label:            "Mock Device",
 		PublicKey:        nil,
-		PrivateKey:       nil,
 		SignatureCounter: 0,
 		LastSignature:    "",
 	}, nil
@@ -41,9 +50,65 @@ func (m *MockDeviceRepo) GetAll() ([]model.Device, error) {
 	return nil, nil
 }
 
-func (m *MockDeviceRepo) AfterSignUpdateDevice(id uuid.UUID, lastSignature string) error {
+func (m *MockDeviceRepo) ReserveCounter(reservation model.Reservation) error {
+	if m.ReserveCounterFunc != nil {
+		return m.ReserveCounterFunc(reservation)
+	}
+	return nil
+}
+
+func (m *MockDeviceRepo) AfterSignUpdateDevice(reservation model.Reservation, record model.SignatureRecord) error {
 	if m.AfterSignUpdateDeviceFunc != nil {
-		return m.AfterSignUpdateDeviceFunc(id, lastSignature)
+		return m.AfterSignUpdateDeviceFunc(reservation, record)
+	}
+	return nil
+}
+
+func (m *MockDeviceRepo) AfterRotateUpdateDevice(reservation model.Reservation, device model.Device, record model.SignatureRecord) error {
+	if m.AfterRotateUpdateDeviceFunc != nil {
+		return m.AfterRotateUpdateDeviceFunc(reservation, device, record)
+	}
+	return nil
+}
+
+func (m *MockDeviceRepo) ReleaseReservation(reservation model.Reservation) error {
+	if m.ReleaseReservationFunc != nil {
+		return m.ReleaseReservationFunc(reservation)
+	}
+	return nil
+}
+
+func (m *MockDeviceRepo) RecoverReservations(now time.Time) ([]model.Reservation, error) {
+	if m.RecoverReservationsFunc != nil {
+		return m.RecoverReservationsFunc(now)
+	}
+	return nil, nil
+}
+
+func (m *MockDeviceRepo) UpdateKeyHandle(id uuid.UUID, keyID string, keyHandle []byte) error {
+	if m.UpdateKeyHandleFunc != nil {
+		return m.UpdateKeyHandleFunc(id, keyID, keyHandle)
 	}
 	return nil
 }
+
+func (m *MockDeviceRepo) GetSignatures(id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error) {
+	if m.GetSignaturesFunc != nil {
+		return m.GetSignaturesFunc(id, offset, limit)
+	}
+	return []model.SignatureRecord{}, 0, nil
+}
+
+func (m *MockDeviceRepo) GetSignature(id uuid.UUID, counter int) (*model.SignatureRecord, error) {
+	if m.GetSignatureFunc != nil {
+		return m.GetSignatureFunc(id, counter)
+	}
+	return nil, ErrSignatureNotFound
+}
+
+func (m *MockDeviceRepo) FindSignatureByIdempotencyKey(id uuid.UUID, key string, since time.Time) (*model.SignatureRecord, error) {
+	if m.FindSignatureByIdempotencyKeyFunc != nil {
+		return m.FindSignatureByIdempotencyKeyFunc(id, key, since)
+	}
+	return nil, ErrSignatureNotFound
+}
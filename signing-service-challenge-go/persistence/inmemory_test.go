@@ -2,7 +2,10 @@ package persistence
 
 import (
 	"crypto/rsa"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
 	"github.com/google/uuid"
@@ -28,7 +31,7 @@ var _ = Describe("DeviceRepo", func() {
 					Algorithm:        "ECC",
 					Label:            "Test device",
 					PublicKey:        nil,
-					PrivateKey:       nil,
+					KeyHandle:        nil,
 					SignatureCounter: 0,
 				}
 
@@ -51,7 +54,7 @@ var _ = Describe("DeviceRepo", func() {
 				Algorithm:        algorithm,
 				Label:            label,
 				PublicKey:        &rsa.PublicKey{},
-				PrivateKey:       &rsa.PrivateKey{},
+				KeyHandle:        []byte("key-handle"),
 				SignatureCounter: 0,
 			}
 			err := deviceRepo.Create(device)
@@ -70,7 +73,7 @@ var _ = Describe("DeviceRepo", func() {
 				Expect(createdDevice.Algorithm).To(Equal(algorithm), "Device algorithm should match the created device algorithm")
 				Expect(createdDevice.Label).To(Equal(label), "Device label should match the created device label")
 				Expect(createdDevice.PublicKey).ToNot(BeNil(), "Public key should not be nil")
-				Expect(createdDevice.PrivateKey).ToNot(BeNil(), "Private key should not be nil")
+				Expect(createdDevice.KeyHandle).ToNot(BeEmpty(), "Key handle should not be empty")
 				Expect(createdDevice.SignatureCounter).To(Equal(0), "Signature counter should be initialized to 0")
 				Expect(createdDevice.LastSignature).To(BeEmpty(), "Last signature should be empty")
 			})
@@ -99,7 +102,7 @@ var _ = Describe("DeviceRepo", func() {
 					Algorithm:        algorithm,
 					Label:            fmt.Sprintf("Test Device %d", i),
 					PublicKey:        &rsa.PublicKey{},
-					PrivateKey:       &rsa.PrivateKey{},
+					KeyHandle:        []byte("key-handle"),
 					SignatureCounter: 0,
 				}
 				err := deviceRepo.Create(device)
@@ -124,7 +127,7 @@ var _ = Describe("DeviceRepo", func() {
 					Expect(device.Algorithm).To(Equal("RSA"), "Algorithm should be RSA")
 					Expect(device.Label).To(ContainSubstring("Test Device"), "Label should contain 'Test Device'")
 					Expect(device.PublicKey).ToNot(BeNil(), "Public key should not be nil")
-					Expect(device.PrivateKey).ToNot(BeNil(), "Private key should not be nil")
+					Expect(device.KeyHandle).ToNot(BeEmpty(), "Key handle should not be empty")
 					Expect(device.SignatureCounter).To(Equal(0), "Signature counter should be 0")
 					Expect(device.LastSignature).To(BeEmpty(), "Last signature should be empty")
 				}
@@ -144,7 +147,7 @@ var _ = Describe("DeviceRepo", func() {
 				Algorithm:        algorithm,
 				Label:            "Test Device",
 				PublicKey:        &rsa.PublicKey{},
-				PrivateKey:       &rsa.PrivateKey{},
+				KeyHandle:        []byte("key-handle"),
 				SignatureCounter: 0,
 			}
 			err := deviceRepo.Create(device)
@@ -156,14 +159,145 @@ var _ = Describe("DeviceRepo", func() {
 
 		Context("when updating a device after signning", func() {
 			It("should update only the counter and the last signature", func() {
-				lastSignature := "test_signature"
-				err := deviceRepo.AfterSignUpdateDevice(deviceID, lastSignature)
+				record := model.SignatureRecord{DeviceID: deviceID, Counter: 0, Signature: []byte("test_signature")}
+				err := deviceRepo.AfterSignUpdateDevice(reserve(deviceRepo, deviceID, model.ChainState{}), record)
 				Expect(err).To(BeNil(), "Failed to update device after signing")
 
 				updatedDevice, err := deviceRepo.FindByID(deviceID)
 				Expect(err).To(BeNil(), "Failed to find updated device")
 				Expect(updatedDevice.SignatureCounter).To(Equal(1), "Signature counter should be incremented to 1")
-				Expect(updatedDevice.LastSignature).To(Equal(lastSignature), "Last signature should match the provided signature")
+				Expect(updatedDevice.LastSignature).To(Equal("dGVzdF9zaWduYXR1cmU="), "Last signature should be the base64 encoded signature")
+			})
+
+			It("should journal the signature", func() {
+				record := model.SignatureRecord{DeviceID: deviceID, Counter: 0, Data: "data", Signature: []byte("test_signature")}
+				Expect(deviceRepo.AfterSignUpdateDevice(reserve(deviceRepo, deviceID, model.ChainState{}), record)).To(Succeed(), "Failed to update device after signing")
+
+				stored, err := deviceRepo.GetSignature(deviceID, 0)
+				Expect(err).To(BeNil(), "Failed to find the journaled signature")
+				Expect(*stored).To(Equal(record), "The journaled signature should be the signed record")
+			})
+		})
+
+		Context("when the signature does not continue the chain", func() {
+			It("should neither update the device nor journal the signature", func() {
+				record := model.SignatureRecord{DeviceID: deviceID, Counter: 3, Signature: []byte("test_signature")}
+				err := deviceRepo.AfterSignUpdateDevice(reserve(deviceRepo, deviceID, model.ChainState{}), record)
+				Expect(err).To(HaveOccurred(), "A signature with another counter should be rejected")
+
+				device, err := deviceRepo.FindByID(deviceID)
+				Expect(err).To(BeNil(), "Failed to find the device")
+				Expect(device.SignatureCounter).To(Equal(0), "Signature counter should not change")
+				_, total, err := deviceRepo.GetSignatures(deviceID, 0, 0)
+				Expect(err).To(BeNil(), "Failed to retrieve the journal")
+				Expect(total).To(Equal(0), "No signature should be journaled")
+			})
+		})
+
+		Context("when the device changed since it was read", func() {
+			It("should return a conflict with the current chain state", func() {
+				first := model.SignatureRecord{DeviceID: deviceID, Counter: 0, Signature: []byte("first")}
+				Expect(deviceRepo.AfterSignUpdateDevice(reserve(deviceRepo, deviceID, model.ChainState{}), first)).To(Succeed(), "Failed to update device after signing")
+
+				// Reserving the counter of a second signature from the same state, as another instance would
+				err := deviceRepo.ReserveCounter(NewReservation(deviceID, model.ChainState{}, time.Minute))
+				Expect(err).To(MatchError(ErrConflict), "The outdated state should be a conflict")
+				var conflict *ConflictError
+				Expect(errors.As(err, &conflict)).To(BeTrue(), "The conflict should be a ConflictError")
+				Expect(conflict.Actual).To(Equal(model.ChainState{SignatureCounter: 1, LastSignature: "Zmlyc3Q="}), "The conflict should report the current state")
+			})
+		})
+	})
+
+	Describe("AfterRotateUpdateDevice", func() {
+		It("should store the rotated device and journal the rotation event", func() {
+			device := model.Device{ID: uuid.New(), Algorithm: "ECC", KeyID: "key-1"}
+			Expect(deviceRepo.Create(device)).To(Succeed(), "Failed setting up the device")
+
+			device.KeyID = "key-2"
+			device.SignatureCounter = 1
+			record := model.SignatureRecord{DeviceID: device.ID, Counter: 0, Data: "key-rotation", KeyID: "key-1"}
+			Expect(deviceRepo.AfterRotateUpdateDevice(reserve(deviceRepo, device.ID, model.ChainState{}), device, record)).To(Succeed(), "Failed to store the rotated device")
+
+			stored, err := deviceRepo.FindByID(device.ID)
+			Expect(err).To(BeNil(), "Failed to find the device")
+			Expect(stored.KeyID).To(Equal("key-2"), "The device should have the new key")
+			records, _, err := deviceRepo.GetSignatures(device.ID, 0, 0)
+			Expect(err).To(BeNil(), "Failed to retrieve the journal")
+			Expect(records).To(Equal([]model.SignatureRecord{record}), "The rotation event should be journaled")
+		})
+	})
+
+	Describe("GetSignatures", func() {
+		var deviceID uuid.UUID
+
+		BeforeEach(func() {
+			deviceID = uuid.New()
+			Expect(deviceRepo.Create(model.Device{ID: deviceID, Algorithm: "ECC"})).To(Succeed(), "Failed setting up the device")
+			expected := model.ChainState{}
+			for i := 0; i < 5; i++ {
+				record := model.SignatureRecord{DeviceID: deviceID, Counter: i, Signature: []byte(fmt.Sprintf("signature %d", i))}
+				Expect(deviceRepo.AfterSignUpdateDevice(reserve(deviceRepo, deviceID, expected), record)).To(Succeed(), "Failed setting up the journal")
+				expected = model.ChainState{SignatureCounter: i + 1, LastSignature: base64.StdEncoding.EncodeToString(record.Signature)}
+			}
+		})
+
+		It("should return a page of the signatures in the order they were issued", func() {
+			records, total, err := deviceRepo.GetSignatures(deviceID, 1, 2)
+			Expect(err).To(BeNil(), "Failed to retrieve the journal")
+			Expect(total).To(Equal(5), "The total should count all the signatures")
+			Expect(records).To(HaveLen(2), "The page should have the requested size")
+			Expect(records[0].Counter).To(Equal(1), "The page should start at the offset")
+			Expect(records[1].Counter).To(Equal(2), "The signatures should be in the order they were issued")
+		})
+
+		It("should return the remaining signatures without limit", func() {
+			records, _, err := deviceRepo.GetSignatures(deviceID, 3, 0)
+			Expect(err).To(BeNil(), "Failed to retrieve the journal")
+			Expect(records).To(HaveLen(2), "All the signatures from the offset should be returned")
+		})
+
+		It("should return an empty page past the end", func() {
+			records, total, err := deviceRepo.GetSignatures(deviceID, 10, 2)
+			Expect(err).To(BeNil(), "Failed to retrieve the journal")
+			Expect(records).To(BeEmpty(), "The page should be empty")
+			Expect(total).To(Equal(5), "The total should count all the signatures")
+		})
+
+		It("should fail for unknown devices", func() {
+			_, _, err := deviceRepo.GetSignatures(uuid.New(), 0, 0)
+			Expect(err).To(MatchError(ErrDeviceNotFound), "The device should not be found")
+		})
+	})
+
+	Describe("GetSignature", func() {
+		It("should fail for counters the device has not journaled", func() {
+			deviceID := uuid.New()
+			Expect(deviceRepo.Create(model.Device{ID: deviceID, Algorithm: "ECC"})).To(Succeed(), "Failed setting up the device")
+
+			_, err := deviceRepo.GetSignature(deviceID, 0)
+			Expect(err).To(MatchError(ErrSignatureNotFound), "The signature should not be found")
+		})
+	})
+
+	Describe("UpdateKeyHandle", func() {
+		Context("when the device has the key", func() {
+			It("should store the new key handle", func() {
+				device := model.Device{ID: uuid.New(), Algorithm: "ECC", Label: "Test Device", KeyID: "key-1", KeyHandle: []byte("old")}
+				Expect(deviceRepo.Create(device)).To(Succeed(), "Failed setting up the device")
+
+				Expect(deviceRepo.UpdateKeyHandle(device.ID, "key-1", []byte("new"))).To(Succeed(), "Failed to update the key handle")
+
+				updatedDevice, err := deviceRepo.FindByID(device.ID)
+				Expect(err).To(BeNil(), "Failed to find updated device")
+				Expect(updatedDevice.KeyHandle).To(Equal([]byte("new")), "The key handle should be updated")
+			})
+		})
+
+		Context("when the device does not exist", func() {
+			It("should return an error", func() {
+				err := deviceRepo.UpdateKeyHandle(uuid.New(), "key-1", []byte("new"))
+				Expect(err).To(MatchError(ErrDeviceNotFound), "Updating a missing device should fail")
 			})
 		})
 	})
@@ -0,0 +1,77 @@
+package persistence
+
+import (
+	"fmt"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+)
+
+// storedDeviceKey is a previous key of a device as it is stored, with a PEM public key
+type storedDeviceKey struct {
+	ID           string `json:"id"`
+	PublicKey    string `json:"publicKey"`
+	FirstCounter int    `json:"firstCounter"`
+	LastCounter  int    `json:"lastCounter"`
+	Active       bool   `json:"active"`
+}
+
+// Encode the public key and the previous keys of a device as PEM, with the codec of its algorithm
+func encodeDeviceKeys(algorithms *crypto.Registry, device model.Device) (string, []storedDeviceKey, error) {
+	alg, err := algorithms.Get(device.Algorithm)
+	if err != nil {
+		return "", nil, err
+	}
+
+	publicKey, err := alg.Codec.EncodePublicKey(device.PublicKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode public key of device %s: %w", device.ID, err)
+	}
+
+	previousKeys := make([]storedDeviceKey, 0, len(device.PreviousKeys))
+	for _, key := range device.PreviousKeys {
+		keyPEM, err := alg.Codec.EncodePublicKey(key.PublicKey)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to encode public key %s of device %s: %w", key.ID, device.ID, err)
+		}
+		previousKeys = append(previousKeys, storedDeviceKey{
+			ID:           key.ID,
+			PublicKey:    keyPEM,
+			FirstCounter: key.FirstCounter,
+			LastCounter:  key.LastCounter,
+			Active:       key.Active,
+		})
+	}
+
+	return publicKey, previousKeys, nil
+}
+
+// Decode the stored public key and previous keys into a device, with the codec of its algorithm
+func decodeDeviceKeys(algorithms *crypto.Registry, device *model.Device, publicKey string, previousKeys []storedDeviceKey) error {
+	alg, err := algorithms.Get(device.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	device.PublicKey, err = alg.Codec.DecodePublicKey([]byte(publicKey))
+	if err != nil {
+		return fmt.Errorf("failed to decode public key of device %s: %w", device.ID, err)
+	}
+
+	device.PreviousKeys = nil
+	for _, key := range previousKeys {
+		keyPublicKey, err := alg.Codec.DecodePublicKey([]byte(key.PublicKey))
+		if err != nil {
+			return fmt.Errorf("failed to decode public key %s of device %s: %w", key.ID, device.ID, err)
+		}
+		device.PreviousKeys = append(device.PreviousKeys, model.DeviceKey{
+			ID:           key.ID,
+			PublicKey:    keyPublicKey,
+			FirstCounter: key.FirstCounter,
+			LastCounter:  key.LastCounter,
+			Active:       key.Active,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,515 @@
+// Package repotest provides the conformance specs every persistence.DeviceRepoInterface implementation must pass.
+//
+// A backend runs them from its Ginkgo suite, with a function returning an empty repository for every spec:
+//
+//	var _ = repotest.DescribeDeviceRepository("MyDeviceRepository", func() persistence.DeviceRepoInterface {
+//		return NewMyDeviceRepository()
+//	})
+package repotest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/persistence"
+	"github.com/google/uuid"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	// Goroutines and signatures per goroutine of the concurrency spec
+	concurrentSigners    = 8
+	signaturesPerSigner  = 10
+	concurrentSignatures = concurrentSigners * signaturesPerSigner
+)
+
+// NewDevice returns a device with a fresh Ed25519 public key, which every backend can store
+func NewDevice() model.Device {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).To(BeNil(), "Failed to generate key")
+
+	return model.Device{
+		ID:        uuid.New(),
+		Algorithm: crypto.AlgorithmED25519,
+		Label:     "Conformance device",
+		Digest:    crypto.DigestSHA512,
+		KeyID:     "key-1",
+		PublicKey: publicKey,
+		KeyHandle: []byte("key-handle"),
+	}
+}
+
+// NewSignatureRecord returns the record of the signature with the counter of a device
+func NewSignatureRecord(id uuid.UUID, counter int) model.SignatureRecord {
+	return model.SignatureRecord{
+		DeviceID:   id,
+		Counter:    counter,
+		Data:       fmt.Sprintf("data-%d", counter),
+		SignedData: fmt.Sprintf("%d_data-%d_last", counter, counter),
+		Signature:  fmt.Appendf(nil, "signature-%d", counter),
+		Algorithm:  crypto.AlgorithmED25519,
+		KeyID:      "key-1",
+		Time:       time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+// ChainStateBefore returns the chain state of a device before the signature with the counter,
+// when its previous signatures were recorded with NewSignatureRecord
+func ChainStateBefore(counter int) model.ChainState {
+	if counter == 0 {
+		return model.ChainState{}
+	}
+
+	return model.ChainState{
+		SignatureCounter: counter,
+		LastSignature:    base64.StdEncoding.EncodeToString(NewSignatureRecord(uuid.Nil, counter-1).Signature),
+	}
+}
+
+// Reserve reserves the next counter of a device from the expected chain state for a minute,
+// failing the spec when it cannot
+func Reserve(repo persistence.DeviceRepoInterface, id uuid.UUID, expected model.ChainState) model.Reservation {
+	reservation := persistence.NewReservation(id, expected, time.Minute)
+	Expect(repo.ReserveCounter(reservation)).To(Succeed(), "Failed to reserve counter %d", expected.SignatureCounter)
+	return reservation
+}
+
+// DescribeDeviceRepository registers the conformance specs of DeviceRepoInterface for a backend.
+// newRepo is called before every spec and must return an empty repository, cleaned up with DeferCleanup if needed.
+func DescribeDeviceRepository(name string, newRepo func() persistence.DeviceRepoInterface) bool {
+	return Describe(name+" conformance", func() {
+		var (
+			repo   persistence.DeviceRepoInterface
+			device model.Device
+		)
+
+		// Read the stored device
+		find := func(id uuid.UUID) model.Device {
+			found, err := repo.FindByID(id)
+			Expect(err).To(BeNil(), "Failed to find device")
+			return *found
+		}
+
+		// Reserve the counter of a record made with NewSignatureRecord and journal it
+		journal := func(record model.SignatureRecord) error {
+			return repo.AfterSignUpdateDevice(Reserve(repo, record.DeviceID, ChainStateBefore(record.Counter)), record)
+		}
+
+		BeforeEach(func() {
+			repo = newRepo()
+			device = NewDevice()
+			Expect(repo.Create(device)).To(Succeed(), "Failed to create device")
+		})
+
+		Describe("Create and FindByID", func() {
+			It("should return the created device", func() {
+				Expect(find(device.ID)).To(Equal(device), "The found device should be the created one")
+			})
+
+			It("should keep every field of the device", func() {
+				stored := NewDevice()
+				stored.KeySize = 256
+				stored.Padding = crypto.PaddingPSS
+				stored.SaltLength = 32
+				stored.Encoding = crypto.EncodingP1363
+				stored.Deterministic = true
+				stored.PreviousKeys = []model.DeviceKey{
+					{ID: "key-0", PublicKey: NewDevice().PublicKey, FirstCounter: 0, LastCounter: 2},
+					{ID: "key-1", PublicKey: stored.PublicKey, FirstCounter: 3, LastCounter: -1, Active: true},
+				}
+				stored.SignatureCounter = 3
+				stored.LastSignature = "last"
+				stored.ImportedChain = &model.ChainState{SignatureCounter: 3, LastSignature: "last"}
+				stored.SecuredDataFormat = "v2"
+				Expect(repo.Create(stored)).To(Succeed(), "Failed to create device")
+
+				Expect(find(stored.ID)).To(Equal(stored), "Every field should be stored")
+			})
+
+			It("should return an error for a non-existent device", func() {
+				_, err := repo.FindByID(uuid.New())
+				Expect(err).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+			})
+
+			It("should not overwrite a device with the same ID", func() {
+				duplicate := NewDevice()
+				duplicate.ID = device.ID
+				duplicate.Label = "Duplicate device"
+				Expect(repo.Create(duplicate)).To(MatchError(persistence.ErrDeviceExists), "Expected device exists error")
+
+				Expect(find(device.ID)).To(Equal(device), "The stored device should be kept")
+			})
+		})
+
+		Describe("GetAll", func() {
+			It("should return every device", func() {
+				other := NewDevice()
+				Expect(repo.Create(other)).To(Succeed(), "Failed to create device")
+
+				devices, err := repo.GetAll()
+				Expect(err).To(BeNil(), "Failed to get devices")
+				Expect(devices).To(ConsistOf(device, other), "Expected every created device")
+			})
+		})
+
+		Describe("UpdateKeyHandle", func() {
+			It("should only replace the key handle of the device", func() {
+				Expect(repo.UpdateKeyHandle(device.ID, device.KeyID, []byte("rewrapped"))).To(Succeed(), "Failed to update the key handle")
+
+				device.KeyHandle = []byte("rewrapped")
+				Expect(find(device.ID)).To(Equal(device), "Only the key handle should be replaced")
+			})
+
+			It("should keep the signatures committed after the device was read", func() {
+				stale := find(device.ID)
+				Expect(journal(NewSignatureRecord(device.ID, 0))).To(Succeed(), "Failed to journal signature")
+
+				Expect(repo.UpdateKeyHandle(stale.ID, stale.KeyID, []byte("rewrapped"))).To(Succeed(), "Failed to update the key handle")
+				Expect(find(device.ID).SignatureCounter).To(Equal(1), "The signature should not be rolled back")
+			})
+
+			It("should return a conflict when the device no longer has the key", func() {
+				err := repo.UpdateKeyHandle(device.ID, "rotated-key", []byte("rewrapped"))
+				Expect(err).To(MatchError(persistence.ErrKeyChanged), "Expected the key change to be reported")
+				Expect(err).To(MatchError(persistence.ErrConflict), "A key change should be a conflict")
+				Expect(find(device.ID).KeyHandle).To(Equal(device.KeyHandle), "The key handle should be kept")
+			})
+
+			It("should return an error for a non-existent device", func() {
+				Expect(repo.UpdateKeyHandle(uuid.New(), "key-1", []byte("rewrapped"))).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+			})
+		})
+
+		Describe("ReserveCounter", func() {
+			It("should reserve the counter for one signer at a time", func() {
+				first := Reserve(repo, device.ID, ChainStateBefore(0))
+
+				second := persistence.NewReservation(device.ID, ChainStateBefore(0), time.Minute)
+				err := repo.ReserveCounter(second)
+				Expect(err).To(MatchError(persistence.ErrCounterReserved), "The counter should be reserved by the first signer")
+				Expect(err).To(MatchError(persistence.ErrConflict), "A reserved counter should be a conflict")
+
+				Expect(repo.AfterSignUpdateDevice(first, NewSignatureRecord(device.ID, 0))).To(Succeed(), "Failed to commit the reservation")
+				Expect(repo.ReserveCounter(second)).To(MatchError(persistence.ErrConflict), "The committed counter should not be reserved again")
+				Reserve(repo, device.ID, ChainStateBefore(1))
+			})
+
+			It("should return a conflict when the device left the expected state", func() {
+				Expect(journal(NewSignatureRecord(device.ID, 0))).To(Succeed(), "Failed to journal signature")
+
+				// Reserving from the state before the first signature, as another instance would
+				err := repo.ReserveCounter(persistence.NewReservation(device.ID, ChainStateBefore(0), time.Minute))
+				Expect(err).To(MatchError(persistence.ErrConflict), "The outdated state should be a conflict")
+				var conflict *persistence.ConflictError
+				Expect(errors.As(err, &conflict)).To(BeTrue(), "The conflict should be a ConflictError")
+				Expect(conflict.Actual).To(Equal(ChainStateBefore(1)), "The conflict should report the current state")
+
+				// The same counter chained to another last signature
+				err = repo.ReserveCounter(persistence.NewReservation(device.ID, model.ChainState{SignatureCounter: 1, LastSignature: "other"}, time.Minute))
+				Expect(err).To(MatchError(persistence.ErrConflict), "A different last signature should be a conflict")
+			})
+
+			It("should take over an expired reservation", func() {
+				expired := persistence.NewReservation(device.ID, ChainStateBefore(0), -time.Second)
+				Expect(repo.ReserveCounter(expired)).To(Succeed(), "Failed to reserve counter")
+				current := Reserve(repo, device.ID, ChainStateBefore(0))
+
+				Expect(repo.AfterSignUpdateDevice(expired, NewSignatureRecord(device.ID, 0))).To(MatchError(persistence.ErrReservationLost), "The expired reservation should be lost")
+				Expect(repo.AfterSignUpdateDevice(current, NewSignatureRecord(device.ID, 0))).To(Succeed(), "Failed to commit the reservation")
+			})
+
+			It("should return an error for a non-existent device", func() {
+				err := repo.ReserveCounter(persistence.NewReservation(uuid.New(), ChainStateBefore(0), time.Minute))
+				Expect(err).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+			})
+		})
+
+		Describe("AfterSignUpdateDevice", func() {
+			It("should increment the counter, update the last signature and journal the record", func() {
+				record := NewSignatureRecord(device.ID, 0)
+				Expect(journal(record)).To(Succeed(), "Failed to journal signature")
+
+				found := find(device.ID)
+				Expect(found.SignatureCounter).To(Equal(1), "The counter should be incremented")
+				Expect(found.LastSignature).To(Equal(base64.StdEncoding.EncodeToString(record.Signature)), "The last signature should be updated")
+				journaled, err := repo.GetSignature(device.ID, 0)
+				Expect(err).To(BeNil(), "Failed to get signature")
+				Expect(*journaled).To(Equal(record), "The record should be journaled")
+			})
+
+			It("should reject a record that does not continue the chain", func() {
+				reservation := Reserve(repo, device.ID, ChainStateBefore(0))
+				Expect(repo.AfterSignUpdateDevice(reservation, NewSignatureRecord(device.ID, 1))).NotTo(Succeed(), "The record should continue the expected state")
+				Expect(repo.AfterSignUpdateDevice(reservation, NewSignatureRecord(uuid.New(), 0))).NotTo(Succeed(), "The record should belong to the device")
+
+				Expect(find(device.ID).SignatureCounter).To(Equal(0), "The counter should not change")
+				_, total, err := repo.GetSignatures(device.ID, 0, 0)
+				Expect(err).To(BeNil(), "Failed to get signatures")
+				Expect(total).To(Equal(0), "Nothing should be journaled")
+			})
+
+			It("should return an error for a non-existent device", func() {
+				id := uuid.New()
+				reservation := persistence.NewReservation(id, ChainStateBefore(0), time.Minute)
+				Expect(repo.AfterSignUpdateDevice(reservation, NewSignatureRecord(id, 0))).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+			})
+
+			It("should reject a reservation that is not held", func() {
+				unreserved := persistence.NewReservation(device.ID, ChainStateBefore(0), time.Minute)
+				err := repo.AfterSignUpdateDevice(unreserved, NewSignatureRecord(device.ID, 0))
+				Expect(err).To(MatchError(persistence.ErrReservationLost), "An unreserved counter should not be committed")
+				Expect(err).To(MatchError(persistence.ErrConflict), "A lost reservation should be a conflict")
+
+				// Committing a reservation twice
+				reservation := Reserve(repo, device.ID, ChainStateBefore(0))
+				Expect(repo.AfterSignUpdateDevice(reservation, NewSignatureRecord(device.ID, 0))).To(Succeed(), "Failed to commit the reservation")
+				Expect(repo.AfterSignUpdateDevice(reservation, NewSignatureRecord(device.ID, 0))).To(MatchError(persistence.ErrReservationLost), "A reservation should be committed once")
+				Expect(find(device.ID).SignatureCounter).To(Equal(1), "Rejected commits should not change the counter")
+			})
+
+			It("should not lose increments of concurrent calls", func() {
+				var wg sync.WaitGroup
+				for range concurrentSigners {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						defer GinkgoRecover()
+						// Sign from the stored counter, retrying when another call reserved or took it first
+						for signed := 0; signed < signaturesPerSigner; {
+							found, err := repo.FindByID(device.ID)
+							Expect(err).To(BeNil(), "Failed to find device")
+							expected := model.ChainState{SignatureCounter: found.SignatureCounter, LastSignature: found.LastSignature}
+							reservation := persistence.NewReservation(device.ID, expected, time.Minute)
+							err = repo.ReserveCounter(reservation)
+							if err == nil {
+								Expect(repo.AfterSignUpdateDevice(reservation, NewSignatureRecord(device.ID, found.SignatureCounter))).To(Succeed(), "Failed to commit the reservation")
+								signed++
+								continue
+							}
+							Expect(err).To(MatchError(persistence.ErrConflict), "Concurrent calls should only conflict")
+						}
+					}()
+				}
+				wg.Wait()
+
+				Expect(find(device.ID).SignatureCounter).To(Equal(concurrentSignatures), "Every increment should be kept")
+				records, total, err := repo.GetSignatures(device.ID, 0, 0)
+				Expect(err).To(BeNil(), "Failed to get signatures")
+				Expect(total).To(Equal(concurrentSignatures), "Every signature should be journaled")
+				for i, record := range records {
+					Expect(record.Counter).To(Equal(i), "The journal should have no gaps nor duplicates")
+				}
+			})
+		})
+
+		Describe("AfterRotateUpdateDevice", func() {
+			It("should store the rotated device and journal the rotation", func() {
+				rotated := device
+				rotated.KeyID = "key-2"
+				rotated.SignatureCounter = 1
+				record := NewSignatureRecord(device.ID, 0)
+				reservation := Reserve(repo, device.ID, ChainStateBefore(0))
+				Expect(repo.AfterRotateUpdateDevice(reservation, rotated, record)).To(Succeed(), "Failed to store the rotation")
+
+				Expect(find(device.ID)).To(Equal(rotated), "The rotated device should be stored")
+				journaled, err := repo.GetSignature(device.ID, 0)
+				Expect(err).To(BeNil(), "Failed to get signature")
+				Expect(*journaled).To(Equal(record), "The rotation should be journaled")
+			})
+
+			It("should reject a rotation without the reservation", func() {
+				rotated := device
+				rotated.KeyID = "key-2"
+				rotated.SignatureCounter = 1
+				unreserved := persistence.NewReservation(device.ID, ChainStateBefore(0), time.Minute)
+				Expect(repo.AfterRotateUpdateDevice(unreserved, rotated, NewSignatureRecord(device.ID, 0))).To(MatchError(persistence.ErrReservationLost), "The counter should be reserved")
+
+				// Rotating another device with the reservation
+				other := NewDevice()
+				Expect(repo.Create(other)).To(Succeed(), "Failed to create device")
+				reservation := Reserve(repo, other.ID, ChainStateBefore(0))
+				Expect(repo.AfterRotateUpdateDevice(reservation, rotated, NewSignatureRecord(device.ID, 0))).NotTo(Succeed(), "The reservation should be for the rotated device")
+				Expect(find(device.ID).KeyID).To(Equal("key-1"), "The device should not be rotated")
+			})
+
+			It("should return an error for a non-existent device", func() {
+				rotated := NewDevice()
+				rotated.SignatureCounter = 1
+				reservation := persistence.NewReservation(rotated.ID, ChainStateBefore(0), time.Minute)
+				Expect(repo.AfterRotateUpdateDevice(reservation, rotated, NewSignatureRecord(rotated.ID, 0))).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+			})
+		})
+
+		Describe("ReleaseReservation", func() {
+			It("should free the counter without consuming it", func() {
+				reservation := Reserve(repo, device.ID, ChainStateBefore(0))
+				Expect(repo.ReleaseReservation(reservation)).To(Succeed(), "Failed to release the reservation")
+
+				Expect(find(device.ID).SignatureCounter).To(Equal(0), "The counter should not be consumed")
+				Expect(repo.AfterSignUpdateDevice(reservation, NewSignatureRecord(device.ID, 0))).To(MatchError(persistence.ErrReservationLost), "The released reservation should not be committed")
+				Reserve(repo, device.ID, ChainStateBefore(0))
+			})
+
+			It("should ignore a reservation that is no longer held", func() {
+				expired := persistence.NewReservation(device.ID, ChainStateBefore(0), -time.Second)
+				Expect(repo.ReserveCounter(expired)).To(Succeed(), "Failed to reserve counter")
+				current := Reserve(repo, device.ID, ChainStateBefore(0))
+
+				Expect(repo.ReleaseReservation(expired)).To(Succeed(), "Releasing a lost reservation should succeed")
+				Expect(repo.AfterSignUpdateDevice(current, NewSignatureRecord(device.ID, 0))).To(Succeed(), "The current reservation should be kept")
+			})
+		})
+
+		Describe("RecoverReservations", func() {
+			It("should release the expired reservations only", func() {
+				other := NewDevice()
+				Expect(repo.Create(other)).To(Succeed(), "Failed to create device")
+				expired := persistence.NewReservation(other.ID, ChainStateBefore(0), -time.Second)
+				Expect(repo.ReserveCounter(expired)).To(Succeed(), "Failed to reserve counter")
+				current := Reserve(repo, device.ID, ChainStateBefore(0))
+
+				recovered, err := repo.RecoverReservations(time.Now())
+				Expect(err).To(BeNil(), "Failed to recover reservations")
+				Expect(recovered).To(HaveLen(1), "Only the expired reservation should be recovered")
+				Expect(recovered[0].ID).To(Equal(expired.ID), "Expected the expired reservation")
+				Expect(recovered[0].DeviceID).To(Equal(other.ID), "Expected the device of the expired reservation")
+				Expect(recovered[0].Expected).To(Equal(expired.Expected), "Expected the reserved chain state")
+
+				Expect(repo.AfterSignUpdateDevice(expired, NewSignatureRecord(other.ID, 0))).To(MatchError(persistence.ErrReservationLost), "The recovered reservation should be released")
+				Expect(repo.AfterSignUpdateDevice(current, NewSignatureRecord(device.ID, 0))).To(Succeed(), "The current reservation should be kept")
+				Expect(find(other.ID).SignatureCounter).To(Equal(0), "The recovered counter should not be consumed")
+
+				recovered, err = repo.RecoverReservations(time.Now())
+				Expect(err).To(BeNil(), "Failed to recover reservations")
+				Expect(recovered).To(BeEmpty(), "Committed and recovered reservations should not be recovered again")
+			})
+		})
+
+		Describe("GetSignatures and GetSignature", func() {
+			BeforeEach(func() {
+				for counter := range 5 {
+					Expect(journal(NewSignatureRecord(device.ID, counter))).To(Succeed(), "Failed to journal signature %d", counter)
+				}
+			})
+
+			It("should return pages of the journal in order with its total", func() {
+				records, total, err := repo.GetSignatures(device.ID, 1, 2)
+				Expect(err).To(BeNil(), "Failed to get signatures")
+				Expect(total).To(Equal(5), "The total should count every signature")
+				Expect(records).To(HaveLen(2), "The page should be limited")
+				Expect(records[0].Counter).To(Equal(1), "The page should start at the offset")
+				Expect(records[1].Counter).To(Equal(2), "The records should be in order")
+
+				records, _, err = repo.GetSignatures(device.ID, 3, 0)
+				Expect(err).To(BeNil(), "Failed to get signatures")
+				Expect(records).To(HaveLen(2), "A limit of 0 should return every record from the offset")
+
+				records, _, err = repo.GetSignatures(device.ID, 10, 2)
+				Expect(err).To(BeNil(), "Failed to get signatures")
+				Expect(records).To(BeEmpty(), "An offset past the end should return no records")
+			})
+
+			It("should return not found errors", func() {
+				_, _, err := repo.GetSignatures(uuid.New(), 0, 0)
+				Expect(err).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+				_, err = repo.GetSignature(uuid.New(), 0)
+				Expect(err).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+				_, err = repo.GetSignature(device.ID, 5)
+				Expect(err).To(MatchError(persistence.ErrSignatureNotFound), "Expected signature not found error")
+			})
+		})
+
+		Describe("FindSignatureByIdempotencyKey", func() {
+			// Journal the next signature of the device with the idempotency key, at the time
+			sign := func(counter int, key string, at time.Time) model.SignatureRecord {
+				record := NewSignatureRecord(device.ID, counter)
+				record.IdempotencyKey = key
+				record.Time = at.UTC().Truncate(time.Microsecond)
+				Expect(journal(record)).To(Succeed(), "Failed to journal signature %d", counter)
+				return record
+			}
+
+			It("should return the last signature journaled with the key in the period", func() {
+				now := time.Now()
+				sign(0, "key-a", now.Add(-2*time.Hour))
+				sign(1, "key-b", now.Add(-time.Minute))
+				expected := sign(2, "key-a", now)
+
+				record, err := repo.FindSignatureByIdempotencyKey(device.ID, "key-a", now.Add(-time.Hour))
+				Expect(err).To(BeNil(), "Failed to find the signature")
+				Expect(*record).To(Equal(expected), "Expected the last signature with the key")
+			})
+
+			It("should not return signatures journaled before the period", func() {
+				now := time.Now()
+				sign(0, "key-a", now.Add(-2*time.Hour))
+				sign(1, "key-b", now)
+
+				_, err := repo.FindSignatureByIdempotencyKey(device.ID, "key-a", now.Add(-time.Hour))
+				Expect(err).To(MatchError(persistence.ErrSignatureNotFound), "The key should have expired")
+			})
+
+			It("should return not found errors", func() {
+				_, err := repo.FindSignatureByIdempotencyKey(uuid.New(), "key-a", time.Time{})
+				Expect(err).To(MatchError(persistence.ErrDeviceNotFound), "Expected device not found error")
+				_, err = repo.FindSignatureByIdempotencyKey(device.ID, "key-a", time.Time{})
+				Expect(err).To(MatchError(persistence.ErrSignatureNotFound), "Expected signature not found error")
+			})
+		})
+
+		Describe("Isolation", func() {
+			It("should not share the devices it stores with the caller", func() {
+				stored := NewDevice()
+				stored.PreviousKeys = []model.DeviceKey{{ID: "key-1", PublicKey: stored.PublicKey, Active: true}}
+				stored.ImportedChain = &model.ChainState{SignatureCounter: 1, LastSignature: "last"}
+				Expect(repo.Create(stored)).To(Succeed(), "Failed to create device")
+				expected := find(stored.ID)
+
+				// Modifying the created device
+				stored.KeyHandle[0] = 'X'
+				stored.PreviousKeys[0].Active = false
+				stored.ImportedChain.SignatureCounter = 2
+				Expect(find(stored.ID)).To(Equal(expected), "Modifying the created device should not change the stored one")
+
+				// Modifying the found and listed devices
+				found := find(stored.ID)
+				found.KeyHandle[0] = 'X'
+				found.PreviousKeys[0].Active = false
+				found.ImportedChain.SignatureCounter = 2
+				devices, err := repo.GetAll()
+				Expect(err).To(BeNil(), "Failed to get devices")
+				for i := range devices {
+					devices[i].KeyHandle[0] = 'X'
+					devices[i].Label = "Modified"
+				}
+				Expect(find(stored.ID)).To(Equal(expected), "Modifying the returned devices should not change the stored one")
+			})
+
+			It("should not share the records it journals with the caller", func() {
+				record := NewSignatureRecord(device.ID, 0)
+				Expect(journal(record)).To(Succeed(), "Failed to journal signature")
+				record.Signature[0] = 'X'
+
+				records, _, err := repo.GetSignatures(device.ID, 0, 0)
+				Expect(err).To(BeNil(), "Failed to get signatures")
+				records[0].Signature[0] = 'X'
+				journaled, err := repo.GetSignature(device.ID, 0)
+				Expect(err).To(BeNil(), "Failed to get signature")
+				journaled.Signature[0] = 'X'
+
+				journaled, err = repo.GetSignature(device.ID, 0)
+				Expect(err).To(BeNil(), "Failed to get signature")
+				Expect(journaled.Signature).To(Equal(NewSignatureRecord(device.ID, 0).Signature), "Modifying the records should not change the journal")
+			})
+		})
+	})
+}
@@ -0,0 +1,778 @@
+package persistence
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/google/uuid"
+)
+
+// Dialect adapts the statements of the SQLDeviceRepository to a database
+type Dialect struct {
+	Name          string
+	blobType      string
+	timestampType string
+	serialType    string // type of an auto-incremented primary key
+	lockRow       string // appended to the query reading a device that is about to be updated
+	placeholder   func(n int) string
+}
+
+var (
+	// DialectSQLite runs on SQLite. It has no row-level locks: transactions updating a device must be started
+	// as IMMEDIATE, e.g. with the "_txlock=immediate" DSN parameter, so they lock the database before reading.
+	DialectSQLite = Dialect{
+		Name:          "sqlite",
+		blobType:      "BLOB",
+		timestampType: "TIMESTAMP",
+		serialType:    "INTEGER PRIMARY KEY",
+		placeholder:   func(int) string { return "?" },
+	}
+	// DialectPostgres runs on PostgreSQL, locking the row of a device with SELECT ... FOR UPDATE
+	DialectPostgres = Dialect{
+		Name:          "postgres",
+		blobType:      "BYTEA",
+		timestampType: "TIMESTAMPTZ",
+		serialType:    "BIGSERIAL PRIMARY KEY",
+		lockRow:       " FOR UPDATE",
+		placeholder:   func(n int) string { return "$" + strconv.Itoa(n) },
+	}
+)
+
+// Replace the ? placeholders of a statement with the ones of the dialect
+func (d Dialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// Schema migrations, applied in order and recorded by their index in the schema_migrations table.
+// In the migrations using them, %[1]s is replaced by the binary type, %[2]s by the timestamp type and %[3]s by the
+// auto-incremented primary key type of the dialect.
+var migrations = []string{
+	`CREATE TABLE devices (
+		id                TEXT PRIMARY KEY,
+		algorithm         TEXT NOT NULL,
+		label             TEXT NOT NULL,
+		key_size          INTEGER NOT NULL,
+		curve             TEXT NOT NULL,
+		digest            TEXT NOT NULL,
+		padding           TEXT NOT NULL,
+		salt_length       INTEGER NOT NULL,
+		encoding          TEXT NOT NULL,
+		deterministic     BOOLEAN NOT NULL,
+		key_id            TEXT NOT NULL,
+		public_key        TEXT NOT NULL,
+		key_handle        %[1]s NOT NULL,
+		previous_keys     TEXT NOT NULL,
+		signature_counter INTEGER NOT NULL,
+		last_signature    TEXT NOT NULL,
+		imported_chain    TEXT
+	)`,
+	`CREATE TABLE signatures (
+		device_id   TEXT NOT NULL REFERENCES devices (id),
+		counter     INTEGER NOT NULL,
+		data        TEXT NOT NULL,
+		signed_data TEXT NOT NULL,
+		signature   %[1]s NOT NULL,
+		algorithm   TEXT NOT NULL,
+		key_id      TEXT NOT NULL,
+		created_at  %[2]s NOT NULL,
+		PRIMARY KEY (device_id, counter)
+	)`,
+	`CREATE TABLE audit_entries (
+		seq        %[3]s,
+		created_at %[2]s NOT NULL,
+		action     TEXT NOT NULL,
+		device_id  TEXT NOT NULL,
+		outcome    TEXT NOT NULL,
+		details    TEXT NOT NULL
+	)`,
+	`ALTER TABLE signatures ADD COLUMN idempotency_key TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX signatures_idempotency_key ON signatures (device_id, idempotency_key, created_at)`,
+	`CREATE TABLE signature_reservations (
+		device_id      TEXT PRIMARY KEY REFERENCES devices (id),
+		id             TEXT NOT NULL,
+		counter        INTEGER NOT NULL,
+		last_signature TEXT NOT NULL,
+		expires_at     %[2]s NOT NULL
+	)`,
+	`ALTER TABLE devices ADD COLUMN secured_data_format TEXT NOT NULL DEFAULT ''`,
+}
+
+const deviceColumns = `id, algorithm, label, key_size, curve, digest, padding, salt_length, encoding, deterministic,
+	key_id, public_key, key_handle, previous_keys, signature_counter, last_signature, imported_chain, secured_data_format`
+
+const signatureColumns = `device_id, counter, data, signed_data, signature, algorithm, key_id, created_at, idempotency_key`
+
+const reservationColumns = `device_id, id, counter, last_signature, expires_at`
+
+const auditColumns = `created_at, action, device_id, outcome, details`
+
+// SQLDeviceRepository stores the devices and their signature journal in a relational database through database/sql.
+// Public keys are stored as PEM, see encodeDeviceKeys.
+type SQLDeviceRepository struct {
+	db         *sql.DB
+	dialect    Dialect
+	algorithms *crypto.Registry
+}
+
+// NewSQLDeviceRepository creates a repository on the database, applying the pending schema migrations.
+// When no algorithm registry is provided the default one is used.
+func NewSQLDeviceRepository(db *sql.DB, dialect Dialect, algorithms *crypto.Registry) (*SQLDeviceRepository, error) {
+	if algorithms == nil {
+		algorithms = crypto.DefaultRegistry
+	}
+
+	r := &SQLDeviceRepository{
+		db:         db,
+		dialect:    dialect,
+		algorithms: algorithms,
+	}
+	if err := r.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate the database schema: %w", err)
+	}
+
+	return r, nil
+}
+
+// Apply the migrations that have not been recorded yet, each one in its own transaction
+func (r *SQLDeviceRepository) migrate() error {
+	_, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	for version, migration := range migrations {
+		err := r.inTx(func(tx *sql.Tx) error {
+			var applied int
+			err := tx.QueryRow(r.dialect.rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), version).Scan(&applied)
+			if err != nil || applied > 0 {
+				return err
+			}
+
+			statement := migration
+			if strings.Contains(migration, "%[") {
+				statement = fmt.Sprintf(migration, r.dialect.blobType, r.dialect.timestampType, r.dialect.serialType)
+			}
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+			_, err = tx.Exec(r.dialect.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// Create stores a new device, unless a device with its ID is already stored
+func (r *SQLDeviceRepository) Create(device model.Device) error {
+	values, err := r.deviceValues(device)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(r.dialect.rebind(`INSERT INTO devices (`+deviceColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING`), values...)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrDeviceExists
+	}
+
+	return nil
+}
+
+// UpdateKeyHandle replaces the key handle of a device, see DeviceRepository.UpdateKeyHandle.
+// Only the key handle column is written, so signatures committed concurrently by other instances are kept.
+func (r *SQLDeviceRepository) UpdateKeyHandle(id uuid.UUID, keyID string, keyHandle []byte) error {
+	if keyHandle == nil {
+		keyHandle = []byte{}
+	}
+
+	return r.inTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(r.dialect.rebind(`UPDATE devices SET key_handle = ? WHERE id = ? AND key_id = ?`),
+			keyHandle, id.String(), keyID)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated > 0 {
+			return nil
+		}
+
+		// Telling a missing device from a rotated key
+		device, err := r.scanDevice(tx.QueryRow(r.dialect.rebind(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`), id.String()))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDeviceNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return checkKeyID(*device, keyID)
+	})
+}
+
+// FindByID retrieves a device by its ID
+func (r *SQLDeviceRepository) FindByID(id uuid.UUID) (*model.Device, error) {
+	row := r.db.QueryRow(r.dialect.rebind(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`), id.String())
+
+	device, err := r.scanDevice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// GetAll retrieves all the devices
+func (r *SQLDeviceRepository) GetAll() ([]model.Device, error) {
+	rows, err := r.db.Query(`SELECT ` + deviceColumns + ` FROM devices ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []model.Device{}
+	for rows.Next() {
+		device, err := r.scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *device)
+	}
+
+	return devices, rows.Err()
+}
+
+// ReserveCounter reserves the next counter of a device for a signature, before it is signed, holding the lock of
+// the device row. The device must have the expected chain state of the reservation, otherwise a ConflictError is
+// returned, and its counter must not be reserved by another signer, otherwise an error matching ErrCounterReserved
+// is returned until that reservation expires.
+func (r *SQLDeviceRepository) ReserveCounter(reservation model.Reservation) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		state, err := r.lockDevice(tx, reservation.DeviceID)
+		if err != nil {
+			return err
+		}
+		held, reserved, err := r.reservation(tx, reservation.DeviceID)
+		if err != nil {
+			return err
+		}
+		if err := checkReservable(reservation, held, reserved); err != nil {
+			return err
+		}
+		if err := checkChainState(reservation.DeviceID, reservation.Expected, state); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(r.dialect.rebind(`DELETE FROM signature_reservations WHERE device_id = ?`), reservation.DeviceID.String()); err != nil {
+			return err
+		}
+		_, err = tx.Exec(r.dialect.rebind(`INSERT INTO signature_reservations (`+reservationColumns+`) VALUES (?, ?, ?, ?, ?)`),
+			reservation.DeviceID.String(), reservation.ID.String(), reservation.Expected.SignatureCounter,
+			reservation.Expected.LastSignature, reservation.Expires.UTC())
+		return err
+	})
+}
+
+// AfterSignUpdateDevice commits a reservation: it increments the signature counter, updates the last signature
+// and journals the signature in one transaction, holding the lock of the device row. The reservation must still be
+// held, otherwise an error matching ErrReservationLost is returned, and the record must continue its expected chain state.
+func (r *SQLDeviceRepository) AfterSignUpdateDevice(reservation model.Reservation, record model.SignatureRecord) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		if err := r.lockReservation(tx, reservation); err != nil {
+			return err
+		}
+		if err := checkSignRecord(reservation.DeviceID, reservation.Expected, record); err != nil {
+			return err
+		}
+
+		if err := r.insertSignature(tx, record); err != nil {
+			return err
+		}
+		_, err := tx.Exec(r.dialect.rebind(`UPDATE devices SET signature_counter = signature_counter + 1, last_signature = ? WHERE id = ?`),
+			base64.StdEncoding.EncodeToString(record.Signature), reservation.DeviceID.String())
+		if err != nil {
+			return err
+		}
+		return r.deleteReservation(tx, reservation)
+	})
+}
+
+// AfterRotateUpdateDevice commits a reservation: it stores the rotated device and journals the signature of its
+// rotation event in one transaction, holding the lock of the device row. The reservation must still be held,
+// otherwise an error matching ErrReservationLost is returned, and the record must continue its expected chain state.
+// The rotated device continues the chain after the record.
+func (r *SQLDeviceRepository) AfterRotateUpdateDevice(reservation model.Reservation, device model.Device, record model.SignatureRecord) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		if err := r.lockReservation(tx, reservation); err != nil {
+			return err
+		}
+		if device.ID != reservation.DeviceID {
+			return fmt.Errorf("reservation of device %s cannot rotate device %s", reservation.DeviceID, device.ID)
+		}
+		if err := checkRotateRecord(device, reservation.Expected, record); err != nil {
+			return err
+		}
+
+		if err := r.insertSignature(tx, record); err != nil {
+			return err
+		}
+		if err := r.update(tx, device); err != nil {
+			return err
+		}
+		return r.deleteReservation(tx, reservation)
+	})
+}
+
+// ReleaseReservation gives up a reservation without consuming its counter, e.g. because signing failed.
+// A reservation that is no longer held is ignored.
+func (r *SQLDeviceRepository) ReleaseReservation(reservation model.Reservation) error {
+	return r.inTx(func(tx *sql.Tx) error {
+		return r.deleteReservation(tx, reservation)
+	})
+}
+
+// RecoverReservations releases the reservations that expired at the given time without being committed or released,
+// e.g. because the instance holding them crashed, and returns them. As a reservation is committed in the same
+// transaction as its signature, their counters were not consumed.
+func (r *SQLDeviceRepository) RecoverReservations(now time.Time) ([]model.Reservation, error) {
+	var recovered []model.Reservation
+	err := r.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(r.dialect.rebind(`SELECT `+reservationColumns+` FROM signature_reservations WHERE expires_at <= ?`), now.UTC())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			reservation, err := scanReservation(rows)
+			if err != nil {
+				return err
+			}
+			recovered = append(recovered, *reservation)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, reservation := range recovered {
+			if err := r.deleteReservation(tx, reservation); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recovered, nil
+}
+
+// GetSignatures retrieves a page of the journaled signatures of a device in the order they were issued,
+// together with their total number. A limit of 0 returns all the signatures from the offset.
+func (r *SQLDeviceRepository) GetSignatures(id uuid.UUID, offset, limit int) ([]model.SignatureRecord, int, error) {
+	var records []model.SignatureRecord
+	var total int
+	err := r.inTx(func(tx *sql.Tx) error {
+		if _, err := r.deviceChainState(tx, id, ""); err != nil {
+			return err
+		}
+		err := tx.QueryRow(r.dialect.rebind(`SELECT COUNT(*) FROM signatures WHERE device_id = ?`), id.String()).Scan(&total)
+		if err != nil {
+			return err
+		}
+
+		query := `SELECT ` + signatureColumns + ` FROM signatures WHERE device_id = ? ORDER BY counter`
+		args := []any{id.String()}
+		if limit > 0 {
+			query += ` LIMIT ? OFFSET ?`
+			args = append(args, limit, max(offset, 0))
+		} else if offset > 0 {
+			// Every total fits in the limit, as neither database accepts an offset without one
+			query += ` LIMIT ? OFFSET ?`
+			args = append(args, total, offset)
+		}
+		rows, err := tx.Query(r.dialect.rebind(query), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		records = []model.SignatureRecord{}
+		for rows.Next() {
+			record, err := scanSignature(rows)
+			if err != nil {
+				return err
+			}
+			records = append(records, *record)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
+// GetSignature retrieves the journaled signature of a device with the given counter
+func (r *SQLDeviceRepository) GetSignature(id uuid.UUID, counter int) (*model.SignatureRecord, error) {
+	var record *model.SignatureRecord
+	err := r.inTx(func(tx *sql.Tx) error {
+		if _, err := r.deviceChainState(tx, id, ""); err != nil {
+			return err
+		}
+
+		row := tx.QueryRow(r.dialect.rebind(`SELECT `+signatureColumns+` FROM signatures WHERE device_id = ? AND counter = ?`), id.String(), counter)
+		var err error
+		record, err = scanSignature(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSignatureNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// FindSignatureByIdempotencyKey retrieves the last signature of a device journaled with the idempotency key
+// since the given time
+func (r *SQLDeviceRepository) FindSignatureByIdempotencyKey(id uuid.UUID, key string, since time.Time) (*model.SignatureRecord, error) {
+	var record *model.SignatureRecord
+	err := r.inTx(func(tx *sql.Tx) error {
+		if _, err := r.deviceChainState(tx, id, ""); err != nil {
+			return err
+		}
+
+		row := tx.QueryRow(r.dialect.rebind(`SELECT `+signatureColumns+` FROM signatures
+			WHERE device_id = ? AND idempotency_key = ? AND created_at >= ? ORDER BY counter DESC LIMIT 1`),
+			id.String(), key, since.UTC())
+		var err error
+		record, err = scanSignature(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSignatureNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Run a function in a transaction, committing it when the function succeeds and rolling it back otherwise
+func (r *SQLDeviceRepository) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	// Rolling back after the commit is a no-op, and the error of fn is more relevant than the one of the rollback
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Lock the row of a device until the end of the transaction and return its chain state
+func (r *SQLDeviceRepository) lockDevice(tx *sql.Tx, id uuid.UUID) (model.ChainState, error) {
+	return r.deviceChainState(tx, id, r.dialect.lockRow)
+}
+
+// Read the chain state of a device, failing when the device does not exist
+func (r *SQLDeviceRepository) deviceChainState(tx *sql.Tx, id uuid.UUID, lock string) (model.ChainState, error) {
+	var state model.ChainState
+	err := tx.QueryRow(r.dialect.rebind(`SELECT signature_counter, last_signature FROM devices WHERE id = ?`+lock), id.String()).
+		Scan(&state.SignatureCounter, &state.LastSignature)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ChainState{}, ErrDeviceNotFound
+	}
+
+	return state, err
+}
+
+// Read the reservation of a device, if any
+func (r *SQLDeviceRepository) reservation(tx *sql.Tx, id uuid.UUID) (model.Reservation, bool, error) {
+	reservation, err := scanReservation(tx.QueryRow(r.dialect.rebind(`SELECT `+reservationColumns+` FROM signature_reservations WHERE device_id = ?`), id.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Reservation{}, false, nil
+	}
+	if err != nil {
+		return model.Reservation{}, false, err
+	}
+
+	return *reservation, true, nil
+}
+
+// Lock the row of the device of a reservation until the end of the transaction, checking that the reservation
+// is still held and the device still has its expected chain state
+func (r *SQLDeviceRepository) lockReservation(tx *sql.Tx, reservation model.Reservation) error {
+	state, err := r.lockDevice(tx, reservation.DeviceID)
+	if err != nil {
+		return err
+	}
+	held, reserved, err := r.reservation(tx, reservation.DeviceID)
+	if err != nil {
+		return err
+	}
+	if err := checkReservationHeld(reservation, held, reserved); err != nil {
+		return err
+	}
+
+	return checkChainState(reservation.DeviceID, reservation.Expected, state)
+}
+
+// Delete a reservation, unless the device has another one
+func (r *SQLDeviceRepository) deleteReservation(tx *sql.Tx, reservation model.Reservation) error {
+	_, err := tx.Exec(r.dialect.rebind(`DELETE FROM signature_reservations WHERE device_id = ? AND id = ?`),
+		reservation.DeviceID.String(), reservation.ID.String())
+	return err
+}
+
+// Replace every column of a stored device
+func (r *SQLDeviceRepository) update(tx *sql.Tx, device model.Device) error {
+	values, err := r.deviceValues(device)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(r.dialect.rebind(`UPDATE devices SET algorithm = ?, label = ?, key_size = ?, curve = ?, digest = ?,
+		padding = ?, salt_length = ?, encoding = ?, deterministic = ?, key_id = ?, public_key = ?, key_handle = ?,
+		previous_keys = ?, signature_counter = ?, last_signature = ?, imported_chain = ?, secured_data_format = ? WHERE id = ?`),
+		append(values[1:], values[0])...)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// Journal a signature
+func (r *SQLDeviceRepository) insertSignature(tx *sql.Tx, record model.SignatureRecord) error {
+	_, err := tx.Exec(r.dialect.rebind(`INSERT INTO signatures (`+signatureColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		record.DeviceID.String(), record.Counter, record.Data, record.SignedData, record.Signature,
+		record.Algorithm, record.KeyID, record.Time.UTC(), record.IdempotencyKey)
+	if err != nil {
+		return fmt.Errorf("failed to journal signature %d of device %s: %w", record.Counter, record.DeviceID, err)
+	}
+
+	return nil
+}
+
+// Convert a device to the values of the device columns, in their order
+func (r *SQLDeviceRepository) deviceValues(device model.Device) ([]any, error) {
+	publicKey, previousKeys, err := encodeDeviceKeys(r.algorithms, device)
+	if err != nil {
+		return nil, err
+	}
+	previousKeysJSON, err := json.Marshal(previousKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	var importedChain sql.NullString
+	if device.ImportedChain != nil {
+		importedChainJSON, err := json.Marshal(device.ImportedChain)
+		if err != nil {
+			return nil, err
+		}
+		importedChain = sql.NullString{String: string(importedChainJSON), Valid: true}
+	}
+
+	keyHandle := device.KeyHandle
+	if keyHandle == nil {
+		keyHandle = []byte{}
+	}
+
+	return []any{
+		device.ID.String(), device.Algorithm, device.Label, device.KeySize, device.Curve, device.Digest,
+		device.Padding, device.SaltLength, device.Encoding, device.Deterministic, device.KeyID, publicKey,
+		keyHandle, string(previousKeysJSON), device.SignatureCounter, device.LastSignature, importedChain,
+		device.SecuredDataFormat,
+	}, nil
+}
+
+// Scan the device columns of a row
+func (r *SQLDeviceRepository) scanDevice(row interface{ Scan(dest ...any) error }) (*model.Device, error) {
+	var (
+		device        model.Device
+		id            string
+		publicKey     string
+		previousKeys  string
+		importedChain sql.NullString
+	)
+	err := row.Scan(&id, &device.Algorithm, &device.Label, &device.KeySize, &device.Curve, &device.Digest,
+		&device.Padding, &device.SaltLength, &device.Encoding, &device.Deterministic, &device.KeyID, &publicKey,
+		&device.KeyHandle, &previousKeys, &device.SignatureCounter, &device.LastSignature, &importedChain,
+		&device.SecuredDataFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	device.ID, err = uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored device ID %q: %w", id, err)
+	}
+
+	var storedKeys []storedDeviceKey
+	if err := json.Unmarshal([]byte(previousKeys), &storedKeys); err != nil {
+		return nil, fmt.Errorf("failed to decode previous keys of device %s: %w", device.ID, err)
+	}
+	if err := decodeDeviceKeys(r.algorithms, &device, publicKey, storedKeys); err != nil {
+		return nil, err
+	}
+
+	if importedChain.Valid {
+		device.ImportedChain = &model.ChainState{}
+		if err := json.Unmarshal([]byte(importedChain.String), device.ImportedChain); err != nil {
+			return nil, fmt.Errorf("failed to decode imported chain of device %s: %w", device.ID, err)
+		}
+	}
+
+	return &device, nil
+}
+
+// Scan the signature columns of a row
+func scanSignature(row interface{ Scan(dest ...any) error }) (*model.SignatureRecord, error) {
+	var (
+		record   model.SignatureRecord
+		deviceID string
+	)
+	err := row.Scan(&deviceID, &record.Counter, &record.Data, &record.SignedData, &record.Signature,
+		&record.Algorithm, &record.KeyID, &record.Time, &record.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	record.DeviceID, err = uuid.Parse(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored device ID %q: %w", deviceID, err)
+	}
+	record.Time = record.Time.UTC()
+
+	return &record, nil
+}
+
+// Scan a row of the reservation columns
+func scanReservation(row interface{ Scan(dest ...any) error }) (*model.Reservation, error) {
+	var (
+		reservation  model.Reservation
+		deviceID, id string
+	)
+	err := row.Scan(&deviceID, &id, &reservation.Expected.SignatureCounter, &reservation.Expected.LastSignature, &reservation.Expires)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation.DeviceID, err = uuid.Parse(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored device ID %q: %w", deviceID, err)
+	}
+	reservation.ID, err = uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored reservation ID %q: %w", id, err)
+	}
+	reservation.Expires = reservation.Expires.UTC()
+
+	return &reservation, nil
+}
+
+// SQLAuditRepository keeps the audit log in the database of a SQLDeviceRepository, which migrates its schema
+type SQLAuditRepository struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewSQLAuditRepository creates an audit log stored in the database of the device repository
+func NewSQLAuditRepository(devices *SQLDeviceRepository) *SQLAuditRepository {
+	return &SQLAuditRepository{db: devices.db, dialect: devices.dialect}
+}
+
+// Append adds an entry at the end of the audit log
+func (r *SQLAuditRepository) Append(entry model.AuditEntry) error {
+	_, err := r.db.Exec(r.dialect.rebind(`INSERT INTO audit_entries (`+auditColumns+`) VALUES (?, ?, ?, ?, ?)`),
+		entry.Time.UTC(), entry.Action, entry.DeviceID.String(), entry.Outcome, entry.Details)
+	if err != nil {
+		return fmt.Errorf("failed to append the %s audit entry of device %s: %w", entry.Action, entry.DeviceID, err)
+	}
+
+	return nil
+}
+
+// GetAll retrieves all the audit entries in the order they were appended
+func (r *SQLAuditRepository) GetAll() ([]model.AuditEntry, error) {
+	rows, err := r.db.Query(`SELECT ` + auditColumns + ` FROM audit_entries ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var (
+			entry    model.AuditEntry
+			deviceID string
+		)
+		if err := rows.Scan(&entry.Time, &entry.Action, &deviceID, &entry.Outcome, &entry.Details); err != nil {
+			return nil, err
+		}
+		entry.DeviceID, err = uuid.Parse(deviceID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored device ID %q: %w", deviceID, err)
+		}
+		entry.Time = entry.Time.UTC()
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,311 @@
+package persistence
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/google/uuid"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SQLDeviceRepo", func() {
+	var (
+		db         *sql.DB
+		deviceRepo *SQLDeviceRepository
+		device     model.Device
+	)
+
+	// Create a device with a fresh ECC key
+	newDevice := func() model.Device {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).To(BeNil(), "Failed to generate key")
+
+		return model.Device{
+			ID:        uuid.New(),
+			Algorithm: crypto.AlgorithmECC,
+			Label:     "Test device",
+			KeySize:   256,
+			Curve:     "P-256",
+			Digest:    crypto.DigestSHA256,
+			Encoding:  crypto.EncodingASN1,
+			KeyID:     "key-1",
+			PublicKey: &privateKey.PublicKey,
+			KeyHandle: []byte("key-handle"),
+		}
+	}
+
+	// Reserve the next counter of the device and journal its signature
+	sign := func(id uuid.UUID, counter int) error {
+		reservation := NewReservation(id, chainStateBefore(counter), time.Minute)
+		if err := deviceRepo.ReserveCounter(reservation); err != nil {
+			return err
+		}
+		return deviceRepo.AfterSignUpdateDevice(reservation, model.SignatureRecord{
+			DeviceID:   id,
+			Counter:    counter,
+			Data:       fmt.Sprintf("data-%d", counter),
+			SignedData: fmt.Sprintf("%d_data-%d_last", counter, counter),
+			Signature:  fmt.Appendf(nil, "signature-%d", counter),
+			Algorithm:  crypto.AlgorithmECC,
+			KeyID:      "key-1",
+			Time:       time.Now(),
+		})
+	}
+
+	BeforeEach(func() {
+		var dialect Dialect
+		var err error
+		db, dialect, err = OpenDatabase("sqlite", "file:"+filepath.Join(GinkgoT().TempDir(), "devices.db"))
+		Expect(err).To(BeNil(), "Failed to open the database")
+		DeferCleanup(db.Close)
+
+		deviceRepo, err = NewSQLDeviceRepository(db, dialect, nil)
+		Expect(err).To(BeNil(), "Failed to create the repository")
+
+		device = newDevice()
+		Expect(deviceRepo.Create(device)).To(Succeed(), "Failed to create device")
+	})
+
+	It("should apply each migration once", func() {
+		_, err := NewSQLDeviceRepository(db, DialectSQLite, nil)
+		Expect(err).To(BeNil(), "Migrating an up to date database should succeed")
+
+		var versions int
+		Expect(db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&versions)).To(Succeed(), "Failed to count migrations")
+		Expect(versions).To(Equal(len(migrations)), "Every migration should be recorded once")
+	})
+
+	Describe("FindByID", func() {
+		It("should restore the stored device with its keys", func() {
+			device = newDevice()
+			previousKey := newDevice().PublicKey
+			device.PreviousKeys = []model.DeviceKey{
+				{ID: "key-0", PublicKey: previousKey, FirstCounter: 0, LastCounter: 4},
+				{ID: "key-1", PublicKey: device.PublicKey, FirstCounter: 5, LastCounter: -1, Active: true},
+			}
+			device.ImportedChain = &model.ChainState{SignatureCounter: 5, LastSignature: "last"}
+			device.SignatureCounter = 5
+			device.LastSignature = "last"
+			Expect(deviceRepo.Create(device)).To(Succeed(), "Failed to create device")
+
+			found, err := deviceRepo.FindByID(device.ID)
+			Expect(err).To(BeNil(), "Failed to find device")
+			Expect(*found).To(Equal(device), "The stored device should be restored as it was")
+		})
+
+		It("should return an error for a non-existent device", func() {
+			_, err := deviceRepo.FindByID(uuid.New())
+			Expect(err).To(MatchError(ErrDeviceNotFound), "Expected device not found error")
+		})
+	})
+
+	Describe("GetAll", func() {
+		It("should return all the devices", func() {
+			Expect(deviceRepo.Create(newDevice())).To(Succeed(), "Failed to create device")
+
+			devices, err := deviceRepo.GetAll()
+			Expect(err).To(BeNil(), "Failed to get devices")
+			Expect(devices).To(HaveLen(2), "Expected both devices")
+		})
+	})
+
+	Describe("UpdateKeyHandle", func() {
+		It("should return an error for a non-existent device", func() {
+			err := deviceRepo.UpdateKeyHandle(uuid.New(), "key-1", []byte("rewrapped"))
+			Expect(err).To(MatchError(ErrDeviceNotFound), "Expected device not found error")
+		})
+	})
+
+	Describe("AfterSignUpdateDevice", func() {
+		It("should increment the counter and journal the signature", func() {
+			Expect(sign(device.ID, 0)).To(Succeed(), "Failed to journal signature")
+
+			found, err := deviceRepo.FindByID(device.ID)
+			Expect(err).To(BeNil(), "Failed to find device")
+			Expect(found.SignatureCounter).To(Equal(1), "The counter should be incremented")
+			Expect(found.LastSignature).To(Equal(base64.StdEncoding.EncodeToString([]byte("signature-0"))), "The last signature should be updated")
+
+			record, err := deviceRepo.GetSignature(device.ID, 0)
+			Expect(err).To(BeNil(), "Failed to get signature")
+			Expect(record.SignedData).To(Equal("0_data-0_last"), "The signed data should be journaled")
+			Expect(record.Signature).To(Equal([]byte("signature-0")), "The signature should be journaled")
+		})
+
+		It("should reject a record that does not continue the chain", func() {
+			Expect(sign(device.ID, 1)).NotTo(Succeed(), "The record should have the current counter")
+
+			_, total, err := deviceRepo.GetSignatures(device.ID, 0, 0)
+			Expect(err).To(BeNil(), "Failed to get signatures")
+			Expect(total).To(Equal(0), "Nothing should be journaled")
+		})
+
+		It("should return an error for a non-existent device", func() {
+			Expect(sign(uuid.New(), 0)).To(MatchError(ErrDeviceNotFound), "Expected device not found error")
+		})
+
+		It("should serialize concurrent increments", func() {
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					// Retry with the stored counter until the record continues the chain
+					for {
+						found, err := deviceRepo.FindByID(device.ID)
+						Expect(err).To(BeNil(), "Failed to find device")
+						if sign(device.ID, found.SignatureCounter) == nil {
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			records, total, err := deviceRepo.GetSignatures(device.ID, 0, 0)
+			Expect(err).To(BeNil(), "Failed to get signatures")
+			Expect(total).To(Equal(10), "Every increment should be journaled")
+			for i, record := range records {
+				Expect(record.Counter).To(Equal(i), "The counters should have no gaps")
+			}
+		})
+	})
+
+	Describe("ReserveCounter", func() {
+		It("should share the reservations with the other instances using the database", func() {
+			other, err := NewSQLDeviceRepository(db, DialectSQLite, nil)
+			Expect(err).To(BeNil(), "Failed to create the repository")
+			reservation := reserve(deviceRepo, device.ID, model.ChainState{})
+
+			Expect(other.ReserveCounter(NewReservation(device.ID, model.ChainState{}, time.Minute))).To(MatchError(ErrCounterReserved), "The counter should be reserved for every instance")
+			Expect(other.ReleaseReservation(reservation)).To(Succeed(), "Failed to release the reservation")
+			reserve(other, device.ID, model.ChainState{})
+		})
+
+		It("should recover the reservations left by a crashed instance once they expired", func() {
+			crashed := NewReservation(device.ID, model.ChainState{}, time.Second)
+			Expect(deviceRepo.ReserveCounter(crashed)).To(Succeed(), "Failed to reserve counter")
+
+			restarted, err := NewSQLDeviceRepository(db, DialectSQLite, nil)
+			Expect(err).To(BeNil(), "Failed to create the repository")
+			recovered, err := restarted.RecoverReservations(time.Now())
+			Expect(err).To(BeNil(), "Failed to recover reservations")
+			Expect(recovered).To(BeEmpty(), "A reservation should not be recovered before it expired")
+
+			recovered, err = restarted.RecoverReservations(time.Now().Add(time.Minute))
+			Expect(err).To(BeNil(), "Failed to recover reservations")
+			Expect(recovered).To(HaveLen(1), "The expired reservation should be recovered")
+			Expect(recovered[0].ID).To(Equal(crashed.ID), "Expected the reservation of the crashed instance")
+			Expect(sign(device.ID, 0)).To(Succeed(), "The recovered counter should be signed")
+		})
+	})
+
+	Describe("AfterRotateUpdateDevice", func() {
+		It("should store the rotated device with the rotation record", func() {
+			rotated := device
+			rotated.KeyID = "key-2"
+			rotated.SignatureCounter = 1
+			record := model.SignatureRecord{DeviceID: device.ID, Counter: 0, Signature: []byte("rotation"), Time: time.Now()}
+			reservation := reserve(deviceRepo, device.ID, model.ChainState{})
+			Expect(deviceRepo.AfterRotateUpdateDevice(reservation, rotated, record)).To(Succeed(), "Failed to store the rotation")
+
+			found, err := deviceRepo.FindByID(device.ID)
+			Expect(err).To(BeNil(), "Failed to find device")
+			Expect(found.KeyID).To(Equal("key-2"), "The rotated device should be stored")
+			_, err = deviceRepo.GetSignature(device.ID, 0)
+			Expect(err).To(BeNil(), "The rotation should be journaled")
+		})
+
+		It("should reject a rotation from a stale counter", func() {
+			Expect(sign(device.ID, 0)).To(Succeed(), "Failed to journal signature")
+
+			rotated := device
+			rotated.SignatureCounter = 1
+			record := model.SignatureRecord{DeviceID: device.ID, Counter: 0, Time: time.Now()}
+			stale := NewReservation(device.ID, model.ChainState{}, time.Minute)
+			Expect(deviceRepo.AfterRotateUpdateDevice(stale, rotated, record)).To(MatchError(ErrConflict), "The device should have the expected state")
+		})
+	})
+
+	Describe("GetSignatures", func() {
+		BeforeEach(func() {
+			for counter := range 5 {
+				Expect(sign(device.ID, counter)).To(Succeed(), "Failed to journal signature %d", counter)
+			}
+		})
+
+		It("should return a page of the signatures in order", func() {
+			records, total, err := deviceRepo.GetSignatures(device.ID, 1, 2)
+			Expect(err).To(BeNil(), "Failed to get signatures")
+			Expect(total).To(Equal(5), "The total should count every signature")
+			Expect(records).To(HaveLen(2), "The page should be limited")
+			Expect(records[0].Counter).To(Equal(1), "The page should start at the offset")
+			Expect(records[1].Counter).To(Equal(2), "The signatures should be in order")
+		})
+
+		It("should return every signature from the offset without limit", func() {
+			records, _, err := deviceRepo.GetSignatures(device.ID, 3, 0)
+			Expect(err).To(BeNil(), "Failed to get signatures")
+			Expect(records).To(HaveLen(2), "The remaining signatures should be returned")
+		})
+
+		It("should return an error for a non-existent device", func() {
+			_, _, err := deviceRepo.GetSignatures(uuid.New(), 0, 0)
+			Expect(err).To(MatchError(ErrDeviceNotFound), "Expected device not found error")
+		})
+	})
+
+	Describe("GetSignature", func() {
+		It("should return an error for a non-existent signature", func() {
+			_, err := deviceRepo.GetSignature(device.ID, 0)
+			Expect(err).To(MatchError(ErrSignatureNotFound), "Expected signature not found error")
+		})
+	})
+
+	Describe("SQLAuditRepository", func() {
+		It("should keep the entries in order in the database", func() {
+			first := model.AuditEntry{Time: time.Now().UTC().Truncate(time.Second), Action: "key-export", DeviceID: uuid.New(), Outcome: "denied", Details: "key export is disabled"}
+			second := model.AuditEntry{Time: time.Now().UTC().Truncate(time.Second), Action: "key-export", DeviceID: device.ID, Outcome: "exported"}
+			auditRepo := NewSQLAuditRepository(deviceRepo)
+			Expect(auditRepo.Append(first)).To(Succeed(), "Failed to append the first entry")
+			Expect(auditRepo.Append(second)).To(Succeed(), "Failed to append the second entry")
+
+			reopened, err := NewSQLDeviceRepository(db, DialectSQLite, nil)
+			Expect(err).To(BeNil(), "Failed to reopen the repository")
+			entries, err := NewSQLAuditRepository(reopened).GetAll()
+			Expect(err).To(BeNil(), "Failed to retrieve the audit log")
+			Expect(entries).To(Equal([]model.AuditEntry{first, second}), "The stored entries should be returned in the order they were appended")
+		})
+	})
+})
+
+// Reserve the next counter of a device from the expected chain state for a minute, failing the spec when it cannot
+func reserve(repo DeviceRepoInterface, id uuid.UUID, expected model.ChainState) model.Reservation {
+	reservation := NewReservation(id, expected, time.Minute)
+	Expect(repo.ReserveCounter(reservation)).To(Succeed(), "Failed to reserve counter %d", expected.SignatureCounter)
+	return reservation
+}
+
+// Get the chain state of a device before the signature with the counter, when its previous signatures
+// are "signature-<counter>"
+func chainStateBefore(counter int) model.ChainState {
+	if counter == 0 {
+		return model.ChainState{}
+	}
+
+	return model.ChainState{
+		SignatureCounter: counter,
+		LastSignature:    base64.StdEncoding.EncodeToString(fmt.Appendf(nil, "signature-%d", counter-1)),
+	}
+}
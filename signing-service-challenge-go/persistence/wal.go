@@ -0,0 +1,602 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/google/uuid"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	// DefaultSnapshotInterval is the number of log entries after which the log is compacted into a snapshot
+	DefaultSnapshotInterval = 1000
+
+	// Every log entry starts with a header made of the length of its payload, its sequence number, the CRC-32C
+	// of both, and the CRC-32C of its payload. The length has its own checksum so a corrupt length is detected
+	// before it is used to find the end of the entry.
+	walHeaderSize = 4 + 8 + 4 + 4
+)
+
+// ErrCorruptLog is returned when a log entry that is not the last one fails its checksum, or when the log
+// cannot be replayed. Unlike a torn write at the end of the log, it means acknowledged changes were lost.
+var ErrCorruptLog = errors.New("corrupt write-ahead log")
+
+var walChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Operations recorded in the write-ahead log
+const (
+	walCreate    = "create"
+	walUpdateKey = "updateKey"
+	walSign      = "sign"
+	walRotate    = "rotate"
+	walAudit     = "audit"
+)
+
+// walEntry is a change of the repository recorded in the write-ahead log
+type walEntry struct {
+	Op       string                 `json:"op"`
+	Device   *storedDevice          `json:"device,omitempty"`
+	Expected *model.ChainState      `json:"expected,omitempty"` // chain state the device had before a sign or rotate change
+	Record   *model.SignatureRecord `json:"record,omitempty"`
+	Key      *walKeyUpdate          `json:"key,omitempty"`
+	Audit    *model.AuditEntry      `json:"audit,omitempty"`
+}
+
+// walKeyUpdate is the new key handle of the active key of a device
+type walKeyUpdate struct {
+	DeviceID  uuid.UUID `json:"deviceId"`
+	KeyID     string    `json:"keyId"`
+	KeyHandle []byte    `json:"keyHandle"`
+}
+
+// storedDevice is a device as it is written to the log and snapshots, with PEM public keys
+type storedDevice struct {
+	model.Device
+	PublicKey    string            `json:"publicKey"`
+	PreviousKeys []storedDeviceKey `json:"previousKeys,omitempty"`
+}
+
+// walSnapshot is the state of the repository after the log entry with sequence number Seq
+type walSnapshot struct {
+	Seq        uint64                                `json:"seq"`
+	Devices    []storedDevice                        `json:"devices"`
+	Signatures map[uuid.UUID][]model.SignatureRecord `json:"signatures"`
+	Audit      []model.AuditEntry                    `json:"audit,omitempty"`
+}
+
+// FileDeviceRepository keeps the devices, their signature journal and the audit log in memory and makes every change durable
+// in a directory, for single-node deployments without a database server. Changes are appended to a checksummed
+// write-ahead log and synced before they are acknowledged, and the log is regularly compacted into a snapshot.
+// On start the snapshot is loaded and the log replayed, discarding an incomplete last entry left by a crash.
+type FileDeviceRepository struct {
+	*DeviceRepository
+	dir              string
+	algorithms       *crypto.Registry
+	snapshotInterval int
+	log              *os.File
+	seq              uint64 // sequence number of the last entry
+	entries          int    // entries in the log since the last snapshot
+	audit            []model.AuditEntry
+	err              error // set when the log could not be written or was closed, failing every following change
+	closed           bool
+	mu               sync.Mutex
+}
+
+// NewFileDeviceRepository opens the repository stored in the directory, creating it when needed.
+// When no algorithm registry is provided the default one is used, and a snapshot interval of 0 means
+// DefaultSnapshotInterval.
+func NewFileDeviceRepository(dir string, algorithms *crypto.Registry, snapshotInterval int) (*FileDeviceRepository, error) {
+	if algorithms == nil {
+		algorithms = crypto.DefaultRegistry
+	}
+	if snapshotInterval <= 0 {
+		snapshotInterval = DefaultSnapshotInterval
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	r := &FileDeviceRepository{
+		DeviceRepository: NewDeviceRepository(),
+		dir:              dir,
+		algorithms:       algorithms,
+		snapshotInterval: snapshotInterval,
+	}
+	if err := r.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	r.log = logFile
+	if err := r.replay(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close closes the log, failing every following change. Every acknowledged change is already durable.
+func (r *FileDeviceRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.err == nil {
+		r.err = errors.New("repository is closed")
+	}
+
+	return r.log.Close()
+}
+
+// Create stores a new device, unless a device with its ID is already stored
+func (r *FileDeviceRepository) Create(device model.Device) error {
+	return r.write(walCreate, &device, nil, nil, nil)
+}
+
+// UpdateKeyHandle replaces the key handle of a device, see DeviceRepository.UpdateKeyHandle
+func (r *FileDeviceRepository) UpdateKeyHandle(id uuid.UUID, keyID string, keyHandle []byte) error {
+	return r.write(walUpdateKey, nil, nil, nil, &walKeyUpdate{DeviceID: id, KeyID: keyID, KeyHandle: keyHandle})
+}
+
+// ReserveCounter reserves the next counter of a device for a signature, see DeviceRepository.ReserveCounter.
+// Reservations are not logged, as the directory belongs to a single process: the reservations that were
+// neither committed nor released when it stopped are lost, and their counters were not consumed.
+func (r *FileDeviceRepository) ReserveCounter(reservation model.Reservation) error {
+	// Serialized with the logged changes, so a reservation is not taken over while its commit is logged
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.DeviceRepository.ReserveCounter(reservation)
+}
+
+// AfterSignUpdateDevice commits a reservation: it increments the signature counter, updates the last signature
+// and journals the signature, returning once the change is durable. The reservation must still be held, otherwise
+// an error matching ErrReservationLost is returned, and the record must continue its expected chain state.
+func (r *FileDeviceRepository) AfterSignUpdateDevice(reservation model.Reservation, record model.SignatureRecord) error {
+	if err := checkSignRecord(reservation.DeviceID, reservation.Expected, record); err != nil {
+		return err
+	}
+
+	return r.write(walSign, nil, &reservation, &record, nil)
+}
+
+// AfterRotateUpdateDevice commits a reservation: it stores the rotated device and journals the signature of its
+// rotation event, returning once the change is durable. The reservation must still be held, otherwise an error
+// matching ErrReservationLost is returned, and the record must continue its expected chain state.
+// The rotated device continues the chain after the record.
+func (r *FileDeviceRepository) AfterRotateUpdateDevice(reservation model.Reservation, device model.Device, record model.SignatureRecord) error {
+	if device.ID != reservation.DeviceID {
+		return fmt.Errorf("reservation of device %s cannot rotate device %s", reservation.DeviceID, device.ID)
+	}
+	if err := checkRotateRecord(device, reservation.Expected, record); err != nil {
+		return err
+	}
+
+	return r.write(walRotate, &device, &reservation, &record, nil)
+}
+
+// Append an audit entry to the log, returning once it is durable
+func (r *FileDeviceRepository) appendAudit(entry model.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.commit(walEntry{Op: walAudit, Audit: &entry}, func() error {
+		r.audit = append(r.audit, entry)
+		return nil
+	})
+}
+
+// Get a copy of the audit entries
+func (r *FileDeviceRepository) auditEntries() []model.AuditEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.audit)
+}
+
+// Compact writes the state of the repository to a new snapshot and empties the log
+func (r *FileDeviceRepository) Compact() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.compact()
+}
+
+// Log a change and apply it in memory. The change is checked against the state in memory before it is
+// logged, which holds as long as the changes are serialized by the lock. Changes are only applied once
+// the log is synced, so they are never visible before they are durable.
+func (r *FileDeviceRepository) write(op string, device *model.Device, reservation *model.Reservation, record *model.SignatureRecord, key *walKeyUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.check(op, device, reservation, key); err != nil {
+		return err
+	}
+
+	var expected *model.ChainState
+	if reservation != nil {
+		expected = &reservation.Expected
+	}
+	entry := walEntry{Op: op, Expected: expected, Record: record, Key: key}
+	if device != nil {
+		stored, err := r.storeDevice(*device)
+		if err != nil {
+			return err
+		}
+		entry.Device = &stored
+	}
+
+	return r.commit(entry, func() error {
+		return r.applyChange(op, device, expected, record, key)
+	})
+}
+
+// Log an entry, then apply it in memory with the function and compact the log when it is due.
+// It must be called with the lock held.
+func (r *FileDeviceRepository) commit(entry walEntry, apply func() error) error {
+	if err := r.append(entry); err != nil {
+		// The log may end with part of the entry, so nothing can be appended after it until it is replayed
+		r.err = fmt.Errorf("write-ahead log failed, the repository must be reopened: %w", err)
+		return r.err
+	}
+	if err := apply(); err != nil {
+		r.err = fmt.Errorf("logged change could not be applied, the repository must be reopened: %w", err)
+		return r.err
+	}
+
+	r.entries++
+	if r.entries >= r.snapshotInterval {
+		// The change is durable, a failed compaction is retried after the next change
+		if err := r.compact(); err != nil {
+			log.Printf("Failed to compact the write-ahead log in %s: %v", r.dir, err)
+		}
+	}
+
+	return nil
+}
+
+// Check that a change can be applied to the state in memory, without applying it. Signatures and rotations
+// commit the reservation, which must still be held.
+func (r *FileDeviceRepository) check(op string, device *model.Device, reservation *model.Reservation, key *walKeyUpdate) error {
+	switch op {
+	case walCreate:
+		if _, err := r.FindByID(device.ID); err == nil {
+			return ErrDeviceExists
+		}
+	case walUpdateKey:
+		stored, err := r.FindByID(key.DeviceID)
+		if err != nil {
+			return err
+		}
+		return checkKeyID(*stored, key.KeyID)
+	case walSign, walRotate:
+		r.DeviceRepository.mu.RLock()
+		defer r.DeviceRepository.mu.RUnlock()
+
+		if err := r.checkCommit(*reservation); err != nil {
+			return err
+		}
+		stored := r.data[reservation.DeviceID]
+		return checkChainState(stored.ID, reservation.Expected, deviceChainState(stored))
+	}
+
+	return nil
+}
+
+// Apply a change in memory. The reservations were checked before the change was logged, and are not replayed.
+func (r *FileDeviceRepository) applyChange(op string, device *model.Device, expected *model.ChainState, record *model.SignatureRecord, key *walKeyUpdate) error {
+	switch {
+	case op == walCreate && device != nil:
+		return r.DeviceRepository.Create(*device)
+	case op == walUpdateKey && key != nil:
+		return r.DeviceRepository.UpdateKeyHandle(key.DeviceID, key.KeyID, key.KeyHandle)
+	case op == walSign && expected != nil && record != nil:
+		r.DeviceRepository.mu.Lock()
+		defer r.DeviceRepository.mu.Unlock()
+		return r.journalSignature(*expected, *record)
+	case op == walRotate && device != nil && expected != nil && record != nil:
+		r.DeviceRepository.mu.Lock()
+		defer r.DeviceRepository.mu.Unlock()
+		return r.journalRotation(*device, *expected, *record)
+	default:
+		return fmt.Errorf("invalid %q change", op)
+	}
+}
+
+// Append an entry to the log and sync it
+func (r *FileDeviceRepository) append(entry walEntry) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	r.seq++
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(buf[4:12], r.seq)
+	binary.BigEndian.PutUint32(buf[12:16], crc32.Checksum(buf[0:12], walChecksumTable))
+	binary.BigEndian.PutUint32(buf[16:20], crc32.Checksum(payload, walChecksumTable))
+	copy(buf[walHeaderSize:], payload)
+
+	if _, err := r.log.Write(buf); err != nil {
+		return err
+	}
+
+	return r.log.Sync()
+}
+
+// Replay the entries of the log that are newer than the snapshot. An incomplete or corrupt entry that ends the
+// log is a write that was torn by a crash and never acknowledged, so it is truncated. Any other corrupt entry,
+// including one whose header is corrupt so its end is unknown, fails the replay with ErrCorruptLog.
+func (r *FileDeviceRepository) replay() error {
+	content, err := io.ReadAll(r.log)
+	if err != nil {
+		return err
+	}
+
+	offset := 0
+	for offset < len(content) {
+		entry, seq, size, err := decodeWALEntry(content[offset:])
+		if err != nil {
+			if offset+size < len(content) {
+				return fmt.Errorf("%w: entry at offset %d: %v", ErrCorruptLog, offset, err)
+			}
+			log.Printf("Discarding torn write at offset %d of the write-ahead log in %s: %v", offset, r.dir, err)
+			if err := r.log.Truncate(int64(offset)); err != nil {
+				return err
+			}
+			if err := r.log.Sync(); err != nil {
+				return err
+			}
+			break
+		}
+		offset += size
+
+		// Entries already in the snapshot are left by a crash during a compaction
+		if seq <= r.seq {
+			continue
+		}
+		if seq != r.seq+1 {
+			return fmt.Errorf("%w: entry %d follows entry %d", ErrCorruptLog, seq, r.seq)
+		}
+		if err := r.apply(entry); err != nil {
+			return fmt.Errorf("%w: entry %d: %v", ErrCorruptLog, seq, err)
+		}
+		r.seq = seq
+		r.entries++
+	}
+
+	return nil
+}
+
+// Decode the entry at the start of the buffer, returning its size. When the entry is corrupt the size is the
+// part of the buffer it spans: the length claimed by its verified header, the whole buffer when the header is
+// incomplete or only made of the zeros a torn write can leave, and 0 when the header is otherwise corrupt.
+func decodeWALEntry(buf []byte) (walEntry, uint64, int, error) {
+	var entry walEntry
+	if len(buf) < walHeaderSize {
+		return entry, 0, len(buf), errors.New("incomplete entry header")
+	}
+	if crc32.Checksum(buf[0:12], walChecksumTable) != binary.BigEndian.Uint32(buf[12:16]) {
+		if isZero(buf) {
+			return entry, 0, len(buf), errors.New("unwritten entry")
+		}
+		return entry, 0, 0, errors.New("header checksum mismatch")
+	}
+
+	size := walHeaderSize + int(binary.BigEndian.Uint32(buf[0:4]))
+	if size > len(buf) {
+		return entry, 0, len(buf), errors.New("incomplete entry payload")
+	}
+	if crc32.Checksum(buf[walHeaderSize:size], walChecksumTable) != binary.BigEndian.Uint32(buf[16:20]) {
+		return entry, 0, size, errors.New("payload checksum mismatch")
+	}
+	if err := json.Unmarshal(buf[walHeaderSize:size], &entry); err != nil {
+		return entry, 0, size, err
+	}
+
+	return entry, binary.BigEndian.Uint64(buf[4:12]), size, nil
+}
+
+// Check whether a buffer only holds zeros
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Apply a replayed entry in memory
+func (r *FileDeviceRepository) apply(entry walEntry) error {
+	if entry.Op == walAudit && entry.Audit != nil {
+		r.audit = append(r.audit, *entry.Audit)
+		return nil
+	}
+
+	var device *model.Device
+	if entry.Device != nil {
+		loaded, err := r.loadDevice(*entry.Device)
+		if err != nil {
+			return err
+		}
+		device = &loaded
+	}
+
+	return r.applyChange(entry.Op, device, entry.Expected, entry.Record, entry.Key)
+}
+
+// Write the state in memory to a new snapshot, then empty the log. The snapshot replaces the previous one
+// atomically, and entries left in the log by a crash before it is emptied are skipped by their sequence number.
+func (r *FileDeviceRepository) compact() error {
+	snapshot := walSnapshot{Seq: r.seq, Signatures: make(map[uuid.UUID][]model.SignatureRecord), Audit: r.audit}
+
+	r.DeviceRepository.mu.RLock()
+	for _, device := range r.data {
+		stored, err := r.storeDevice(device)
+		if err != nil {
+			r.DeviceRepository.mu.RUnlock()
+			return err
+		}
+		snapshot.Devices = append(snapshot.Devices, stored)
+	}
+	for id, records := range r.signatures {
+		snapshot.Signatures[id] = records
+	}
+	content, err := json.Marshal(snapshot)
+	r.DeviceRepository.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(r.dir, snapshotFileName), content); err != nil {
+		return err
+	}
+	if err := r.log.Truncate(0); err != nil {
+		return err
+	}
+	if err := r.log.Sync(); err != nil {
+		return err
+	}
+
+	r.entries = 0
+	return nil
+}
+
+// Load the snapshot, if there is one
+func (r *FileDeviceRepository) loadSnapshot() error {
+	content, err := os.ReadFile(filepath.Join(r.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snapshot walSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return fmt.Errorf("failed to decode the snapshot in %s: %w", r.dir, err)
+	}
+	for _, stored := range snapshot.Devices {
+		device, err := r.loadDevice(stored)
+		if err != nil {
+			return err
+		}
+		r.data[device.ID] = device
+	}
+	for id, records := range snapshot.Signatures {
+		r.signatures[id] = records
+	}
+	r.audit = snapshot.Audit
+	r.seq = snapshot.Seq
+
+	return nil
+}
+
+// Convert a device to the form it is stored in
+func (r *FileDeviceRepository) storeDevice(device model.Device) (storedDevice, error) {
+	publicKey, previousKeys, err := encodeDeviceKeys(r.algorithms, device)
+	if err != nil {
+		return storedDevice{}, err
+	}
+
+	return storedDevice{Device: device, PublicKey: publicKey, PreviousKeys: previousKeys}, nil
+}
+
+// Convert a stored device back
+func (r *FileDeviceRepository) loadDevice(stored storedDevice) (model.Device, error) {
+	device := stored.Device
+	if err := decodeDeviceKeys(r.algorithms, &device, stored.PublicKey, stored.PreviousKeys); err != nil {
+		return model.Device{}, err
+	}
+
+	return device, nil
+}
+
+// Write a file through a synced temporary file renamed over it, so it is either fully replaced or unchanged
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename is durable
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// FileAuditRepository keeps the audit log in the write-ahead log and snapshots of a FileDeviceRepository
+type FileAuditRepository struct {
+	devices *FileDeviceRepository
+}
+
+// NewFileAuditRepository creates an audit log stored in the directory of the device repository
+func NewFileAuditRepository(devices *FileDeviceRepository) *FileAuditRepository {
+	return &FileAuditRepository{devices: devices}
+}
+
+// Append adds an entry at the end of the audit log, returning once it is durable
+func (r *FileAuditRepository) Append(entry model.AuditEntry) error {
+	return r.devices.appendAudit(entry)
+}
+
+// GetAll retrieves all the audit entries in the order they were appended
+func (r *FileAuditRepository) GetAll() ([]model.AuditEntry, error) {
+	entries := r.devices.auditEntries()
+	if entries == nil {
+		entries = []model.AuditEntry{}
+	}
+
+	return entries, nil
+}
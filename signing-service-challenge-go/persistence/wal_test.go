@@ -0,0 +1,245 @@
+package persistence
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/model"
+	"github.com/google/uuid"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileDeviceRepo", func() {
+	var (
+		dir        string
+		deviceRepo *FileDeviceRepository
+		device     model.Device
+	)
+
+	// Open the repository in the directory, as on every start
+	open := func(snapshotInterval int) *FileDeviceRepository {
+		repo, err := NewFileDeviceRepository(dir, nil, snapshotInterval)
+		Expect(err).To(BeNil(), "Failed to open the repository")
+		DeferCleanup(repo.Close)
+		return repo
+	}
+
+	// Reserve the next counter of the device and journal its signature
+	sign := func(counter int) error {
+		reservation := NewReservation(device.ID, chainStateBefore(counter), time.Minute)
+		if err := deviceRepo.ReserveCounter(reservation); err != nil {
+			return err
+		}
+		return deviceRepo.AfterSignUpdateDevice(reservation, model.SignatureRecord{
+			DeviceID:   device.ID,
+			Counter:    counter,
+			Data:       fmt.Sprintf("data-%d", counter),
+			SignedData: fmt.Sprintf("%d_data-%d_last", counter, counter),
+			Signature:  fmt.Appendf(nil, "signature-%d", counter),
+			Algorithm:  crypto.AlgorithmED25519,
+			KeyID:      "key-1",
+			Time:       time.Now(),
+		})
+	}
+
+	// Read the signature counter of the device from a repository
+	counter := func(repo *FileDeviceRepository) int {
+		found, err := repo.FindByID(device.ID)
+		Expect(err).To(BeNil(), "Failed to find device")
+		return found.SignatureCounter
+	}
+
+	walPath := func() string { return filepath.Join(dir, walFileName) }
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		deviceRepo = open(0)
+
+		publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).To(BeNil(), "Failed to generate key")
+		device = model.Device{
+			ID:        uuid.New(),
+			Algorithm: crypto.AlgorithmED25519,
+			Label:     "Test device",
+			Digest:    crypto.DigestSHA512,
+			KeyID:     "key-1",
+			PublicKey: publicKey,
+			KeyHandle: []byte("key-handle"),
+		}
+		Expect(deviceRepo.Create(device)).To(Succeed(), "Failed to create device")
+	})
+
+	It("should replay every acknowledged change after a restart", func() {
+		for i := range 3 {
+			Expect(sign(i)).To(Succeed(), "Failed to journal signature %d", i)
+		}
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		reopened := open(0)
+		found, err := reopened.FindByID(device.ID)
+		Expect(err).To(BeNil(), "Failed to find device")
+		Expect(found.PublicKey).To(Equal(device.PublicKey), "The public key should be restored")
+		Expect(found.SignatureCounter).To(Equal(3), "The counter should be the last acknowledged one")
+
+		records, _, err := reopened.GetSignatures(device.ID, 0, 0)
+		Expect(err).To(BeNil(), "Failed to get signatures")
+		Expect(records).To(HaveLen(3), "The journal should be restored")
+	})
+
+	It("should not log a change that does not continue the chain", func() {
+		Expect(sign(1)).NotTo(Succeed(), "The record should have the current counter")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		Expect(counter(open(0))).To(Equal(0), "The rejected change should not be replayed")
+	})
+
+	It("should release the reservations that were not committed when it stopped", func() {
+		Expect(sign(0)).To(Succeed(), "Failed to journal signature")
+		reserve(deviceRepo, device.ID, chainStateBefore(1))
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		reopened := open(0)
+		Expect(counter(reopened)).To(Equal(1), "The reserved counter should not be consumed")
+		reserve(reopened, device.ID, chainStateBefore(1))
+	})
+
+	It("should discard a torn write at the end of the log", func() {
+		Expect(sign(0)).To(Succeed(), "Failed to journal signature")
+		Expect(sign(1)).To(Succeed(), "Failed to journal signature")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		// Cut the last entry in the middle, as a crash during its write would
+		content, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		Expect(os.WriteFile(walPath(), content[:len(content)-10], 0o600)).To(Succeed(), "Failed to tear the log")
+
+		deviceRepo = open(0)
+		Expect(counter(deviceRepo)).To(Equal(1), "Only the complete entries should be replayed")
+		Expect(sign(1)).To(Succeed(), "The log should accept new entries after the torn write")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		Expect(counter(open(0))).To(Equal(2), "The entry written after the torn write should be replayed")
+	})
+
+	It("should discard a last entry failing its checksum", func() {
+		Expect(sign(0)).To(Succeed(), "Failed to journal signature")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		content, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		content[len(content)-2] ^= 0xff
+		Expect(os.WriteFile(walPath(), content, 0o600)).To(Succeed(), "Failed to corrupt the log")
+
+		Expect(counter(open(0))).To(Equal(0), "The corrupt entry should not be replayed")
+	})
+
+	It("should refuse to start on a corrupt entry before the end of the log", func() {
+		Expect(sign(0)).To(Succeed(), "Failed to journal signature")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		// Corrupt the payload of the first entry, creating the device
+		content, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		content[walHeaderSize+2] ^= 0xff
+		Expect(os.WriteFile(walPath(), content, 0o600)).To(Succeed(), "Failed to corrupt the log")
+
+		_, err = NewFileDeviceRepository(dir, nil, 0)
+		Expect(err).To(MatchError(ErrCorruptLog), "Acknowledged changes should not be silently lost")
+	})
+
+	It("should refuse to start on a corrupt entry length before the end of the log", func() {
+		Expect(sign(0)).To(Succeed(), "Failed to journal signature")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		// Make the length of the first entry claim the rest of the log, which would otherwise look like a torn write
+		content, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		binary.BigEndian.PutUint32(content[0:4], uint32(len(content)))
+		Expect(os.WriteFile(walPath(), content, 0o600)).To(Succeed(), "Failed to corrupt the log")
+
+		_, err = NewFileDeviceRepository(dir, nil, 0)
+		Expect(err).To(MatchError(ErrCorruptLog), "Acknowledged changes should not be truncated")
+		truncated, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		Expect(truncated).To(Equal(content), "The corrupt log should be left untouched")
+	})
+
+	It("should discard the unwritten end of the log left by a torn write", func() {
+		Expect(sign(0)).To(Succeed(), "Failed to journal signature")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		content, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		Expect(os.WriteFile(walPath(), append(content, make([]byte, 64)...), 0o600)).To(Succeed(), "Failed to tear the log")
+
+		Expect(counter(open(0))).To(Equal(1), "The complete entries should be replayed")
+		truncated, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		Expect(truncated).To(Equal(content), "The unwritten end of the log should be truncated")
+	})
+
+	It("should keep the audit log across restarts and compactions", func() {
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+		deviceRepo = open(3)
+		entries := []model.AuditEntry{
+			{Time: time.Now().UTC(), Action: "key-export", DeviceID: device.ID, Outcome: "exported"},
+			{Time: time.Now().UTC(), Action: "key-export", DeviceID: uuid.New(), Outcome: "denied", Details: "device not found"},
+			{Time: time.Now().UTC(), Action: "key-export", DeviceID: device.ID, Outcome: "failed"},
+		}
+		for _, entry := range entries {
+			Expect(NewFileAuditRepository(deviceRepo).Append(entry)).To(Succeed(), "Failed to append the audit entry")
+		}
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		// With the creation of the device, the first two entries were compacted into the snapshot and the last one
+		// is replayed from the log
+		restored, err := NewFileAuditRepository(open(3)).GetAll()
+		Expect(err).To(BeNil(), "Failed to retrieve the audit log")
+		Expect(restored).To(Equal(entries), "The audit log should be restored in order")
+	})
+
+	It("should compact the log into snapshots", func() {
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+		deviceRepo = open(3)
+		// With the creation of the device, the log is compacted after the second signature
+		for i := range 4 {
+			Expect(sign(i)).To(Succeed(), "Failed to journal signature %d", i)
+		}
+
+		_, err := os.Stat(filepath.Join(dir, snapshotFileName))
+		Expect(err).To(BeNil(), "A snapshot should be written")
+		Expect(deviceRepo.entries).To(Equal(2), "The log should only hold the entries after the snapshot")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		reopened := open(3)
+		Expect(counter(reopened)).To(Equal(4), "The snapshot and the log should be replayed")
+		_, total, err := reopened.GetSignatures(device.ID, 0, 0)
+		Expect(err).To(BeNil(), "Failed to get signatures")
+		Expect(total).To(Equal(4), "The journal should be restored")
+	})
+
+	It("should skip the entries of the snapshot left by an interrupted compaction", func() {
+		Expect(sign(0)).To(Succeed(), "Failed to journal signature")
+		content, err := os.ReadFile(walPath())
+		Expect(err).To(BeNil(), "Failed to read the log")
+		Expect(deviceRepo.Compact()).To(Succeed(), "Failed to compact the log")
+		Expect(deviceRepo.Close()).To(Succeed(), "Failed to close the repository")
+
+		// Restore the log, as a crash before it was emptied would leave it
+		Expect(os.WriteFile(walPath(), content, 0o600)).To(Succeed(), "Failed to restore the log")
+
+		reopened := open(0)
+		Expect(counter(reopened)).To(Equal(1), "The entries should not be applied twice")
+		_, total, err := reopened.GetSignatures(device.ID, 0, 0)
+		Expect(err).To(BeNil(), "Failed to get signatures")
+		Expect(total).To(Equal(1), "The signature should be journaled once")
+	})
+})
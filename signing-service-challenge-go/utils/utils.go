@@ -1,128 +1,88 @@
 package utils
 
 import (
-	"crypto/ecdsa"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"fmt"
-
 	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 )
 
 type UtilsInterface interface {
-	RSAPublicKeyToString(publicKey any) (string, error)
-	ECCPublicKeyToString(publicKey any) (string, error)
-	RSAPrivateKeyToString(privateKey any) (string, error)
-	ECCPrivateKeyToString(privateKey any) (string, error)
-	GenerateNewKeyPair(algorithm string) (any, any, error)
+	PublicKeyToString(algorithm string, publicKey any) (string, error)
+	ResolveKeyParameters(algorithm string, params crypto.KeyParameters) (crypto.KeyParameters, error)
+	ImportKeyPair(algorithm string, privateKey []byte) (any, any, crypto.KeyParameters, error)
+	EncryptPrivateKey(privateKey any, password string) (string, error)
+	SupportedAlgorithms() []string
 }
 
-type RealUtils struct{}
+// RealUtils implements UtilsInterface with the algorithms of a registry
+type RealUtils struct {
+	algorithms *crypto.Registry
+}
 
-// Convert ECC public key to PEM string
-func (u *RealUtils) ECCPublicKeyToString(publicKey any) (string, error) {
-	publicKeyECC, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return "", fmt.Errorf("failed to assert type of ECC public key")
+// NewRealUtils creates a RealUtils with the algorithms of the registry, the default one when nil,
+// which must be the registry of the DeviceService so both accept the same algorithms
+func NewRealUtils(algorithms *crypto.Registry) *RealUtils {
+	if algorithms == nil {
+		algorithms = crypto.DefaultRegistry
 	}
 
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKeyECC)
+	return &RealUtils{algorithms: algorithms}
+}
+
+// Convert a public key to PEM string using the codec of its algorithm
+func (u *RealUtils) PublicKeyToString(algorithm string, publicKey any) (string, error) {
+	alg, err := u.algorithms.Get(algorithm)
 	if err != nil {
 		return "", err
 	}
 
-	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "EC PUBLIC KEY",
-		Bytes: publicKeyBytes,
-	})
-
-	return string(publicKeyPEM), nil
+	return alg.Codec.EncodePublicKey(publicKey)
 }
 
-// Convert ECC private key to PEM string
-func (u *RealUtils) ECCPrivateKeyToString(privateKey any) (string, error) {
-	privateKeyECC, ok := privateKey.(*ecdsa.PrivateKey)
-	if !ok {
-		return "", fmt.Errorf("failed to assert type of ECC private key")
-	}
-
-	privateKeyBytes, err := x509.MarshalECPrivateKey(privateKeyECC)
+// ResolveKeyParameters validates the key parameters for the specified algorithm and fills in its defaults
+func (u *RealUtils) ResolveKeyParameters(algorithm string, params crypto.KeyParameters) (crypto.KeyParameters, error) {
+	alg, err := u.algorithms.Get(algorithm)
 	if err != nil {
-		return "", err
+		return crypto.KeyParameters{}, err
 	}
 
-	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: privateKeyBytes,
-	})
-
-	return string(privateKeyPEM), nil
+	return alg.Generator.ResolveParameters(params)
 }
 
-// Convert RSA public key to PEM string
-func (u *RealUtils) RSAPublicKeyToString(publicKey any) (string, error) {
-	publicKeyRSA, ok := publicKey.(*rsa.PublicKey)
-	if !ok {
-		return "", fmt.Errorf("failed to assert type of RSA public key")
+// ImportKeyPair decodes an existing PEM private key of the specified algorithm and returns
+// the key pair together with its validated key parameters
+func (u *RealUtils) ImportKeyPair(algorithm string, privateKey []byte) (any, any, crypto.KeyParameters, error) {
+	alg, err := u.algorithms.Get(algorithm)
+	if err != nil {
+		return nil, nil, crypto.KeyParameters{}, err
 	}
 
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKeyRSA)
+	publicKey, decodedPrivateKey, err := alg.Codec.DecodePrivateKey(privateKey)
 	if err != nil {
-		return "", err
+		return nil, nil, crypto.KeyParameters{}, err
 	}
 
-	publicKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: publicKeyBytes,
-	})
+	params, err := alg.Codec.KeyParameters(publicKey)
+	if err != nil {
+		return nil, nil, crypto.KeyParameters{}, err
+	}
+	params, err = alg.Generator.ResolveParameters(params)
+	if err != nil {
+		return nil, nil, crypto.KeyParameters{}, err
+	}
 
-	return string(publicKeyPEM), nil
+	return publicKey, decodedPrivateKey, params, nil
 }
 
-// Convert RSA private key to PEM string
-func (u *RealUtils) RSAPrivateKeyToString(privateKey any) (string, error) {
-	privateKeyRSA, ok := privateKey.(*rsa.PrivateKey)
-	if !ok {
-		return "", fmt.Errorf("failed to assert type of RSA private key")
+// EncryptPrivateKey converts a private key to a password protected PKCS#8 PEM string
+func (u *RealUtils) EncryptPrivateKey(privateKey any, password string) (string, error) {
+	encrypted, err := crypto.EncryptPKCS8PrivateKey(privateKey, []byte(password))
+	if err != nil {
+		return "", err
 	}
 
-	privateKeyBytes := x509.MarshalPKCS1PrivateKey(privateKeyRSA)
-	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: privateKeyBytes,
-	})
-
-	return string(privateKeyPEM), nil
+	return string(encrypted), nil
 }
 
-// GenerateNewKeyPair generates a new key pair based on the specified algorithm
-func (u *RealUtils) GenerateNewKeyPair(algorithm string) (any, any, error) {
-	var publicKey, privateKey any
-	switch algorithm {
-	case "ECC":
-		eccGenerator := crypto.ECCGenerator{}
-
-		eccKeys, err := eccGenerator.Generate()
-		if err != nil {
-			return nil, nil, err
-		}
-
-		publicKey = eccKeys.Public
-		privateKey = eccKeys.Private
-	case "RSA":
-		rsaGenerator := crypto.RSAGenerator{}
-
-		rsaKeys, err := rsaGenerator.Generate()
-		if err != nil {
-			return nil, nil, err
-		}
-
-		publicKey = rsaKeys.Public
-		privateKey = rsaKeys.Private
-	default:
-		return nil, nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
-	}
-
-	return publicKey, privateKey, nil
+// SupportedAlgorithms returns the names of all the registered algorithms
+func (u *RealUtils) SupportedAlgorithms() []string {
+	return u.algorithms.Names()
 }
@@ -2,55 +2,73 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
+
+	"github.com/fiskaly/coding-challenges/signing-service-challenge/crypto"
 )
 
 type MockUtils struct {
-	ECCPublicKeyToStringFunc  func(publicKey any) (string, error)
-	ECCPrivateKeyToStringFunc func(privateKey any) (string, error)
-	RSAPublicKeyToStringFunc  func(publicKey any) (string, error)
-	RSAPrivateKeyToStringFunc func(privateKey any) (string, error)
-	GenerateNewKeyPairFunc    func(algorithm string) (any, any, error)
+	PublicKeyToStringFunc    func(algorithm string, publicKey any) (string, error)
+	ResolveKeyParametersFunc func(algorithm string, params crypto.KeyParameters) (crypto.KeyParameters, error)
+	ImportKeyPairFunc        func(algorithm string, privateKey []byte) (any, any, crypto.KeyParameters, error)
+	EncryptPrivateKeyFunc    func(privateKey any, password string) (string, error)
+	SupportedAlgorithmsFunc  func() []string
 }
 
-func (m *MockUtils) ECCPublicKeyToString(publicKey any) (string, error) {
-	if m.ECCPublicKeyToStringFunc != nil {
-		return m.ECCPublicKeyToStringFunc(publicKey)
+func (m *MockUtils) PublicKeyToString(algorithm string, publicKey any) (string, error) {
+	if m.PublicKeyToStringFunc != nil {
+		return m.PublicKeyToStringFunc(algorithm, publicKey)
 	}
-	return "ECC Public Key String", nil
+	return algorithm + " Public Key String", nil
 }
 
-func (m *MockUtils) ECCPrivateKeyToString(privateKey any) (string, error) {
-	if m.ECCPrivateKeyToStringFunc != nil {
-		return m.ECCPrivateKeyToStringFunc(privateKey)
+func (m *MockUtils) ResolveKeyParameters(algorithm string, params crypto.KeyParameters) (crypto.KeyParameters, error) {
+	if m.ResolveKeyParametersFunc != nil {
+		return m.ResolveKeyParametersFunc(algorithm, params)
 	}
-	return "ECC Private Key String", nil
-}
-
-func (m *MockUtils) RSAPublicKeyToString(publicKey any) (string, error) {
-	if m.RSAPublicKeyToStringFunc != nil {
-		return m.RSAPublicKeyToStringFunc(publicKey)
+	if params != (crypto.KeyParameters{}) {
+		return params, nil
 	}
-	return "RSA Public Key String", nil
-}
-
-func (m *MockUtils) RSAPrivateKeyToString(privateKey any) (string, error) {
-	if m.RSAPrivateKeyToStringFunc != nil {
-		return m.RSAPrivateKeyToStringFunc(privateKey)
+	switch algorithm {
+	case "ECC":
+		return crypto.KeyParameters{Size: 384, Curve: "P-384"}, nil
+	case "RSA":
+		return crypto.KeyParameters{Size: 2048}, nil
+	case "ED25519":
+		return crypto.KeyParameters{Size: 256}, nil
+	default:
+		return params, nil
 	}
-	return "RSA Private Key String", nil
 }
 
-func (m *MockUtils) GenerateNewKeyPair(algorithm string) (any, any, error) {
-	if m.GenerateNewKeyPairFunc != nil {
-		return m.GenerateNewKeyPairFunc(algorithm)
+func (m *MockUtils) ImportKeyPair(algorithm string, privateKey []byte) (any, any, crypto.KeyParameters, error) {
+	if m.ImportKeyPairFunc != nil {
+		return m.ImportKeyPairFunc(algorithm, privateKey)
 	}
+	var publicKey, decodedPrivateKey any
 	switch algorithm {
 	case "ECC":
-		return &ecdsa.PublicKey{}, &ecdsa.PrivateKey{}, nil
+		publicKey, decodedPrivateKey = &ecdsa.PublicKey{}, &ecdsa.PrivateKey{}
 	case "RSA":
-		return &rsa.PublicKey{}, &rsa.PrivateKey{}, nil
-	default:
-		return nil, nil, nil
+		publicKey, decodedPrivateKey = &rsa.PublicKey{}, &rsa.PrivateKey{}
+	case "ED25519":
+		publicKey, decodedPrivateKey = ed25519.PublicKey{}, ed25519.PrivateKey{}
+	}
+	params, err := m.ResolveKeyParameters(algorithm, crypto.KeyParameters{})
+	return publicKey, decodedPrivateKey, params, err
+}
+
+func (m *MockUtils) EncryptPrivateKey(privateKey any, password string) (string, error) {
+	if m.EncryptPrivateKeyFunc != nil {
+		return m.EncryptPrivateKeyFunc(privateKey, password)
+	}
+	return "Encrypted Private Key String", nil
+}
+
+func (m *MockUtils) SupportedAlgorithms() []string {
+	if m.SupportedAlgorithmsFunc != nil {
+		return m.SupportedAlgorithmsFunc()
 	}
+	return []string{"ECC", "ED25519", "RSA"}
 }